@@ -0,0 +1,61 @@
+package micro
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ginger-go/micro/plugins/midware"
+)
+
+// CacheConfig is the setting of the cache of GETWithCache
+// The responses vary by the Authorization header unless they are Public or Vary is set, e.g. to auth.VaryByUser
+// The error responses are not cached
+type CacheConfig struct {
+	Public bool                          // the response is the same for all the callers
+	Vary   []midware.CacheVaryFunc       // the dimensions of the cache key besides the url
+	Tags   func(c *gin.Context) []string // the tags of the response, e.g. order:{id}, see Context.InvalidateCache
+}
+
+// InvalidateCache remove the responses cached with the tags, after the transaction of the request is committed
+func (ctx *Context[T]) InvalidateCache(tags ...string) {
+	store := ctx.cacheStore
+	if store == nil {
+		return
+	}
+	ctx.AfterCommit(func() {
+		store.InvalidateTags(tags...)
+	})
+}
+
+// InvalidateCache remove the responses cached with the tags, e.g. in a cron or an event handler
+func (e *Engine) InvalidateCache(tags ...string) error {
+	return e.CacheStore.InvalidateTags(tags...)
+}
+
+// cacheWith returns the cache of the route, the responses are kept in Engine.CacheStore
+func cacheWith[T any](engine *Engine, duration time.Duration, handlerSetup HandlerResponse[T], service gin.HandlerFunc) gin.HandlerFunc {
+	return midware.CacheWith(midware.CacheConfig{
+		Duration: duration,
+		Store:    engineCacheStore{engine},
+		Public:   handlerSetup.Cache.Public,
+		Vary:     handlerSetup.Cache.Vary,
+		Tags:     handlerSetup.Cache.Tags,
+	}, service)
+}
+
+// engineCacheStore use the store of the engine when the route is called, so Engine.CacheStore can be set after the routes
+type engineCacheStore struct {
+	engine *Engine
+}
+
+func (s engineCacheStore) Get(key string) (*midware.CachedResponse, bool, error) {
+	return s.engine.CacheStore.Get(key)
+}
+
+func (s engineCacheStore) Set(key string, resp *midware.CachedResponse, ttl time.Duration, tags []string) error {
+	return s.engine.CacheStore.Set(key, resp, ttl, tags)
+}
+
+func (s engineCacheStore) InvalidateTags(tags ...string) error {
+	return s.engine.CacheStore.InvalidateTags(tags...)
+}
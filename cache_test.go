@@ -0,0 +1,97 @@
+package micro
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func cacheEngine(loads *int, fail *bool) *Engine {
+	engine := newTestEngine()
+	GETWithCache(engine, "/orders/:id", time.Minute, func() HandlerResponse[testOrderRequest] {
+		return HandlerResponse[testOrderRequest]{
+			Cache: CacheConfig{
+				Tags: func(c *gin.Context) []string { return []string{"order:" + c.Param("id")} },
+			},
+			Service: func(ctx *Context[testOrderRequest]) (interface{}, Error) {
+				*loads++
+				if *fail {
+					return nil, NewError(ERR_CODE_NOT_FOUND)
+				}
+				return &testOrder{ID: ctx.Request.ID, Version: *loads}, nil
+			},
+		}
+	})
+	PUT(engine, "/orders/:id", func() HandlerResponse[testOrderRequest] {
+		return HandlerResponse[testOrderRequest]{
+			Service: func(ctx *Context[testOrderRequest]) (interface{}, Error) {
+				ctx.InvalidateCache("order:" + ctx.GinContext.Param("id"))
+				return nil, nil
+			},
+		}
+	})
+	return engine
+}
+
+func TestGETWithCache(t *testing.T) {
+	loads, fail := 0, false
+	engine := cacheEngine(&loads, &fail)
+	alice := map[string]string{"Authorization": "Bearer alice"}
+
+	first := serve(engine, "GET", "/orders/1", "", alice)
+	second := serve(engine, "GET", "/orders/1", "", alice)
+	if loads != 1 || second.Body.String() != first.Body.String() {
+		t.Errorf("%d loads, want the second response cached", loads)
+	}
+	serve(engine, "GET", "/orders/1", "", map[string]string{"Authorization": "Bearer bob"})
+	if loads != 2 {
+		t.Errorf("%d loads, want the responses vary by the caller", loads)
+	}
+
+	serve(engine, "PUT", "/orders/2", "", alice)
+	serve(engine, "GET", "/orders/1", "", alice)
+	if loads != 2 {
+		t.Errorf("%d loads, want the other tags kept", loads)
+	}
+	serve(engine, "PUT", "/orders/1", "", alice)
+	serve(engine, "GET", "/orders/1", "", alice)
+	if loads != 3 {
+		t.Errorf("%d loads, want the tag invalidated", loads)
+	}
+}
+
+func TestGETWithCacheError(t *testing.T) {
+	loads, fail := 0, true
+	engine := cacheEngine(&loads, &fail)
+	serve(engine, "GET", "/orders/1", "", nil)
+	fail = false
+	w := serve(engine, "GET", "/orders/1", "", nil)
+	if resp := decodeResponse(t, w.Body.Bytes(), nil); loads != 2 || !resp.Success {
+		t.Errorf("%d loads %s, want the error not cached", loads, w.Body)
+	}
+}
+
+func TestGETWithCacheResult(t *testing.T) {
+	loads := 0
+	engine := newTestEngine()
+	GETWithCache(engine, "/exports/:id", time.Minute, func() HandlerResponse[testOrderRequest] {
+		return HandlerResponse[testOrderRequest]{
+			Service: func(ctx *Context[testOrderRequest]) (interface{}, Error) {
+				loads++
+				return &StreamResult{ContentType: "text/csv", Length: -1, Reader: strings.NewReader("export " + strconv.Itoa(loads))}, nil
+			},
+		}
+	})
+
+	first := serve(engine, "GET", "/exports/1", "", nil)
+	second := serve(engine, "GET", "/exports/1", "", nil)
+	if loads != 2 || second.Body.String() != "export 2" {
+		t.Errorf("%d loads %q, want the result not cached", loads, second.Body)
+	}
+	if first.Header().Get("ETag") != "" || first.Header().Get("Content-Type") != "text/csv" || first.Body.String() != "export 1" {
+		t.Errorf("headers %v body %q, want the result written as is", first.Header(), first.Body)
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ginger-go/micro"
+)
+
+// generator write the client of the routes
+type generator struct {
+	routes  *micro.Routes
+	imports map[string]bool
+	names   map[string]bool
+	isZero  bool // the isZero helper is used
+	time    bool // the formatTime helper is used
+	buf     bytes.Buffer
+}
+
+// requestField is a field of the request bound from the uri, the query or the header
+type requestField struct {
+	path   string // the selector from the request, e.g. req.Filter.Status
+	name   string // the name in the tag
+	ptr    bool
+	slice  bool
+	time   bool   // the field is a time, formatted by the time_format tag as gin parses it
+	format string // the time_format tag
+}
+
+var paramPattern = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// generateClient returns the source of the client package of the routes
+func generateClient(pkg string, routes *micro.Routes) ([]byte, error) {
+	g := &generator{
+		routes: routes,
+		imports: map[string]bool{
+			"net/url":                    true,
+			"github.com/ginger-go/micro": true,
+			"github.com/ginger-go/micro/plugins/apicall": true,
+		},
+		names: make(map[string]bool),
+	}
+
+	g.writeClient()
+	typeNames := make([]string, 0, len(routes.Types))
+	for name := range routes.Types {
+		typeNames = append(typeNames, name)
+	}
+	sort.Strings(typeNames)
+	for _, name := range typeNames {
+		g.printf("\ntype %s %s\n", name, g.structExpr(routes.Types[name].Fields))
+	}
+	for _, route := range routes.Routes {
+		g.writeRoute(route)
+	}
+	if g.isZero {
+		g.imports["reflect"] = true
+		g.printf(`
+func isZero(v interface{}) bool {
+	return reflect.ValueOf(v).IsZero()
+}
+`)
+	}
+	if g.time {
+		g.imports["strconv"] = true
+		g.imports["time"] = true
+		g.printf(`
+// formatTime format the time by the time_format tag, as gin parses it
+func formatTime(t time.Time, format string) string {
+	switch strings.ToLower(format) {
+	case "":
+		return t.Format(time.RFC3339)
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "unixnano":
+		return strconv.FormatInt(t.UnixNano(), 10)
+	}
+	return t.Format(format)
+}
+`)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by micro gen client from %s. DO NOT EDIT.\n\n", routes.SystemName)
+	fmt.Fprintf(&out, "package %s\n\nimport (\n", pkg)
+	imports := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		imports = append(imports, path)
+	}
+	sort.Slice(imports, func(i, j int) bool {
+		if std(imports[i]) != std(imports[j]) {
+			return std(imports[i])
+		}
+		return imports[i] < imports[j]
+	})
+	for i, path := range imports {
+		if i > 0 && std(path) != std(imports[i-1]) {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(&out, "%q\n", path)
+	}
+	out.WriteString(")\n")
+	out.Write(g.buf.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return out.Bytes(), fmt.Errorf("format the client: %w", err)
+	}
+	return src, nil
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) writeClient() {
+	g.printf(`
+// SYSTEM_ID is the system id of the service
+const SYSTEM_ID = %q
+
+// Client call the service, the BaseURL can be a micro://{name} url
+type Client struct {
+	BaseURL string
+	Headers map[string]string // sent with every request, e.g. the system token
+}
+
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL}
+}
+
+func (c *Client) url(path string, query url.Values) string {
+	u := strings.TrimSuffix(c.BaseURL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+func (c *Client) headers() map[string]string {
+	headers := make(map[string]string, len(c.Headers))
+	for k, v := range c.Headers {
+		headers[k] = v
+	}
+	return headers
+}
+
+func trace(ctx micro.Tracer) (string, []micro.Trace) {
+	if ctx == nil {
+		return "", make([]micro.Trace, 0)
+	}
+	return ctx.Trace()
+}
+
+// requestContext returns ctx if it is a context.Context, e.g. the micro.Context of the service, so its deadline is sent
+func requestContext(ctx micro.Tracer) context.Context {
+	if c, ok := ctx.(context.Context); ok {
+		return c
+	}
+	return context.Background()
+}
+
+// escapePath escape the path parameter, the colons and the asterisks too, so they are not taken as the parameters of the route
+func escapePath(s string) string {
+	return strings.NewReplacer(":", "%%3A", "*", "%%2A").Replace(url.PathEscape(s))
+}
+`, g.routes.SystemID)
+	g.imports["strings"] = true
+	g.imports["context"] = true
+}
+
+func (g *generator) writeRoute(route micro.RouteInfo) {
+	name := g.methodName(route)
+	reqType := "struct{}"
+	if route.Request != nil {
+		reqType = g.typeExpr(route.Request)
+	}
+	respType := "interface{}"
+	if route.Response != nil {
+		respType = g.typeExpr(route.Response)
+	}
+	uris, forms, headers := g.requestFields(route.Request)
+
+	// the path params not in the request are arguments
+	params := make([]string, 0)
+	path := fmt.Sprintf("%q", route.Path)
+	for _, match := range paramPattern.FindAllStringSubmatch(route.Path, -1) {
+		value := ""
+		for _, f := range uris {
+			if f.name == match[1] {
+				value = "escapePath(" + g.valueExpr(f, deref(f)) + ")"
+			}
+		}
+		if value == "" {
+			arg := lowerFirst(goName(match[1]))
+			params = append(params, arg)
+			value = "escapePath(" + arg + ")"
+		}
+		if strings.HasPrefix(match[0], "*") {
+			value = strings.Replace(value, "escapePath", "", 1)
+		}
+		path = strings.Replace(path, match[0], `" + `+value+` + "`, 1)
+	}
+	path = strings.TrimSuffix(strings.TrimPrefix(path, `"" + `), ` + ""`)
+
+	args := []string{"ctx micro.Tracer", "req *" + reqType}
+	for _, p := range params {
+		args = append(args, p+" string")
+	}
+	results := []string{"*" + respType}
+	zeros := []string{"nil"}
+	returns := []string{"resp.Data"}
+	if route.Pagination {
+		g.imports["github.com/ginger-go/sql"] = true
+		args = append(args, "page *sql.Pagination")
+		results = append(results, "*sql.Pagination")
+		zeros = append(zeros, "nil")
+		returns = append(returns, "resp.Pagination")
+	}
+	if route.Sort {
+		g.imports["github.com/ginger-go/sql"] = true
+		args = append(args, "sort *sql.Sort")
+	}
+	if route.Cursor {
+		args = append(args, "cursor *micro.Cursor")
+		results = append(results, "*micro.Cursor")
+		zeros = append(zeros, "nil")
+		returns = append(returns, "resp.Cursor")
+	}
+	results = append(results, "micro.Error")
+
+	g.printf("\n// %s call %s %s\n", name, route.Method, route.Path)
+	g.printf("func (c *Client) %s(%s) (%s) {\n", name, strings.Join(args, ", "), strings.Join(results, ", "))
+	g.printf("traceID, traces := trace(ctx)\n")
+	g.printf("if req == nil {\nreq = new(%s)\n}\n", reqType)
+	g.printf("query := url.Values{}\n")
+	for _, f := range forms {
+		g.writeQuery(f)
+	}
+	if route.Pagination {
+		g.imports["strconv"] = true
+		g.printf("if page != nil {\nquery.Set(\"page\", strconv.Itoa(page.Page))\nquery.Set(\"size\", strconv.Itoa(page.Size))\n}\n")
+	}
+	if route.Sort {
+		g.imports["strconv"] = true
+		g.printf("if sort != nil {\nquery.Set(\"by\", sort.By)\nquery.Set(\"asc\", strconv.FormatBool(sort.Asc))\n}\n")
+	}
+	if route.Cursor {
+		g.imports["strconv"] = true
+		g.printf("if cursor != nil {\nif cursor.Token != \"\" {\nquery.Set(\"cursor\", cursor.Token)\n}\nif cursor.Size > 0 {\nquery.Set(\"size\", strconv.Itoa(cursor.Size))\n}\n}\n")
+	}
+	g.printf("headers := c.headers()\n")
+	for _, f := range headers {
+		if f.ptr {
+			g.printf("if %s != nil {\nheaders[%q] = %s\n}\n", f.path, f.name, g.valueExpr(f, "*"+f.path))
+		} else {
+			g.printf("if !isZero(%s) {\nheaders[%q] = %s\n}\n", f.path, f.name, g.valueExpr(f, f.path))
+			g.isZero = true
+		}
+	}
+
+	body := ""
+	if route.Method != "GET" {
+		body = ".\nBody(req)"
+	}
+	g.printf("resp, err := apicall.Send[%s](apicall.NewRequest(%q, c.url(%s, query))%s.\nHeaders(headers).\nTrace(traceID, traces).\nContext(requestContext(ctx)))\n", respType, route.Method, path, body)
+	g.printf("if err := apicall.Error(resp, err); err != nil {\nreturn %s, err\n}\n", strings.Join(zeros, ", "))
+	g.printf("return %s, nil\n}\n", strings.Join(returns, ", "))
+}
+
+func (g *generator) writeQuery(f requestField) {
+	switch {
+	case f.slice:
+		g.printf("for _, v := range %s {\nquery.Add(%q, %s)\n}\n", f.path, f.name, g.valueExpr(f, "v"))
+	case f.ptr:
+		g.printf("if %s != nil {\nquery.Set(%q, %s)\n}\n", f.path, f.name, g.valueExpr(f, "*"+f.path))
+	default:
+		g.printf("if !isZero(%s) {\nquery.Set(%q, %s)\n}\n", f.path, f.name, g.valueExpr(f, f.path))
+		g.isZero = true
+	}
+}
+
+// valueExpr returns the expression of the value in the string form gin binds, the times are formatted by their time_format
+func (g *generator) valueExpr(f requestField, value string) string {
+	if f.time {
+		g.time = true
+		return fmt.Sprintf("formatTime(%s, %q)", value, f.format)
+	}
+	g.imports["fmt"] = true
+	return "fmt.Sprint(" + value + ")"
+}
+
+// requestFields returns the fields of the request bound from the uri, the query and the header
+// The fields of the embedded and the nested structs are included, as gin binds them
+func (g *generator) requestFields(t *micro.TypeInfo) (uris, forms, headers []requestField) {
+	var walk func(t *micro.TypeInfo, path string, seen map[string]bool)
+	walk = func(t *micro.TypeInfo, path string, seen map[string]bool) {
+		fields := t.Fields
+		if t.Name != "" {
+			if seen[t.Name] || g.routes.Types[t.Name] == nil {
+				return
+			}
+			seen[t.Name] = true
+			defer delete(seen, t.Name)
+			fields = g.routes.Types[t.Name].Fields
+		}
+		for _, field := range fields {
+			tag := reflect.StructTag(field.Tag)
+			selector := path + "." + field.Name
+			typ := field.Type
+			ptr := typ.Kind == micro.TYPE_KIND_PTR
+			if ptr {
+				typ = typ.Elem
+			}
+			if typ.Kind == micro.TYPE_KIND_STRUCT && !ptr {
+				if _, ok := tag.Lookup("form"); !ok || field.Embedded {
+					walk(typ, selector, seen)
+					continue
+				}
+			}
+			slice := typ.Kind == micro.TYPE_KIND_SLICE && !ptr
+			isTime := typ.Kind == micro.TYPE_KIND_TIME || (slice && typ.Elem.Kind == micro.TYPE_KIND_TIME)
+			format := tag.Get("time_format")
+			if name := tagName(tag, "uri"); name != "" {
+				uris = append(uris, requestField{path: selector, name: name, ptr: ptr, time: isTime, format: format})
+			}
+			if name := tagName(tag, "form"); name != "" && typ.Kind != micro.TYPE_KIND_STRUCT && typ.Kind != micro.TYPE_KIND_MAP {
+				forms = append(forms, requestField{path: selector, name: name, ptr: ptr, slice: slice, time: isTime, format: format})
+			}
+			if name := tagName(tag, "header"); name != "" {
+				headers = append(headers, requestField{path: selector, name: name, ptr: ptr, time: isTime, format: format})
+			}
+		}
+	}
+	if t == nil {
+		return
+	}
+	if t.Kind == micro.TYPE_KIND_STRUCT {
+		walk(t, "req", map[string]bool{})
+	}
+	return
+}
+
+// std returns if the import path is of the standard library
+func std(path string) bool {
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
+
+func tagName(tag reflect.StructTag, key string) string {
+	name := strings.Split(tag.Get(key), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+func deref(f requestField) string {
+	if f.ptr {
+		return "*" + f.path
+	}
+	return f.path
+}
+
+// typeExpr returns the go expression of the type
+func (g *generator) typeExpr(t *micro.TypeInfo) string {
+	if t == nil {
+		return "interface{}"
+	}
+	switch t.Kind {
+	case micro.TYPE_KIND_TIME:
+		g.imports["time"] = true
+		return "time.Time"
+	case micro.TYPE_KIND_BYTES:
+		return "[]byte"
+	case micro.TYPE_KIND_ANY:
+		return "interface{}"
+	case micro.TYPE_KIND_PTR:
+		return "*" + g.typeExpr(t.Elem)
+	case micro.TYPE_KIND_SLICE:
+		return "[]" + g.typeExpr(t.Elem)
+	case micro.TYPE_KIND_MAP:
+		return "map[" + g.typeExpr(t.Key) + "]" + g.typeExpr(t.Elem)
+	case micro.TYPE_KIND_STRUCT:
+		if t.Name != "" {
+			return t.Name
+		}
+		return g.structExpr(t.Fields)
+	}
+	return t.Kind
+}
+
+func (g *generator) structExpr(fields []micro.FieldInfo) string {
+	if len(fields) == 0 {
+		return "struct{}"
+	}
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	for _, field := range fields {
+		if field.Embedded {
+			b.WriteString(g.typeExpr(field.Type))
+		} else {
+			b.WriteString(field.Name + " " + g.typeExpr(field.Type))
+		}
+		if field.Tag != "" {
+			b.WriteString(" `" + field.Tag + "`")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// methodName returns the unique method name of the route, the handler name or from the method and the path
+func (g *generator) methodName(route micro.RouteInfo) string {
+	name := goName(route.Name)
+	if name == "" {
+		name = goName(strings.ToLower(route.Method))
+		for _, segment := range strings.Split(route.Path, "/") {
+			switch {
+			case segment == "":
+			case segment[0] == ':' || segment[0] == '*':
+				name += "By" + goName(segment[1:])
+			default:
+				name += goName(segment)
+			}
+		}
+	}
+	unique := name
+	for i := 2; g.names[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	g.names[unique] = true
+	return unique
+}
+
+// goName returns the exported go name of the words, e.g. order_items to OrderItems, id to ID
+func goName(s string) string {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, word := range words {
+		switch strings.ToLower(word) {
+		case "id", "url", "uuid", "ip", "api":
+			b.WriteString(strings.ToUpper(word))
+		default:
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	name := b.String()
+	if name != "" && unicode.IsDigit(rune(name[0])) {
+		name = "X" + name
+	}
+	return name
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return "param"
+	}
+	if strings.ToUpper(s) == s {
+		return strings.ToLower(s)
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
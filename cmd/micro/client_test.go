@@ -0,0 +1,94 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/ginger-go/micro"
+)
+
+func testRoutes() *micro.Routes {
+	timeType := &micro.TypeInfo{Kind: micro.TYPE_KIND_TIME}
+	return &micro.Routes{
+		SystemID:   "order",
+		SystemName: "order",
+		Routes: []micro.RouteInfo{
+			{
+				Name:       "listOrders",
+				Method:     "GET",
+				Path:       "/orders/:shop",
+				Request:    &micro.TypeInfo{Kind: micro.TYPE_KIND_STRUCT, Name: "ListOrdersRequest"},
+				Response:   &micro.TypeInfo{Kind: micro.TYPE_KIND_SLICE, Elem: &micro.TypeInfo{Kind: micro.TYPE_KIND_STRUCT, Name: "Order"}},
+				Pagination: true,
+			},
+			{
+				Method:  "PUT",
+				Path:    "/orders/:id/*path",
+				Request: &micro.TypeInfo{Kind: micro.TYPE_KIND_STRUCT, Name: "Order"},
+			},
+		},
+		Types: map[string]*micro.TypeInfo{
+			"ListOrdersRequest": {Kind: micro.TYPE_KIND_STRUCT, Fields: []micro.FieldInfo{
+				{Name: "Shop", Type: &micro.TypeInfo{Kind: "string"}, Tag: `uri:"shop"`},
+				{Name: "Since", Type: &micro.TypeInfo{Kind: micro.TYPE_KIND_PTR, Elem: timeType}, Tag: `form:"since"`},
+				{Name: "Until", Type: timeType, Tag: `form:"until" time_format:"unix"`},
+				{Name: "Days", Type: &micro.TypeInfo{Kind: micro.TYPE_KIND_SLICE, Elem: timeType}, Tag: `form:"day" time_format:"2006-01-02"`},
+				{Name: "Status", Type: &micro.TypeInfo{Kind: micro.TYPE_KIND_SLICE, Elem: &micro.TypeInfo{Kind: "string"}}, Tag: `form:"status"`},
+				{Name: "At", Type: timeType, Tag: `header:"X-At"`},
+				{Name: "Lang", Type: &micro.TypeInfo{Kind: "string"}, Tag: `header:"Accept-Language"`},
+			}},
+			"Order": {Kind: micro.TYPE_KIND_STRUCT, Fields: []micro.FieldInfo{
+				{Name: "ID", Type: &micro.TypeInfo{Kind: "uint"}, Tag: `uri:"id" json:"id"`},
+				{Name: "PaidAt", Type: &micro.TypeInfo{Kind: micro.TYPE_KIND_PTR, Elem: timeType}, Tag: `json:"paid_at"`},
+			}},
+		},
+	}
+}
+
+func TestGenerateClient(t *testing.T) {
+	src, err := generateClient("orderclient", testRoutes())
+	if err != nil {
+		t.Fatalf("%v\n%s", err, src)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "client.go", src, parser.AllErrors); err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+	for _, want := range []string{
+		"package orderclient",
+		`const SYSTEM_ID = "order"`,
+		"func (c *Client) ListOrders(ctx micro.Tracer, req *ListOrdersRequest, page *sql.Pagination) (*[]Order, *sql.Pagination, micro.Error)",
+		`"/orders/"+escapePath(fmt.Sprint(req.Shop))`,
+		`query.Set("since", formatTime(*req.Since, ""))`,
+		`query.Set("until", formatTime(req.Until, "unix"))`,
+		`query.Add("day", formatTime(v, "2006-01-02"))`,
+		`query.Add("status", fmt.Sprint(v))`,
+		`headers["X-At"] = formatTime(req.At, "")`,
+		`headers["Accept-Language"] = fmt.Sprint(req.Lang)`,
+		"func formatTime(t time.Time, format string) string",
+		"return t.Format(time.RFC3339)",
+		"PaidAt *time.Time `json:\"paid_at\"`",
+		"func (c *Client) PutOrdersByIDByPath(ctx micro.Tracer, req *Order, path string) (*interface{}, micro.Error)",
+		`"/orders/"+escapePath(fmt.Sprint(req.ID))+"/"+(path)`,
+		"Body(req)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("the client has no %s\n%s", want, code)
+		}
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for in, want := range map[string]string{
+		"order_items": "OrderItems",
+		"id":          "ID",
+		"user-api":    "UserAPI",
+		"2fa":         "X2fa",
+	} {
+		if got := goName(in); got != want {
+			t.Errorf("goName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
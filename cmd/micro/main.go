@@ -0,0 +1,84 @@
+// Command micro is the tool of the micro services
+//
+//	micro gen client -url http://order-service:8080 -package orderclient -out ./orderclient
+//	micro gen client -file routes.json -package orderclient -out ./orderclient
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ginger-go/micro"
+)
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "gen" || os.Args[2] != "client" {
+		fmt.Fprintln(os.Stderr, "usage: micro gen client [-url url | -file file] -package name -out dir")
+		os.Exit(2)
+	}
+	flags := flag.NewFlagSet("micro gen client", flag.ExitOnError)
+	url := flags.String("url", "", "the base url of the service, its /micro/routes is read")
+	file := flags.String("file", "", "the json file of the routes, the output of /micro/routes")
+	pkg := flags.String("package", "", "the package name of the client, default the last element of out")
+	out := flags.String("out", ".", "the output directory")
+	flags.Parse(os.Args[3:])
+
+	routes, err := readRoutes(*url, *file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *pkg == "" {
+		abs, _ := filepath.Abs(*out)
+		*pkg = strings.ReplaceAll(filepath.Base(abs), "-", "")
+	}
+	src, err := generateClient(*pkg, routes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(filepath.Join(*out, "client.go"), src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func readRoutes(url string, file string) (*micro.Routes, error) {
+	var data []byte
+	var err error
+	switch {
+	case file != "":
+		data, err = os.ReadFile(file)
+	case url != "":
+		var resp *http.Response
+		resp, err = http.Get(strings.TrimSuffix(url, "/") + "/micro/routes")
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET /micro/routes: %s", resp.Status)
+		}
+		data, err = io.ReadAll(resp.Body)
+	default:
+		return nil, fmt.Errorf("-url or -file is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var routes micro.Routes
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, err
+	}
+	return &routes, nil
+}
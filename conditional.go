@@ -0,0 +1,111 @@
+package micro
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ginger-go/micro/plugins/midware"
+	"github.com/ginger-go/sql"
+)
+
+// SetETag set the ETag of the response, e.g. the version of the data, instead of the one computed by HandlerResponse.ETag
+// It returns if the copy of the client is fresh, the service can then return without loading the data, the client gets 304
+func (ctx *Context[T]) SetETag(etag string) bool {
+	ctx.etag = quoteETag(etag)
+	return ctx.notModified()
+}
+
+// SetLastModified set the Last-Modified of the response
+// It returns if the copy of the client is fresh, the service can then return without loading the data, the client gets 304
+func (ctx *Context[T]) SetLastModified(t time.Time) bool {
+	ctx.lastModified = t
+	return ctx.notModified()
+}
+
+// CheckPrecondition returns ERR_CODE_PRECONDITION_FAILED if the If-Match or the If-Unmodified-Since of the request does not match the current version of the data
+// Call it in PUT and DELETE before the data is written, e.g.
+//
+//	if err := ctx.CheckPrecondition(micro.ETagOf(order), order.UpdatedAt); err != nil {
+//		return nil, err
+//	}
+func (ctx *Context[T]) CheckPrecondition(etag string, lastModified time.Time) Error {
+	if ifMatch := ctx.Header("If-Match"); ifMatch != "" {
+		if !midware.Match(ifMatch, quoteETag(etag)) {
+			return NewError(ERR_CODE_PRECONDITION_FAILED)
+		}
+		return nil
+	}
+	since, err := http.ParseTime(ctx.Header("If-Unmodified-Since"))
+	if err == nil && !lastModified.IsZero() && lastModified.Truncate(time.Second).After(since) {
+		return NewError(ERR_CODE_PRECONDITION_FAILED)
+	}
+	return nil
+}
+
+// ETagOf returns the strong ETag of the data, it is the ETag computed by ETAG_WEAK without the W/ prefix if the data is not paged
+func ETagOf(data interface{}) string {
+	b, _ := json.Marshal(data)
+	return midware.ETag(b)
+}
+
+// quoteETag quote the etag if it is not, e.g. a version number
+func quoteETag(etag string) string {
+	if etag == "" || strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+// notModified returns if the request is a GET or a HEAD whose copy of the client is fresh
+// If-Modified-Since is only checked without If-None-Match
+func (ctx *Context[T]) notModified() bool {
+	if ctx.GinContext == nil || ctx.GinContext.Request == nil {
+		return false
+	}
+	if method := ctx.GinContext.Request.Method; method != http.MethodGet && method != http.MethodHead {
+		return false
+	}
+	if ifNoneMatch := ctx.Header("If-None-Match"); ifNoneMatch != "" {
+		return ctx.etag != "" && midware.NoneMatch(ifNoneMatch, ctx.etag)
+	}
+	since, err := http.ParseTime(ctx.Header("If-Modified-Since"))
+	return err == nil && !ctx.lastModified.IsZero() && !ctx.lastModified.Truncate(time.Second).After(since)
+}
+
+// conditional set the validators of the response and returns if the client gets 304
+// The ETag is computed by the mode if the service did not set it, the data, the pagination and the cursor are hashed
+func (ctx *Context[T]) conditional(mode string, data interface{}, page *sql.Pagination) bool {
+	if ctx.etag == "" && mode != "" {
+		b, _ := json.Marshal(data)
+		if page != nil || ctx.Cursor != nil {
+			pages, _ := json.Marshal([]interface{}{page, ctx.Cursor})
+			b = append(b, pages...)
+		}
+		if mode == ETAG_WEAK {
+			ctx.etag = "W/" + midware.ETag(b)
+		} else {
+			// the encodings are different bytes, so they are different strong tags
+			b = append(b, negotiateEncoding(ctx.GinContext, data)...)
+			ctx.etag = midware.ETag(b)
+		}
+	}
+	if ctx.etag != "" {
+		ctx.GinContext.Header("ETag", ctx.etag)
+	}
+	if !ctx.lastModified.IsZero() {
+		ctx.GinContext.Header("Last-Modified", ctx.lastModified.UTC().Format(http.TimeFormat))
+	}
+	return ctx.notModified()
+}
+
+// NotModified write 304 without a body, the trace id and the traces are sent in the headers
+func (ctx *Context[T]) NotModified(traceID string, traces []Trace) {
+	ctx.Response = nil // for testing
+	ctx.GinContext.Header(MICRO_HEADER_TRACE_ID, traceID)
+	b, _ := json.Marshal(traces)
+	ctx.GinContext.Header(MICRO_HEADER_TRACES, string(b))
+	ctx.GinContext.Status(http.StatusNotModified)
+	ctx.GinContext.Writer.WriteHeaderNow()
+}
@@ -0,0 +1,199 @@
+package micro
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testOrderRequest struct {
+	ID uint `uri:"id"`
+}
+
+type testOrder struct {
+	ID      uint   `json:"id"`
+	Status  string `json:"status"`
+	Version int    `json:"version"`
+}
+
+func etagEngine(mode string) *Engine {
+	engine := newTestEngine()
+	GET(engine, "/orders/:id", func() HandlerResponse[testOrderRequest] {
+		return HandlerResponse[testOrderRequest]{
+			ETag: mode,
+			Service: func(ctx *Context[testOrderRequest]) (interface{}, Error) {
+				return &testOrder{ID: ctx.Request.ID, Status: "paid"}, nil
+			},
+		}
+	})
+	return engine
+}
+
+func TestETag(t *testing.T) {
+	for _, mode := range []string{ETAG_STRONG, ETAG_WEAK} {
+		t.Run(mode, func(t *testing.T) {
+			engine := etagEngine(mode)
+			first := serve(engine, "GET", "/orders/1", "", nil)
+			etag := first.Header().Get("ETag")
+			if first.Code != 200 || etag == "" || strings.HasPrefix(etag, "W/") != (mode == ETAG_WEAK) {
+				t.Fatalf("status %d, ETag %q", first.Code, etag)
+			}
+			if again := serve(engine, "GET", "/orders/1", "", nil); again.Header().Get("ETag") != etag {
+				t.Errorf("the ETag of the same data changed: %q, want %q", again.Header().Get("ETag"), etag)
+			}
+			if other := serve(engine, "GET", "/orders/2", "", nil); other.Header().Get("ETag") == etag {
+				t.Error("the ETag of other data is the same")
+			}
+
+			w := serve(engine, "GET", "/orders/1", "", map[string]string{"If-None-Match": etag, MICRO_HEADER_TRACE_ID: "trace-1"})
+			if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+				t.Errorf("status %d %s, want 304 without a body", w.Code, w.Body)
+			}
+			if w.Header().Get(MICRO_HEADER_TRACE_ID) != "trace-1" || w.Header().Get(MICRO_HEADER_TRACES) == "" {
+				t.Errorf("the trace headers of 304: %v", w.Header())
+			}
+			if w := serve(engine, "GET", "/orders/1", "", map[string]string{"If-None-Match": `"stale"`}); w.Code != 200 {
+				t.Errorf("status %d for a stale copy, want 200", w.Code)
+			}
+		})
+	}
+	if w := serve(etagEngine(""), "GET", "/orders/1", "", nil); w.Header().Get("ETag") != "" {
+		t.Errorf("ETag %q without the mode", w.Header().Get("ETag"))
+	}
+}
+
+func TestSetETag(t *testing.T) {
+	loaded := 0
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	engine := newTestEngine()
+	GET(engine, "/orders/:id", func() HandlerResponse[testOrderRequest] {
+		return HandlerResponse[testOrderRequest]{
+			Service: func(ctx *Context[testOrderRequest]) (interface{}, Error) {
+				if ctx.SetETag("3") || ctx.SetLastModified(modified) {
+					return nil, nil
+				}
+				loaded++
+				return &testOrder{ID: ctx.Request.ID, Version: 3}, nil
+			},
+		}
+	})
+
+	w := serve(engine, "GET", "/orders/1", "", nil)
+	if w.Header().Get("ETag") != `"3"` || w.Header().Get("Last-Modified") != modified.Format(http.TimeFormat) || loaded != 1 {
+		t.Errorf("headers %v, %d loads", w.Header(), loaded)
+	}
+	for _, headers := range []map[string]string{
+		{"If-None-Match": `"3"`},
+		{"If-None-Match": `W/"3"`},
+		{"If-Modified-Since": modified.Format(http.TimeFormat)},
+	} {
+		if w := serve(engine, "GET", "/orders/1", "", headers); w.Code != http.StatusNotModified {
+			t.Errorf("status %d for %v, want 304", w.Code, headers)
+		}
+	}
+	if loaded != 1 {
+		t.Errorf("%d loads, want the fresh copies not loaded", loaded)
+	}
+	for _, headers := range []map[string]string{
+		{"If-None-Match": `"2"`},
+		{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)},
+		// If-Modified-Since is ignored with If-None-Match
+		{"If-None-Match": `"2"`, "If-Modified-Since": modified.Format(http.TimeFormat)},
+	} {
+		if w := serve(engine, "GET", "/orders/1", "", headers); w.Code != 200 {
+			t.Errorf("status %d for %v, want 200", w.Code, headers)
+		}
+	}
+}
+
+func TestNotModifiedOnlyGET(t *testing.T) {
+	engine := newTestEngine()
+	POST(engine, "/orders/:id", func() HandlerResponse[testOrderRequest] {
+		return HandlerResponse[testOrderRequest]{
+			ETag: ETAG_STRONG,
+			Service: func(ctx *Context[testOrderRequest]) (interface{}, Error) {
+				ctx.SetETag("1")
+				return &testOrder{ID: ctx.Request.ID}, nil
+			},
+		}
+	})
+	if w := serve(engine, "POST", "/orders/1", "", map[string]string{"If-None-Match": `"1"`}); w.Code != 200 {
+		t.Errorf("status %d of a POST, want 200", w.Code)
+	}
+}
+
+func TestCheckPrecondition(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	engine := newTestEngine()
+	PUT(engine, "/orders/:id", func() HandlerResponse[testOrderRequest] {
+		return HandlerResponse[testOrderRequest]{
+			Service: func(ctx *Context[testOrderRequest]) (interface{}, Error) {
+				if err := ctx.CheckPrecondition("3", modified); err != nil {
+					return nil, err
+				}
+				return nil, nil
+			},
+		}
+	})
+
+	for _, test := range []struct {
+		headers map[string]string
+		fails   bool
+	}{
+		{nil, false},
+		{map[string]string{"If-Match": `"3"`}, false},
+		{map[string]string{"If-Match": `"1", "3"`}, false},
+		{map[string]string{"If-Match": "*"}, false},
+		{map[string]string{"If-Match": `"2"`}, true},
+		{map[string]string{"If-Match": `W/"3"`}, true},
+		{map[string]string{"If-Unmodified-Since": modified.Format(http.TimeFormat)}, false},
+		{map[string]string{"If-Unmodified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, true},
+		// If-Unmodified-Since is ignored with If-Match
+		{map[string]string{"If-Match": `"3"`, "If-Unmodified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, false},
+	} {
+		w := serve(engine, "PUT", "/orders/1", "", test.headers)
+		resp := decodeResponse(t, w.Body.Bytes(), nil)
+		if failed := resp.Error != nil && resp.Error.Code == ERR_CODE_PRECONDITION_FAILED; failed != test.fails {
+			t.Errorf("%v: %s, want failed %v", test.headers, w.Body, test.fails)
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("%v: status %d, want the error sent with 200", test.headers, w.Code)
+		}
+	}
+}
+
+func TestCheckPreconditionMock(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, test := range []struct {
+		name         string
+		headers      map[string]string
+		etag         string
+		lastModified time.Time
+		fails        bool
+	}{
+		{"no condition", nil, "3", modified, false},
+		{"version matched", map[string]string{"If-Match": `"3"`}, "3", modified, false},
+		{"quoted etag matched", map[string]string{"If-Match": `"abc"`}, `"abc"`, modified, false},
+		{"version changed", map[string]string{"If-Match": `"2"`}, "3", modified, true},
+		{"no etag", map[string]string{"If-Match": "*"}, "", modified, true},
+		{"unmodified", map[string]string{"If-Unmodified-Since": modified.Format(http.TimeFormat)}, "3", modified.Add(time.Millisecond), false},
+		{"modified", map[string]string{"If-Unmodified-Since": modified.Format(http.TimeFormat)}, "3", modified.Add(time.Second), true},
+		{"unknown modified time", map[string]string{"If-Unmodified-Since": modified.Format(http.TimeFormat)}, "3", time.Time{}, false},
+		{"invalid date", map[string]string{"If-Unmodified-Since": "yesterday"}, "3", modified, false},
+	} {
+		ctx := NewMockContext(MockContextParams[testOrderRequest]{Method: "PUT", Path: "/orders/1", Headers: test.headers})
+		err := ctx.CheckPrecondition(test.etag, test.lastModified)
+		if failed := err != nil && err.Code() == ERR_CODE_PRECONDITION_FAILED; failed != test.fails || (err != nil && !failed) {
+			t.Errorf("%s: %v, want failed %v", test.name, err, test.fails)
+		}
+	}
+}
+
+func TestETagOf(t *testing.T) {
+	engine := etagEngine(ETAG_WEAK)
+	w := serve(engine, "GET", "/orders/1", "", nil)
+	if etag := ETagOf(&testOrder{ID: 1, Status: "paid"}); "W/"+etag != w.Header().Get("ETag") {
+		t.Errorf("ETagOf = %s, want the weak ETag %s without W/", etag, w.Header().Get("ETag"))
+	}
+}
@@ -4,9 +4,56 @@ const (
 	tag_uri  = "uri"
 	tag_json = "json"
 	tag_form = "form"
+	tag_map  = "map"
+
+	tag_header  = "header"
+	tag_cookie  = "cookie"
+	tag_maxsize = "maxsize"
 )
 
 const (
 	MICRO_HEADER_TRACE_ID = "Micro-TraceID"
 	MICRO_HEADER_TRACES   = "Micro-Traces"
+	MICRO_HEADER_DEADLINE = "Micro-Deadline" // the deadline of the caller in RFC3339Nano, the callee stops by it
+
+	// These headers carry the envelope of the responses whose body only holds the data, e.g. protobuf
+	MICRO_HEADER_SUCCESS    = "Micro-Success"
+	MICRO_HEADER_PAGINATION = "Micro-Pagination"
+	MICRO_HEADER_CURSOR     = "Micro-Cursor"
+)
+
+// These are the framework related error code and message
+const (
+	ERR_CODE_FILE_TOO_LARGE         = "5b4ba8f6-2a53-4f5e-8d0a-6f0d1b4c6e21"
+	ERR_CODE_NOT_FOUND              = "0e7c4f1a-93b2-4d1e-b6a8-2f5c7d9e1b34"
+	ERR_CODE_DATABASE               = "c3a1d8e2-6f4b-4a7c-9e15-8b2d0f6a4c97"
+	ERR_CODE_CONFLICT               = "7f2e9b64-1c5d-4a38-b0e7-d94a6c2f8e15"
+	ERR_CODE_INVALID_CURSOR         = "a6d03c1e-58f9-4b72-8e4d-3f1b9c7a2d60"
+	ERR_CODE_TOO_MANY_REQUESTS      = "e41b7c9a-2d63-4f8e-9a05-6c3d1f7b8e24"
+	ERR_CODE_PRECONDITION_FAILED    = "3c8f5a17-b94e-4d26-8a1f-72e0d6b9c453"
+	ERR_CODE_IDEMPOTENCY_IN_FLIGHT  = "9d2b6e48-0a7f-4c13-b5e9-1f84c3a7d6b2"
+	ERR_CODE_IDEMPOTENCY_KEY_REUSED = "f06a3d91-7c2e-4b85-9e4a-5b1d8c0f2e67"
+	ERR_CODE_TIMEOUT                = "b7e41f05-6a2d-4c98-83b1-0d5f9e2a7c36"
+	ERR_CODE_INTERNAL               = "2a9c7e13-d58b-4f06-b3e2-6c4a1f8d9b70"
+	ERR_CODE_INVALID_REQUEST        = "64e0b8d2-3f71-4a95-b8c6-9d2e5a1f7c03"
+	ERR_CODE_NOT_ACCEPTABLE         = "c85e2a4f-9b13-4d07-a6f8-3e7b0d1c5a92"
+	ERR_MSG_FILE_TOO_LARGE          = "File too large"
+	ERR_MSG_NOT_FOUND               = "Not found"
+	ERR_MSG_DATABASE                = "Database error"
+	ERR_MSG_CONFLICT                = "The data has been modified by others"
+	ERR_MSG_INVALID_CURSOR          = "Invalid cursor"
+	ERR_MSG_TOO_MANY_REQUESTS       = "Too many requests"
+	ERR_MSG_PRECONDITION_FAILED     = "The data has been modified since it was read"
+	ERR_MSG_IDEMPOTENCY_IN_FLIGHT   = "A request with the same Idempotency-Key is in progress"
+	ERR_MSG_IDEMPOTENCY_KEY_REUSED  = "The Idempotency-Key has been used by another request"
+	ERR_MSG_TIMEOUT                 = "Request timeout"
+	ERR_MSG_INTERNAL                = "Internal server error"
+	ERR_MSG_INVALID_REQUEST         = "Invalid request"
+	ERR_MSG_NOT_ACCEPTABLE          = "None of the accepted encodings is supported"
+)
+
+// These are the modes of HandlerResponse.ETag
+const (
+	ETAG_STRONG = "strong" // the responses with the same data are byte for byte the same
+	ETAG_WEAK   = "weak"   // the responses with the same data are equivalent, e.g. the same data in different encodings
 )
@@ -1,11 +1,22 @@
 package micro
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/ginger-go/micro/plugins/midware"
 	"github.com/ginger-go/sql"
+	"gorm.io/gorm"
 )
 
 type Trace struct {
@@ -14,6 +25,7 @@ type Trace struct {
 	SystemID   string         `json:"system_id"`
 	SystemName string         `json:"system_name"`
 	TraceID    string         `json:"trace_id"`
+	Instance   string         `json:"instance,omitempty"` // the endpoint called, recorded by apicall
 	Error      *ResponseError `json:"error,omitempty"`
 }
 
@@ -22,19 +34,44 @@ type Context[T any] struct {
 	TraceID    string
 	Request    *T
 	Page       *sql.Pagination
+	Cursor     *Cursor // the cursor of the request, set it to the cursor of the page in the response
 	Sort       *sql.Sort
+	Fields     FieldMask // the fields present in the request, set if HandlerResponse.FieldMask is enabled
 	Response   interface{}
+
+	db          *gorm.DB
+	afterCommit []func()
+	cacheStore  midware.CacheStore
+
+	etag           string
+	lastModified   time.Time
+	idempotencyKey string // the Idempotency-Key claimed by the request
+	stdContext     context.Context
 }
 
 type MockContextParams[T any] struct {
 	Request   *T
 	Page      *sql.Pagination
+	Cursor    *Cursor
 	Sort      *sql.Sort
+	Fields    FieldMask
+	DB        *gorm.DB
+	Actor     string // the caller stamped in CreatedBy and UpdatedBy of DB
 	Method    string
 	Path      string
 	ClientIP  string
 	UserAgent string
 	Headers   map[string]string
+	Cookies   map[string]string
+	Form      map[string]string     // sent as a multipart form if there are files, otherwise url encoded
+	Files     map[string][]MockFile // sent as a multipart form
+	Bind      bool                  // bind the Request from the mock request as a real request does
+}
+
+// MockFile is a file uploaded in the mock context
+type MockFile struct {
+	Filename string
+	Content  []byte
 }
 
 func NewMockContext[T any](param MockContextParams[T]) *Context[T] {
@@ -47,7 +84,11 @@ func NewMockContext[T any](param MockContextParams[T]) *Context[T] {
 	if param.Path == "" {
 		param.Path = "/"
 	}
-	ctx.Request = httptest.NewRequest(param.Method, param.Path, nil)
+	body, contentType := mockBody(param.Form, param.Files)
+	ctx.Request = httptest.NewRequest(param.Method, param.Path, body)
+	if contentType != "" {
+		ctx.Request.Header.Set("Content-Type", contentType)
+	}
 	if param.ClientIP != "" {
 		ctx.Request.RemoteAddr = param.ClientIP
 	}
@@ -62,13 +103,69 @@ func NewMockContext[T any](param MockContextParams[T]) *Context[T] {
 			ctx.Request.Header.Set(k, v)
 		}
 	}
+	for name, value := range param.Cookies {
+		ctx.Request.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
 
-	return &Context[T]{
+	mock := &Context[T]{
 		GinContext: ctx,
 		Request:    param.Request,
 		Page:       param.Page,
+		Cursor:     param.Cursor,
 		Sort:       param.Sort,
+		Fields:     param.Fields,
+		db:         param.DB,
+	}
+	if param.DB != nil && param.Actor != "" {
+		mock.db = WithActor(param.DB, param.Actor)
+	}
+	if param.Bind {
+		mock.Request, mock.Fields, _ = bindRequest[T](ctx, true)
+	}
+	return mock
+}
+
+func mockBody(form map[string]string, files map[string][]MockFile) (io.Reader, string) {
+	if len(files) == 0 {
+		if len(form) == 0 {
+			return nil, ""
+		}
+		values := url.Values{}
+		for k, v := range form {
+			values.Set(k, v)
+		}
+		return strings.NewReader(values.Encode()), binding.MIMEPOSTForm
+	}
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	for k, v := range form {
+		writer.WriteField(k, v)
 	}
+	for field, list := range files {
+		for _, file := range list {
+			part, err := writer.CreateFormFile(field, file.Filename)
+			if err != nil {
+				continue
+			}
+			part.Write(file.Content)
+		}
+	}
+	writer.Close()
+	return body, writer.FormDataContentType()
+}
+
+// Tracer is implemented by Context, the generated clients thread the trace of the request with it
+type Tracer interface {
+	Trace() (traceID string, traces []Trace)
+}
+
+// Trace returns the trace id and the traces of the request
+func (ctx *Context[T]) Trace() (string, []Trace) {
+	if ctx.GinContext == nil || ctx.GinContext.Request == nil {
+		return ctx.TraceID, make([]Trace, 0)
+	}
+	return ctx.TraceID, GetTraces(ctx.GinContext)
 }
 
 func (ctx *Context[T]) ClientIP() string {
@@ -79,6 +176,18 @@ func (ctx *Context[T]) UserAgent() string {
 	return ctx.GinContext.Request.UserAgent()
 }
 
+func (ctx *Context[T]) Header(key string) string {
+	return ctx.GinContext.GetHeader(key)
+}
+
+func (ctx *Context[T]) Cookie(name string) (string, error) {
+	return ctx.GinContext.Cookie(name)
+}
+
+func (ctx *Context[T]) FormFile(name string) (*multipart.FileHeader, error) {
+	return ctx.GinContext.FormFile(name)
+}
+
 func (ctx *Context[T]) OK(data interface{}, traceID string, traces []Trace, page ...*sql.Pagination) {
 	var p *sql.Pagination
 	if len(page) > 0 {
@@ -88,11 +197,12 @@ func (ctx *Context[T]) OK(data interface{}, traceID string, traces []Trace, page
 		Success:    true,
 		Data:       data,
 		Pagination: p,
+		Cursor:     ctx.Cursor,
 		TraceID:    traceID,
 		Traces:     traces,
 	}
 	ctx.Response = resp // for testing
-	ctx.GinContext.JSON(200, resp)
+	renderResponse(ctx.GinContext, 200, resp)
 }
 
 func (ctx *Context[T]) Error(err Error, traceID string, traces []Trace) {
@@ -106,5 +216,18 @@ func (ctx *Context[T]) Error(err Error, traceID string, traces []Trace) {
 		Traces:  traces,
 	}
 	ctx.Response = resp // for testing
-	ctx.GinContext.JSON(200, resp)
+	// the errors are sent with 200, so the cache of GETWithCache is told
+	midware.SkipCache(ctx.GinContext)
+	renderResponse(ctx.GinContext, 200, resp)
+}
+
+// Result write the result without the Response envelope, the trace id and the traces are sent in the headers
+func (ctx *Context[T]) Result(result Result, traceID string, traces []Trace) {
+	ctx.Response = result // for testing
+	// the results are not the envelope, e.g. a file or a stream, so they are not cached by GETWithCache
+	midware.SkipCache(ctx.GinContext)
+	ctx.GinContext.Header(MICRO_HEADER_TRACE_ID, traceID)
+	b, _ := json.Marshal(traces)
+	ctx.GinContext.Header(MICRO_HEADER_TRACES, string(b))
+	result.render(ctx.GinContext)
 }
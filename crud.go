@@ -0,0 +1,298 @@
+package micro
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ginger-go/sql"
+	"gorm.io/gorm"
+)
+
+type CRUDOperation string
+
+const (
+	CRUD_LIST   CRUDOperation = "list"
+	CRUD_GET    CRUDOperation = "get"
+	CRUD_CREATE CRUDOperation = "create"
+	CRUD_UPDATE CRUDOperation = "update"
+	CRUD_DELETE CRUDOperation = "delete"
+)
+
+// CRUDListRequest is the request of the list route, the filters are read from the query
+type CRUDListRequest struct{}
+
+// CRUDIDRequest is the request of the get and delete routes
+type CRUDIDRequest struct {
+	ID uint `uri:"id"`
+}
+
+// CRUDConfig is the setting of the routes registered by CRUD
+// Entity is the gorm model, DTO is the response, CreateReq and UpdateReq are the requests of create and update
+type CRUDConfig[Entity any, DTO any, CreateReq any, UpdateReq any] struct {
+	DB         *gorm.DB                // default Engine.DB, create, update and delete run in a transaction of it
+	Repository *BaseRepository[Entity] // default &BaseRepository[Entity]{}
+	Mapper     *BaseMapper[DTO]        // default &BaseMapper[DTO]{}
+	Filters    []string                // the query params allowed to filter the list, matched by equality on the column of the same name in its type
+	Disabled   []CRUDOperation         // the operations not registered
+	Middleware map[CRUDOperation][]gin.HandlerFunc
+
+	BeforeList   func(ctx *Context[CRUDListRequest], clause *sql.Clause) (*sql.Clause, Error)
+	AfterList    func(ctx *Context[CRUDListRequest], entities []Entity) Error
+	AfterGet     func(ctx *Context[CRUDIDRequest], entity *Entity) Error
+	BeforeCreate func(ctx *Context[CreateReq], entity *Entity) Error
+	AfterCreate  func(ctx *Context[CreateReq], entity *Entity) Error
+	BeforeUpdate func(ctx *Context[UpdateReq], entity *Entity) Error
+	AfterUpdate  func(ctx *Context[UpdateReq], entity *Entity) Error
+	BeforeDelete func(ctx *Context[CRUDIDRequest], entity *Entity) Error
+	AfterDelete  func(ctx *Context[CRUDIDRequest], entity *Entity) Error
+}
+
+// CRUD register the list, get, create, update and delete routes of the entity
+//
+//	GET    {route}      list with the filters, pagination and sort
+//	GET    {route}/:id  get by id
+//	POST   {route}      create from CreateReq
+//	PUT    {route}/:id  update the fields present in UpdateReq
+//	DELETE {route}/:id  delete by id
+func CRUD[Entity any, DTO any, CreateReq any, UpdateReq any](engine *Engine, route string, config CRUDConfig[Entity, DTO, CreateReq, UpdateReq]) {
+	if config.Repository == nil {
+		config.Repository = &BaseRepository[Entity]{}
+	}
+	if config.Mapper == nil {
+		config.Mapper = &BaseMapper[DTO]{}
+	}
+	c := &config
+	idRoute := route + "/:id"
+	if c.enabled(CRUD_LIST) {
+		GET(engine, route, c.list, c.Middleware[CRUD_LIST]...)
+	}
+	if c.enabled(CRUD_GET) {
+		GET(engine, idRoute, c.get, c.Middleware[CRUD_GET]...)
+	}
+	if c.enabled(CRUD_CREATE) {
+		POST(engine, route, c.create, c.Middleware[CRUD_CREATE]...)
+	}
+	if c.enabled(CRUD_UPDATE) {
+		PUT(engine, idRoute, c.update, c.Middleware[CRUD_UPDATE]...)
+	}
+	if c.enabled(CRUD_DELETE) {
+		DELETE(engine, idRoute, c.delete, c.Middleware[CRUD_DELETE]...)
+	}
+}
+
+func (c *CRUDConfig[Entity, DTO, CreateReq, UpdateReq]) enabled(op CRUDOperation) bool {
+	for _, disabled := range c.Disabled {
+		if disabled == op {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *CRUDConfig[Entity, DTO, CreateReq, UpdateReq]) list() HandlerResponse[CRUDListRequest] {
+	return HandlerResponse[CRUDListRequest]{
+		DB:         c.DB,
+		Response:   []DTO{},
+		Pagination: true,
+		Sort:       true,
+		Service: func(ctx *Context[CRUDListRequest]) (interface{}, Error) {
+			clauses := make([]*sql.Clause, 0)
+			for _, filter := range c.Filters {
+				if value, ok := ctx.GinContext.GetQuery(filter); ok {
+					typed, err := filterValue[Entity](ctx.DB(), filter, value)
+					if err != nil {
+						return nil, NewError(ERR_CODE_INVALID_REQUEST)
+					}
+					clauses = append(clauses, sql.Eq(filter, typed))
+				}
+			}
+			var clause *sql.Clause
+			if len(clauses) > 0 {
+				clause = sql.And(clauses...)
+			}
+			if c.BeforeList != nil {
+				var err Error
+				if clause, err = c.BeforeList(ctx, clause); err != nil {
+					return nil, err
+				}
+			}
+			entities, page, err := c.Repository.FindAllComplex(ctx.DB(), clause, ctx.Sort, ctx.Page)
+			if err != nil {
+				return nil, NewError(ERR_CODE_DATABASE)
+			}
+			if page != nil {
+				ctx.Page = page
+			}
+			if c.AfterList != nil {
+				if err := c.AfterList(ctx, entities); err != nil {
+					return nil, err
+				}
+			}
+			return c.Mapper.Map2Models(entities), nil
+		},
+	}
+}
+
+func (c *CRUDConfig[Entity, DTO, CreateReq, UpdateReq]) get() HandlerResponse[CRUDIDRequest] {
+	return HandlerResponse[CRUDIDRequest]{
+		DB:       c.DB,
+		Response: *new(DTO),
+		Service: func(ctx *Context[CRUDIDRequest]) (interface{}, Error) {
+			entity, err := c.find(ctx.DB(), ctx.Request.ID)
+			if err != nil {
+				return nil, err
+			}
+			if c.AfterGet != nil {
+				if err := c.AfterGet(ctx, entity); err != nil {
+					return nil, err
+				}
+			}
+			return c.Mapper.Map2Model(entity), nil
+		},
+	}
+}
+
+func (c *CRUDConfig[Entity, DTO, CreateReq, UpdateReq]) create() HandlerResponse[CreateReq] {
+	return HandlerResponse[CreateReq]{
+		DB:          c.DB,
+		Response:    *new(DTO),
+		Transaction: true,
+		Service: func(ctx *Context[CreateReq]) (interface{}, Error) {
+			entity := Map2Model[Entity](ctx.Request)
+			if entity == nil {
+				entity = new(Entity)
+			}
+			if c.BeforeCreate != nil {
+				if err := c.BeforeCreate(ctx, entity); err != nil {
+					return nil, err
+				}
+			}
+			entity, err := c.Repository.Save(ctx.DB(), entity)
+			if err != nil {
+				return nil, databaseError(err)
+			}
+			if c.AfterCreate != nil {
+				if err := c.AfterCreate(ctx, entity); err != nil {
+					return nil, err
+				}
+			}
+			return c.Mapper.Map2Model(entity), nil
+		},
+	}
+}
+
+func (c *CRUDConfig[Entity, DTO, CreateReq, UpdateReq]) update() HandlerResponse[UpdateReq] {
+	return HandlerResponse[UpdateReq]{
+		DB:          c.DB,
+		Response:    *new(DTO),
+		FieldMask:   true,
+		Transaction: true,
+		Service: func(ctx *Context[UpdateReq]) (interface{}, Error) {
+			id, parseErr := strconv.ParseUint(ctx.GinContext.Param("id"), 10, 64)
+			if parseErr != nil {
+				return nil, NewError(ERR_CODE_NOT_FOUND)
+			}
+			entity, err := c.find(ctx.DB(), uint(id))
+			if err != nil {
+				return nil, err
+			}
+			fields := PatchModel(ctx.Request, entity, ctx.Fields)
+			if c.BeforeUpdate != nil {
+				if err := c.BeforeUpdate(ctx, entity); err != nil {
+					return nil, err
+				}
+			}
+			// the fields changed by the hook are not tracked, so the whole entity is saved then
+			if c.BeforeUpdate != nil {
+				fields = nil
+			}
+			entity, saveErr := c.Repository.Save(ctx.DB(), entity, fields)
+			if saveErr != nil {
+				return nil, databaseError(saveErr)
+			}
+			if c.AfterUpdate != nil {
+				if err := c.AfterUpdate(ctx, entity); err != nil {
+					return nil, err
+				}
+			}
+			return c.Mapper.Map2Model(entity), nil
+		},
+	}
+}
+
+func (c *CRUDConfig[Entity, DTO, CreateReq, UpdateReq]) delete() HandlerResponse[CRUDIDRequest] {
+	return HandlerResponse[CRUDIDRequest]{
+		DB:          c.DB,
+		Transaction: true,
+		Service: func(ctx *Context[CRUDIDRequest]) (interface{}, Error) {
+			entity, err := c.find(ctx.DB(), ctx.Request.ID)
+			if err != nil {
+				return nil, err
+			}
+			if c.BeforeDelete != nil {
+				if err := c.BeforeDelete(ctx, entity); err != nil {
+					return nil, err
+				}
+			}
+			if err := c.Repository.Delete(ctx.DB(), entity); err != nil {
+				return nil, NewError(ERR_CODE_DATABASE)
+			}
+			if c.AfterDelete != nil {
+				if err := c.AfterDelete(ctx, entity); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		},
+	}
+}
+
+func (c *CRUDConfig[Entity, DTO, CreateReq, UpdateReq]) find(db *gorm.DB, id uint) (*Entity, Error) {
+	entity, err := c.Repository.FindByID(db, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, NewError(ERR_CODE_NOT_FOUND)
+	}
+	if err != nil {
+		return nil, NewError(ERR_CODE_DATABASE)
+	}
+	return entity, nil
+}
+
+// filterValue convert the query value to the type of the column, so the booleans and the numbers match in every database
+// The value of an unknown column is kept as it is
+func filterValue[Entity any](db *gorm.DB, column string, value string) (interface{}, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(Entity)); err != nil {
+		return value, nil
+	}
+	field := stmt.Schema.LookUpField(column)
+	if field == nil {
+		return value, nil
+	}
+	t := field.FieldType
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(value, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(value, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(value, 64)
+	}
+	return value, nil
+}
+
+// databaseError returns the error as it is if it is a micro error, e.g. the conflict of a versioned repository,
+// otherwise the database error
+func databaseError(err error) Error {
+	if e, ok := err.(Error); ok {
+		return e
+	}
+	return NewError(ERR_CODE_DATABASE)
+}
@@ -0,0 +1,131 @@
+package micro
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type testTodo struct {
+	ID        uint `gorm:"primaryKey"`
+	Title     string
+	Done      bool
+	CreatedBy string
+	UpdatedBy string
+}
+
+type testTodoDTO struct {
+	ID    uint   `json:"id"`
+	Title string `json:"title"`
+	Done  bool   `json:"done"`
+}
+
+type testTodoRequest struct {
+	Title string `json:"title"`
+	Done  bool   `json:"done"`
+}
+
+func decodeResponse(t *testing.T, body []byte, data interface{}) Response {
+	t.Helper()
+	var resp Response
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("%v: %s", err, body)
+	}
+	if data != nil && resp.Data != nil {
+		b, _ := json.Marshal(resp.Data)
+		json.Unmarshal(b, data)
+	}
+	return resp
+}
+
+func TestCRUDWithConfigDB(t *testing.T) {
+	engineDB := newTestDB(t)
+	db := newTestDB(t)
+	db.AutoMigrate(&testTodo{})
+	engine := newTestEngine()
+	engine.UseDB(engineDB)
+	engine.Actor = func(c *gin.Context) string { return c.GetHeader("X-User") }
+	failCreate := false
+	CRUD(engine, "/todos", CRUDConfig[testTodo, testTodoDTO, testTodoRequest, testTodoRequest]{
+		DB:      db,
+		Filters: []string{"done"},
+		AfterCreate: func(ctx *Context[testTodoRequest], entity *testTodo) Error {
+			if failCreate {
+				return NewError(ERR_CODE_CONFLICT)
+			}
+			return nil
+		},
+	})
+
+	w := serve(engine, "POST", "/todos", `{"title":"write tests"}`, map[string]string{"X-User": "alice"})
+	var todo testTodoDTO
+	if resp := decodeResponse(t, w.Body.Bytes(), &todo); !resp.Success || todo.ID == 0 {
+		t.Fatalf("create: %s", w.Body)
+	}
+	stored := &testTodo{}
+	db.First(stored, todo.ID)
+	if stored.Title != "write tests" || stored.CreatedBy != "alice" {
+		t.Errorf("stored todo = %+v, want it created by alice in the config database", stored)
+	}
+
+	w = serve(engine, "PUT", "/todos/1", `{"done":true}`, map[string]string{"X-User": "bob"})
+	if resp := decodeResponse(t, w.Body.Bytes(), &todo); !resp.Success || !todo.Done || todo.Title != "write tests" {
+		t.Fatalf("update: %s", w.Body)
+	}
+	db.First(stored, todo.ID)
+	if !stored.Done || stored.UpdatedBy != "bob" {
+		t.Errorf("stored todo = %+v, want it updated by bob", stored)
+	}
+
+	// the write is rolled back with the transaction of the config database
+	failCreate = true
+	w = serve(engine, "POST", "/todos", `{"title":"rolled back"}`, nil)
+	if resp := decodeResponse(t, w.Body.Bytes(), nil); resp.Success {
+		t.Fatalf("create with the failing hook: %s", w.Body)
+	}
+	var count int64
+	db.Model(&testTodo{}).Count(&count)
+	if count != 1 {
+		t.Errorf("%d todos, want the failed create rolled back", count)
+	}
+
+	db.Create(&testTodo{Title: "not done"})
+	w = serve(engine, "GET", "/todos?done=true", "", nil)
+	var todos []testTodoDTO
+	if resp := decodeResponse(t, w.Body.Bytes(), &todos); !resp.Success || len(todos) != 1 || !todos[0].Done {
+		t.Fatalf("list filtered by done: %s", w.Body)
+	}
+	w = serve(engine, "GET", "/todos?done=maybe", "", nil)
+	if resp := decodeResponse(t, w.Body.Bytes(), nil); resp.Success || resp.Error.Code != ERR_CODE_INVALID_REQUEST {
+		t.Fatalf("list with an invalid filter: %s", w.Body)
+	}
+	// the query params out of Filters do not filter
+	w = serve(engine, "GET", "/todos?title=none", "", nil)
+	if resp := decodeResponse(t, w.Body.Bytes(), &todos); !resp.Success || len(todos) != 2 {
+		t.Fatalf("list with an unknown filter: %s", w.Body)
+	}
+
+	w = serve(engine, "DELETE", "/todos/1", "", nil)
+	if resp := decodeResponse(t, w.Body.Bytes(), nil); !resp.Success {
+		t.Fatalf("delete: %s", w.Body)
+	}
+	w = serve(engine, "GET", "/todos/1", "", nil)
+	if resp := decodeResponse(t, w.Body.Bytes(), nil); resp.Success || resp.Error.Code != ERR_CODE_NOT_FOUND {
+		t.Errorf("get of the deleted todo: %s", w.Body)
+	}
+}
+
+func TestContextTransactionWithoutDB(t *testing.T) {
+	ctx := NewMockContext[struct{}](MockContextParams[struct{}]{})
+	called := false
+	err := ctx.Transaction(func(tx *gorm.DB) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, gorm.ErrInvalidDB) || called {
+		t.Errorf("Transaction without a database: %v, called %v", err, called)
+	}
+}
@@ -0,0 +1,227 @@
+package micro
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/ginger-go/env"
+	"github.com/ginger-go/sql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const CURSOR_DEFAULT_SIZE = 20
+
+// CURSOR_MAX_SIZE is the max size of a cursor page, a larger size of the client is clamped to it
+var CURSOR_MAX_SIZE = env.Int("MICRO_CURSOR_MAX_SIZE", 100)
+
+// CURSOR_SECRET sign the cursors, so the clients can not forge the sort keys
+// Set MICRO_CURSOR_SECRET if the cursors are shared by the instances of the service, otherwise a random secret is used
+// and a warning is logged when a cursor route is registered
+var CURSOR_SECRET = func() []byte {
+	if secret := env.String("MICRO_CURSOR_SECRET", ""); secret != "" {
+		return []byte(secret)
+	}
+	rand.Read(randomCursorSecret)
+	return randomCursorSecret
+}()
+
+var (
+	randomCursorSecret = make([]byte, 32)
+	cursorSecretOnce   sync.Once
+)
+
+// warnCursorSecret log a warning once if the cursors are signed by the random secret of the process
+func warnCursorSecret() {
+	cursorSecretOnce.Do(func() {
+		if hmac.Equal(CURSOR_SECRET, randomCursorSecret) {
+			log.Println("Cursor: MICRO_CURSOR_SECRET is not set, the cursors are only valid on this instance until it restarts")
+		}
+	})
+}
+
+// Cursor is the cursor pagination, an alternative to sql.Pagination for the large tables
+// Token and Size are bound from the query, Next and Prev are sent in the response to get the next and the previous page
+type Cursor struct {
+	Token string `form:"cursor" json:"-"`
+	Size  int    `form:"size" json:"size"`
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+}
+
+// cursorPayload is the content of the cursor token
+type cursorPayload struct {
+	By       string            `json:"b,omitempty"`
+	Asc      bool              `json:"a,omitempty"`
+	Backward bool              `json:"r,omitempty"` // the page before the keys
+	Keys     []json.RawMessage `json:"k"`           // the sort key and the primary key
+}
+
+// FindAllByCursor find the page of the cursor, ordered by the sort and then the primary key as the tie-breaker
+// The sort column must not be null, and a cursor is only valid with the same sort, otherwise ERR_CODE_INVALID_CURSOR is returned
+func (r *BaseRepository[T]) FindAllByCursor(tx *gorm.DB, clause *sql.Clause, sort *sql.Sort, cursor *Cursor) ([]T, *Cursor, error) {
+	sch, err := r.schema(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields, asc, err := cursorFields(sch, sort)
+	if err != nil {
+		return nil, nil, err
+	}
+	size := CURSOR_DEFAULT_SIZE
+	if cursor != nil && cursor.Size > 0 {
+		size = cursor.Size
+	}
+	if CURSOR_MAX_SIZE > 0 && size > CURSOR_MAX_SIZE {
+		size = CURSOR_MAX_SIZE
+	}
+
+	var payload *cursorPayload
+	if cursor != nil && cursor.Token != "" {
+		payload, err = decodeCursor(cursor.Token)
+		if err != nil || payload.By != fields[0].DBName || payload.Asc != asc || len(payload.Keys) != len(fields) {
+			return nil, nil, NewError(ERR_CODE_INVALID_CURSOR)
+		}
+	}
+
+	backward := payload != nil && payload.Backward
+	if payload != nil {
+		keyClause, err := cursorClause(fields, payload.Keys, asc != backward)
+		if err != nil {
+			return nil, nil, NewError(ERR_CODE_INVALID_CURSOR)
+		}
+		if clause != nil {
+			keyClause = sql.And(clause, keyClause)
+		}
+		clause = keyClause
+	}
+
+	query := clause.Consume(tx)
+	for i, field := range fields {
+		if i > 0 && field == fields[0] {
+			continue
+		}
+		order := field.DBName
+		if asc == backward {
+			order += " DESC"
+		}
+		query = query.Order(order)
+	}
+	var entities []T
+	if err := query.Limit(size + 1).Find(&entities).Error; err != nil {
+		return nil, nil, err
+	}
+
+	more := len(entities) > size
+	if more {
+		entities = entities[:size]
+	}
+	if backward {
+		for i, j := 0, len(entities)-1; i < j; i, j = i+1, j-1 {
+			entities[i], entities[j] = entities[j], entities[i]
+		}
+	}
+
+	page := &Cursor{Size: size}
+	if len(entities) == 0 {
+		return entities, page, nil
+	}
+	if more || backward {
+		page.Next = encodeCursor(tx, fields, asc, false, &entities[len(entities)-1])
+	}
+	if (more && backward) || (payload != nil && !backward) {
+		page.Prev = encodeCursor(tx, fields, asc, true, &entities[0])
+	}
+	return entities, page, nil
+}
+
+// cursorFields returns the sort field and the primary key field
+func cursorFields(sch *schema.Schema, sort *sql.Sort) ([]*schema.Field, bool, error) {
+	primary := sch.PrioritizedPrimaryField
+	if primary == nil {
+		return nil, false, gorm.ErrPrimaryKeyRequired
+	}
+	if sort == nil || sort.By == "" {
+		return []*schema.Field{primary, primary}, true, nil
+	}
+	by, _, _ := strings.Cut(strings.TrimSpace(sort.By), " ")
+	field := sch.LookUpField(by)
+	if field == nil || field.DBName == "" {
+		return nil, false, NewError(ERR_CODE_INVALID_CURSOR)
+	}
+	return []*schema.Field{field, primary}, sort.Asc, nil
+}
+
+// cursorClause returns the clause of the rows after the keys, or before the keys if not forward
+//
+//	sort > key OR (sort = key AND id > id_key)
+func cursorClause(fields []*schema.Field, keys []json.RawMessage, forward bool) (*sql.Clause, error) {
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		value := reflect.New(field.FieldType)
+		if err := json.Unmarshal(keys[i], value.Interface()); err != nil {
+			return nil, err
+		}
+		values[i] = value.Elem().Interface()
+	}
+	beyond := sql.Gt
+	if !forward {
+		beyond = sql.Lt
+	}
+	if fields[0] == fields[1] {
+		return beyond(fields[1].DBName, values[1]), nil
+	}
+	return sql.Or(
+		beyond(fields[0].DBName, values[0]),
+		sql.And(sql.Eq(fields[0].DBName, values[0]), beyond(fields[1].DBName, values[1])),
+	), nil
+}
+
+func encodeCursor[T any](tx *gorm.DB, fields []*schema.Field, asc bool, backward bool, entity *T) string {
+	payload := cursorPayload{Asc: asc, Backward: backward}
+	payload.By = fields[0].DBName
+	val := reflect.ValueOf(entity).Elem()
+	for _, field := range fields {
+		value, _ := field.ValueOf(tx.Statement.Context, val)
+		b, _ := json.Marshal(value)
+		payload.Keys = append(payload.Keys, b)
+	}
+	b, _ := json.Marshal(payload)
+	return base64.RawURLEncoding.EncodeToString(b) + "." + base64.RawURLEncoding.EncodeToString(signCursor(b))
+}
+
+func decodeCursor(token string) (*cursorPayload, error) {
+	data, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, NewError(ERR_CODE_INVALID_CURSOR)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	s, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(s, signCursor(b)) {
+		return nil, NewError(ERR_CODE_INVALID_CURSOR)
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(b, &payload); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+func signCursor(b []byte) []byte {
+	mac := hmac.New(sha256.New, CURSOR_SECRET)
+	mac.Write(b)
+	return mac.Sum(nil)
+}
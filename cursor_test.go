@@ -0,0 +1,101 @@
+package micro
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ginger-go/sql"
+)
+
+type testEvent struct {
+	ID   uint `gorm:"primaryKey"`
+	Rank int
+}
+
+func TestFindAllByCursor(t *testing.T) {
+	db := newTestDB(t)
+	db.AutoMigrate(&testEvent{})
+	for i := 1; i <= 7; i++ {
+		db.Create(&testEvent{Rank: i % 3}) // ties are broken by the id
+	}
+	repo := &BaseRepository[testEvent]{}
+	sort := &sql.Sort{By: "rank", Asc: true}
+
+	ids := func(events []testEvent) string {
+		s := make([]string, len(events))
+		for i, e := range events {
+			s[i] = fmt.Sprint(e.ID)
+		}
+		return strings.Join(s, ",")
+	}
+
+	var pages []string
+	cursor := &Cursor{Size: 3}
+	for {
+		events, page, err := repo.FindAllByCursor(db, nil, sort, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, ids(events))
+		if page.Next == "" {
+			break
+		}
+		cursor = &Cursor{Token: page.Next, Size: 3}
+	}
+	if got := strings.Join(pages, " | "); got != "3,6,1 | 4,7,2 | 5" {
+		t.Errorf("pages = %s", got)
+	}
+
+	// the previous page of the second one is the first one
+	_, second, _ := repo.FindAllByCursor(db, nil, sort, &Cursor{Size: 3})
+	events, page, _ := repo.FindAllByCursor(db, nil, sort, &Cursor{Token: second.Next, Size: 3})
+	events, _, err := repo.FindAllByCursor(db, nil, sort, &Cursor{Token: page.Prev, Size: 3})
+	if err != nil || ids(events) != "3,6,1" {
+		t.Errorf("previous page = %s, %v", ids(events), err)
+	}
+
+	// the cursor is only valid with its sort
+	_, _, err = repo.FindAllByCursor(db, nil, &sql.Sort{By: "rank"}, &Cursor{Token: second.Next})
+	if e, ok := err.(Error); !ok || e.Code() != ERR_CODE_INVALID_CURSOR {
+		t.Errorf("cursor with another sort: %v, want ERR_CODE_INVALID_CURSOR", err)
+	}
+	data, _, _ := strings.Cut(second.Next, ".")
+	_, _, err = repo.FindAllByCursor(db, nil, sort, &Cursor{Token: data + ".Zm9yZ2Vk"})
+	if e, ok := err.(Error); !ok || e.Code() != ERR_CODE_INVALID_CURSOR {
+		t.Errorf("forged cursor: %v, want ERR_CODE_INVALID_CURSOR", err)
+	}
+}
+
+func TestFindAllByCursorMaxSize(t *testing.T) {
+	db := newTestDB(t)
+	db.AutoMigrate(&testEvent{})
+	for i := 0; i < 5; i++ {
+		db.Create(&testEvent{})
+	}
+	defer func(max int) { CURSOR_MAX_SIZE = max }(CURSOR_MAX_SIZE)
+	CURSOR_MAX_SIZE = 2
+	events, page, err := (&BaseRepository[testEvent]{}).FindAllByCursor(db, nil, nil, &Cursor{Size: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || page.Size != 2 || page.Next == "" {
+		t.Errorf("%d events of size %d, want the size clamped to 2", len(events), page.Size)
+	}
+}
+
+func TestWarnCursorSecret(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	cursorSecretOnce = sync.Once{}
+	warnCursorSecret()
+	warnCursorSecret()
+	if n := strings.Count(buf.String(), "MICRO_CURSOR_SECRET"); n != 1 {
+		t.Errorf("warned %d times about the random secret, want once: %s", n, buf.String())
+	}
+}
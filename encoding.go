@@ -0,0 +1,164 @@
+package micro
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	MIME_JSON     = binding.MIMEJSON
+	MIME_MSGPACK  = binding.MIMEMSGPACK2
+	MIME_PROTOBUF = binding.MIMEPROTOBUF
+)
+
+// the same handle is used to encode and decode, so time.Time and strings round trip
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{WriteExt: true}
+	h.RawToString = true
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return h
+}()
+
+// Marshal encode v with the content type, json is used for the unknown content types
+func Marshal(contentType string, v interface{}) ([]byte, error) {
+	switch normalizeMIME(contentType) {
+	case MIME_MSGPACK:
+		var b []byte
+		err := codec.NewEncoderBytes(&b, msgpackHandle).Encode(v)
+		return b, err
+	case MIME_PROTOBUF:
+		m, ok := v.(proto.Message)
+		if !ok {
+			return nil, fmt.Errorf("marshal: %T is not a proto.Message", v)
+		}
+		return proto.Marshal(m)
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// Unmarshal decode data with the content type, json is used for the unknown content types
+func Unmarshal(contentType string, data []byte, v interface{}) error {
+	switch normalizeMIME(contentType) {
+	case MIME_MSGPACK:
+		return codec.NewDecoderBytes(data, msgpackHandle).Decode(v)
+	case MIME_PROTOBUF:
+		m, ok := v.(proto.Message)
+		if !ok {
+			return fmt.Errorf("unmarshal: %T is not a proto.Message", v)
+		}
+		return proto.Unmarshal(data, m)
+	default:
+		return json.NewDecoder(bytes.NewReader(data)).Decode(v)
+	}
+}
+
+// normalizeMIME strip the parameters and map the aliases to the MIME constants
+func normalizeMIME(contentType string) string {
+	mime, _, _ := strings.Cut(contentType, ";")
+	mime = strings.ToLower(strings.TrimSpace(mime))
+	switch mime {
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
+		return MIME_MSGPACK
+	case MIME_PROTOBUF, "application/protobuf":
+		return MIME_PROTOBUF
+	}
+	return mime
+}
+
+// negotiateEncoding pick the response encoding from the Accept header, the highest q wins and q=0 refuses the type
+// Protobuf is only picked if the data implements proto.Message, json is picked for the wildcards and the missing header
+// It returns "" if the client accepts none of the encodings
+func negotiateEncoding(c *gin.Context, data interface{}) string {
+	accept := c.GetHeader("Accept")
+	if accept == "" {
+		return MIME_JSON
+	}
+	best := ""
+	bestQ := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mime, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && k == "q" {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+		switch normalizeMIME(mime) {
+		case MIME_JSON, "*/*", "application/*":
+			best, bestQ = MIME_JSON, q
+		case MIME_MSGPACK:
+			best, bestQ = MIME_MSGPACK, q
+		case MIME_PROTOBUF:
+			if _, ok := data.(proto.Message); ok {
+				best, bestQ = MIME_PROTOBUF, q
+			} else if best == "" {
+				// the data that is not a proto.Message, e.g. an error, falls back to json, the other accepted types still win
+				best = MIME_JSON
+			}
+		}
+	}
+	return best
+}
+
+// renderResponse write the response envelope with the negotiated encoding
+// The protobuf body only holds the data, the rest of the envelope is sent in the headers
+// The client accepting none of the encodings gets ERR_CODE_NOT_ACCEPTABLE in json with 406
+func renderResponse(c *gin.Context, status int, resp *Response) {
+	c.Header("Vary", "Accept")
+	switch negotiateEncoding(c, resp.Data) {
+	case "":
+		err := NewError(ERR_CODE_NOT_ACCEPTABLE)
+		c.JSON(http.StatusNotAcceptable, &Response{
+			Success: false,
+			Error: &ResponseError{
+				Code:    err.Code(),
+				Message: err.Error(),
+			},
+			TraceID: resp.TraceID,
+			Traces:  resp.Traces,
+		})
+		return
+	case MIME_MSGPACK:
+		b, err := Marshal(MIME_MSGPACK, resp)
+		if err == nil {
+			c.Data(status, MIME_MSGPACK, b)
+			return
+		}
+	case MIME_PROTOBUF:
+		b, err := Marshal(MIME_PROTOBUF, resp.Data)
+		if err == nil {
+			c.Header(MICRO_HEADER_SUCCESS, strconv.FormatBool(resp.Success))
+			c.Header(MICRO_HEADER_TRACE_ID, resp.TraceID)
+			traces, _ := json.Marshal(resp.Traces)
+			c.Header(MICRO_HEADER_TRACES, string(traces))
+			if resp.Pagination != nil {
+				page, _ := json.Marshal(resp.Pagination)
+				c.Header(MICRO_HEADER_PAGINATION, string(page))
+			}
+			if resp.Cursor != nil {
+				cursor, _ := json.Marshal(resp.Cursor)
+				c.Header(MICRO_HEADER_CURSOR, string(cursor))
+			}
+			c.Data(status, MIME_PROTOBUF, b)
+			return
+		}
+	}
+	c.JSON(status, resp)
+}
@@ -0,0 +1,152 @@
+package micro
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type testEncoded struct {
+	Name  string    `json:"name" msgpack:"name"`
+	Tags  []string  `json:"tags" msgpack:"tags"`
+	Since time.Time `json:"since" msgpack:"since"`
+}
+
+func TestMarshal(t *testing.T) {
+	want := testEncoded{Name: "a", Tags: []string{"x"}, Since: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	for _, contentType := range []string{MIME_JSON, MIME_MSGPACK, "application/x-msgpack", "application/msgpack; charset=utf-8", "text/unknown"} {
+		b, err := Marshal(contentType, want)
+		if err != nil {
+			t.Fatalf("%s: %v", contentType, err)
+		}
+		var got testEncoded
+		if err := Unmarshal(contentType, b, &got); err != nil || got.Name != want.Name || len(got.Tags) != 1 || !got.Since.Equal(want.Since) {
+			t.Errorf("%s: %+v, %v", contentType, got, err)
+		}
+	}
+
+	b, err := Marshal("application/protobuf", wrapperspb.String("a"))
+	got := &wrapperspb.StringValue{}
+	if err != nil || Unmarshal(MIME_PROTOBUF, b, got) != nil || got.Value != "a" {
+		t.Errorf("protobuf: %v, %v", got, err)
+	}
+	if _, err := Marshal(MIME_PROTOBUF, want); err == nil {
+		t.Error("a struct that is not a proto.Message is marshalled in protobuf")
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	for _, test := range []struct {
+		accept string
+		data   interface{}
+		want   string
+	}{
+		{"", nil, MIME_JSON},
+		{"*/*", nil, MIME_JSON},
+		{"application/*", nil, MIME_JSON},
+		{MIME_MSGPACK, nil, MIME_MSGPACK},
+		{"application/x-msgpack", nil, MIME_MSGPACK},
+		{"application/msgpack, application/json;q=0.9", nil, MIME_MSGPACK},
+		{"application/json, application/msgpack", nil, MIME_JSON},
+		{"application/msgpack;q=0.1, application/json", nil, MIME_JSON},
+		{"text/html, */*;q=0.8", nil, MIME_JSON},
+		{MIME_PROTOBUF, wrapperspb.String("a"), MIME_PROTOBUF},
+		{MIME_PROTOBUF + ", application/json;q=0.9", testEncoded{}, MIME_JSON},
+		{MIME_PROTOBUF + ", application/msgpack;q=0.9", testEncoded{}, MIME_MSGPACK},
+		{MIME_PROTOBUF, nil, MIME_JSON},
+		{"text/html", nil, ""},
+		{"application/json;q=0", nil, ""},
+		{"application/msgpack;q=0, text/plain", nil, ""},
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header.Set("Accept", test.accept)
+		if got := negotiateEncoding(c, test.data); got != test.want {
+			t.Errorf("negotiateEncoding(%q, %T) = %q, want %q", test.accept, test.data, got, test.want)
+		}
+	}
+}
+
+type testEncodedRequest struct {
+	Name string   `json:"name" msgpack:"name"`
+	Tags []string `json:"tags" msgpack:"tags"`
+}
+
+func encodingEngine() *Engine {
+	engine := newTestEngine()
+	POST(engine, "/echo", func() HandlerResponse[testEncodedRequest] {
+		return HandlerResponse[testEncodedRequest]{
+			Service: func(ctx *Context[testEncodedRequest]) (interface{}, Error) {
+				if ctx.Request.Name == "proto" {
+					return wrapperspb.String(strings.Join(ctx.Request.Tags, ",")), nil
+				}
+				return ctx.Request, nil
+			},
+		}
+	})
+	return engine
+}
+
+func serveEncoded(engine *Engine, contentType string, body []byte, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/echo", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	engine.GinEngine.ServeHTTP(w, req)
+	return w
+}
+
+func TestEncodingMsgpack(t *testing.T) {
+	body, _ := Marshal(MIME_MSGPACK, testEncodedRequest{Name: "a", Tags: []string{"x", "y"}})
+	w := serveEncoded(encodingEngine(), MIME_MSGPACK, body, MIME_MSGPACK)
+	if ct := w.Header().Get("Content-Type"); ct != MIME_MSGPACK || w.Header().Get("Vary") != "Accept" {
+		t.Fatalf("Content-Type %q, Vary %q", ct, w.Header().Get("Vary"))
+	}
+	var resp Response
+	if err := Unmarshal(MIME_MSGPACK, w.Body.Bytes(), &resp); err != nil || !resp.Success || resp.TraceID == "" || len(resp.Traces) != 1 {
+		t.Fatalf("the msgpack envelope: %+v, %v", resp, err)
+	}
+	data := resp.Data.(map[string]interface{})
+	if data["name"] != "a" || len(data["tags"].([]interface{})) != 2 {
+		t.Errorf("the msgpack data: %+v", data)
+	}
+}
+
+func TestEncodingProtobuf(t *testing.T) {
+	body, _ := Marshal(MIME_JSON, testEncodedRequest{Name: "proto", Tags: []string{"x", "y"}})
+	w := serveEncoded(encodingEngine(), MIME_JSON, body, MIME_PROTOBUF)
+	if ct := w.Header().Get("Content-Type"); ct != MIME_PROTOBUF {
+		t.Fatalf("Content-Type %q, want protobuf", ct)
+	}
+	got := &wrapperspb.StringValue{}
+	if err := proto.Unmarshal(w.Body.Bytes(), got); err != nil || got.Value != "x,y" {
+		t.Errorf("the protobuf data: %v, %v", got, err)
+	}
+	if w.Header().Get(MICRO_HEADER_SUCCESS) != "true" || w.Header().Get(MICRO_HEADER_TRACE_ID) == "" || w.Header().Get(MICRO_HEADER_TRACES) == "" {
+		t.Errorf("the envelope headers: %v", w.Header())
+	}
+
+	// the data that is not a proto.Message is sent in json
+	body, _ = Marshal(MIME_JSON, testEncodedRequest{Name: "a"})
+	w = serveEncoded(encodingEngine(), MIME_JSON, body, MIME_PROTOBUF)
+	if resp := decodeResponse(t, w.Body.Bytes(), nil); !resp.Success || !strings.HasPrefix(w.Header().Get("Content-Type"), MIME_JSON) {
+		t.Errorf("the fallback: %q %s", w.Header().Get("Content-Type"), w.Body)
+	}
+}
+
+func TestEncodingNotAcceptable(t *testing.T) {
+	body, _ := Marshal(MIME_JSON, testEncodedRequest{Name: "a"})
+	w := serveEncoded(encodingEngine(), MIME_JSON, body, "text/html")
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("status %d, want 406", w.Code)
+	}
+	if resp := decodeResponse(t, w.Body.Bytes(), nil); resp.Success || resp.Error == nil || resp.Error.Code != ERR_CODE_NOT_ACCEPTABLE || resp.TraceID == "" {
+		t.Errorf("the 406 envelope: %s", w.Body)
+	}
+}
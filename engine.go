@@ -1,6 +1,7 @@
 package micro
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"net/http"
 	"time"
@@ -11,26 +12,52 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/robfig/cron"
+	"gorm.io/gorm"
 )
 
 type Engine struct {
-	GinEngine  *gin.Engine
-	CronWorker *cron.Cron
-	SystemID   string
-	SystemName string
+	GinEngine        *gin.Engine
+	CronWorker       *cron.Cron
+	JobStore         JobStore
+	DB               *gorm.DB
+	SystemID         string
+	SystemName       string
+	Actor            func(c *gin.Context) string // resolve the caller stamped in CreatedBy and UpdatedBy, e.g. set by the auth plugin
+	CacheStore       midware.CacheStore          // the responses of GETWithCache, shared by the routes, default in memory
+	IdempotencyStore IdempotencyStore            // the Idempotency-Keys of the Idempotent handlers, default in memory
+	Timeout          time.Duration               // the default cooperative timeout of the services, no timeout by default, see Context.Deadline
+	CrashLogger      func(crash Crash)           // log the panics of the requests, default the standard logger, e.g. set by the logger plugin
+	CrashReporter    CrashReporter               // report the panics of the requests, e.g. to an error tracker
+
+	queues      map[string]*jobQueue
+	jobsStarted bool
+	routes      []RouteInfo
+	routeTypes  routeTypes
 }
 
+// NewEngine returns the engine, the proxies in TRUSTED_PROXIES are trusted to forward the client IP in CLIENT_IP_HEADERS
+// The panics of the requests are recovered by Recovery
 func NewEngine(systemID, systemName string) *Engine {
-	return &Engine{
-		GinEngine:  gin.Default(),
-		CronWorker: cron.New(),
-		SystemID:   systemID,
-		SystemName: systemName,
+	engine := &Engine{
+		GinEngine:        gin.New(),
+		CronWorker:       cron.New(),
+		JobStore:         NewMemoryJobStore(),
+		CacheStore:       midware.NewMemoryCacheStore(),
+		IdempotencyStore: NewMemoryIdempotencyStore(),
+		SystemID:         systemID,
+		SystemName:       systemName,
+		queues:           make(map[string]*jobQueue),
+	}
+	engine.GinEngine.Use(gin.Logger(), Recovery(engine))
+	if err := engine.SetTrustedProxies(TRUSTED_PROXIES, CLIENT_IP_HEADERS...); err != nil {
+		panic("MICRO_TRUSTED_PROXIES is invalid: " + err.Error())
 	}
+	return engine
 }
 
 func (e *Engine) Run(addr string) {
 	e.CronWorker.Start()
+	e.startJobWorkers()
 	e.GinEngine.GET("/micro/info", MicroInfoHandler(e))
 	e.GinEngine.Run(addr)
 }
@@ -40,8 +67,28 @@ func (e *Engine) RunServerOnly(addr string) {
 	e.GinEngine.Run(addr)
 }
 
+// RunTLS serve https with the tls config, e.g. the mutual TLS config of the trust plugin verifying the client certificates
+func (e *Engine) RunTLS(addr string, config *tls.Config) error {
+	e.CronWorker.Start()
+	e.startJobWorkers()
+	e.GinEngine.GET("/micro/info", MicroInfoHandler(e))
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   e.GinEngine.Handler(),
+		TLSConfig: config,
+	}
+	return server.ListenAndServeTLS("", "")
+}
+
+// ServeRoutes serve the metadata of the routes at /micro/routes for `micro gen client`, behind the middleware
+// It is not served by default since the metadata shows the internals of the service, guard it, e.g. with trust.CallerOnly()
+func (e *Engine) ServeRoutes(middleware ...gin.HandlerFunc) {
+	e.GinEngine.GET("/micro/routes", joinMiddlewareAndService(MicroRoutesHandler(e), middleware...)...)
+}
+
 func (e *Engine) RunCronOnly() {
 	e.CronWorker.Start()
+	e.startJobWorkers()
 }
 
 func (e *Engine) Use(middleware ...gin.HandlerFunc) {
@@ -49,23 +96,29 @@ func (e *Engine) Use(middleware ...gin.HandlerFunc) {
 }
 
 func GET[T any](engine *Engine, route string, handler Handler[T], middleware ...gin.HandlerFunc) {
+	addRoute(engine, "GET", route, handler)
 	engine.GinEngine.GET(route, joinMiddlewareAndService(newGinServiceHandler(engine, handler), middleware...)...)
 }
 
+// GETWithCache cache the successful responses of the handler for the duration, see CacheConfig
 func GETWithCache[T any](engine *Engine, route string, cacheDuration time.Duration, handler Handler[T], middleware ...gin.HandlerFunc) {
+	addRoute(engine, "GET", route, handler)
 	engine.GinEngine.GET(route, joinMiddlewareAndService(
-		midware.Cache(cacheDuration, newGinServiceHandler(engine, handler)), middleware...)...)
+		cacheWith(engine, cacheDuration, handler(), newGinServiceHandler(engine, handler)), middleware...)...)
 }
 
 func POST[T any](engine *Engine, route string, handler Handler[T], middleware ...gin.HandlerFunc) {
+	addRoute(engine, "POST", route, handler)
 	engine.GinEngine.POST(route, joinMiddlewareAndService(newGinServiceHandler(engine, handler), middleware...)...)
 }
 
 func PUT[T any](engine *Engine, route string, handler Handler[T], middleware ...gin.HandlerFunc) {
+	addRoute(engine, "PUT", route, handler)
 	engine.GinEngine.PUT(route, joinMiddlewareAndService(newGinServiceHandler(engine, handler), middleware...)...)
 }
 
 func DELETE[T any](engine *Engine, route string, handler Handler[T], middleware ...gin.HandlerFunc) {
+	addRoute(engine, "DELETE", route, handler)
 	engine.GinEngine.DELETE(route, joinMiddlewareAndService(newGinServiceHandler(engine, handler), middleware...)...)
 }
 
@@ -79,6 +132,9 @@ func Cron(engine *Engine, spec string, job func()) {
 
 func newGinServiceHandler[T any](engine *Engine, handler Handler[T]) gin.HandlerFunc {
 	handlerSetup := handler()
+	if handlerSetup.Cursor {
+		warnCursorSecret()
+	}
 	return func(c *gin.Context) {
 		traces := GetTraces(c)
 		if len(traces) == 0 {
@@ -87,16 +143,37 @@ func newGinServiceHandler[T any](engine *Engine, handler Handler[T]) gin.Handler
 		traceID := GetTraceID(c)
 		ctx := &Context[T]{
 			GinContext: c,
-			Request:    GinRequest[T](c),
 			TraceID:    traceID,
 		}
+		timeout := handlerSetup.Timeout
+		if timeout == 0 {
+			timeout = engine.Timeout
+		}
+		cancel := ctx.withDeadline(timeout)
+		defer cancel()
+		request, fields, bindErr := bindRequest[T](c, handlerSetup.FieldMask)
+		ctx.Request = request
+		if handlerSetup.FieldMask {
+			ctx.Fields = fields
+		}
 		if handlerSetup.Pagination {
 			ctx.Page = GinRequest[sql.Pagination](c)
 		}
 		if handlerSetup.Sort {
 			ctx.Sort = GinRequest[sql.Sort](c)
 		}
-		resp, err := handlerSetup.Service(ctx)
+		if handlerSetup.Cursor {
+			ctx.Cursor = GinRequest[Cursor](c)
+		}
+		var resp interface{}
+		var err Error
+		if bindErr != nil {
+			err = bindErr
+		} else if handlerSetup.Idempotent {
+			resp, err = runIdempotent(engine, ctx, handlerSetup)
+		} else {
+			resp, err = runService(engine, ctx, handlerSetup)
+		}
 		if err != nil {
 			traces = append(traces, Trace{
 				TraceID:    traceID,
@@ -119,7 +196,17 @@ func newGinServiceHandler[T any](engine *Engine, handler Handler[T]) gin.Handler
 			SystemID:   engine.SystemID,
 			SystemName: engine.SystemName,
 		})
+		if result, ok := resp.(Result); ok {
+			ctx.Result(result, traceID, traces)
+			return
+		}
+		// the claimed Idempotency-Key keeps the response, so it is sent in full instead of 304
+		if ctx.idempotencyKey == "" && ctx.conditional(handlerSetup.ETag, resp, ctx.Page) {
+			ctx.NotModified(traceID, traces)
+			return
+		}
 		ctx.OK(resp, traceID, traces, ctx.Page)
+		ctx.completeIdempotency(engine)
 	}
 }
 
@@ -160,10 +247,13 @@ func joinMiddlewareAndService(service gin.HandlerFunc, middleware ...gin.Handler
 	return funcs
 }
 
+// GetTraceID returns the trace id of the request, a new one is kept in the request if the caller has not sent it
+// So the service and the recovery of its panics use the same trace id
 func GetTraceID(c *gin.Context) string {
 	traceID := c.GetHeader(MICRO_HEADER_TRACE_ID)
 	if traceID == "" {
-		return uuid.NewString()
+		traceID = uuid.NewString()
+		SetTraceID(c, traceID)
 	}
 	return traceID
 }
@@ -2,6 +2,22 @@ package micro
 
 var errMap = make(map[interface{}]string)
 
+func init() {
+	RegisterError(ERR_CODE_FILE_TOO_LARGE, ERR_MSG_FILE_TOO_LARGE)
+	RegisterError(ERR_CODE_NOT_FOUND, ERR_MSG_NOT_FOUND)
+	RegisterError(ERR_CODE_DATABASE, ERR_MSG_DATABASE)
+	RegisterError(ERR_CODE_CONFLICT, ERR_MSG_CONFLICT)
+	RegisterError(ERR_CODE_INVALID_CURSOR, ERR_MSG_INVALID_CURSOR)
+	RegisterError(ERR_CODE_TOO_MANY_REQUESTS, ERR_MSG_TOO_MANY_REQUESTS)
+	RegisterError(ERR_CODE_PRECONDITION_FAILED, ERR_MSG_PRECONDITION_FAILED)
+	RegisterError(ERR_CODE_IDEMPOTENCY_IN_FLIGHT, ERR_MSG_IDEMPOTENCY_IN_FLIGHT)
+	RegisterError(ERR_CODE_IDEMPOTENCY_KEY_REUSED, ERR_MSG_IDEMPOTENCY_KEY_REUSED)
+	RegisterError(ERR_CODE_TIMEOUT, ERR_MSG_TIMEOUT)
+	RegisterError(ERR_CODE_INTERNAL, ERR_MSG_INTERNAL)
+	RegisterError(ERR_CODE_INVALID_REQUEST, ERR_MSG_INVALID_REQUEST)
+	RegisterError(ERR_CODE_NOT_ACCEPTABLE, ERR_MSG_NOT_ACCEPTABLE)
+}
+
 func RegisterError(uuid string, message string) {
 	errMap[uuid] = message
 }
@@ -18,6 +34,14 @@ func NewError(code string) Error {
 	}
 }
 
+// NewErrorWithMessage create an error with the message, e.g. the error returned by another service
+func NewErrorWithMessage(code string, message string) Error {
+	return &errorImp{
+		code:    code,
+		message: message,
+	}
+}
+
 type errorImp struct {
 	code    string
 	message string
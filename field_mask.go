@@ -0,0 +1,24 @@
+package micro
+
+import "sort"
+
+// FieldMask is the set of the field names present in a request
+// It is used to tell a zero value sent by the client from a field that is not sent
+type FieldMask map[string]bool
+
+// Has returns true if the field is present
+func (m FieldMask) Has(name string) bool {
+	return m[name]
+}
+
+// Names returns the present field names in order
+func (m FieldMask) Names() []string {
+	names := make([]string, 0, len(m))
+	for name, ok := range m {
+		if ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
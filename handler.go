@@ -1,12 +1,26 @@
 package micro
 
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
 type Handler[T any] func() HandlerResponse[T]
 
 type HandlerResponse[T any] struct {
-	Service    Service[T]
-	Response   interface{}
-	Pagination bool
-	Sort       bool
+	Service     Service[T]
+	Response    interface{}
+	Pagination  bool
+	Sort        bool
+	Cursor      bool          // bind the cursor pagination, see BaseRepository.FindAllByCursor
+	FieldMask   bool          // track the fields present in the request, see Context.Fields
+	Transaction bool          // run the service in a transaction of the database, see Context.DB
+	DB          *gorm.DB      // the database of the service, default Engine.DB
+	Cache       CacheConfig   // the cache of GETWithCache
+	ETag        string        // compute the ETag of the data, ETAG_STRONG or ETAG_WEAK, see Context.SetETag for the versions of the service
+	Timeout     time.Duration // the cooperative timeout of the service, default Engine.Timeout, see Context.Deadline
+	Idempotent  bool          // run the service once for an Idempotency-Key of the caller, the retries get the first response, see Engine.IdempotencyStore
 }
 
 type WSHandler[T any] func() WSHandlerResponse[T]
@@ -0,0 +1,59 @@
+package micro
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+var testDBs uint64
+
+// newTestDB returns an in-memory sqlite database of the test
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:micro_test_%d?mode=memory&cache=shared", atomic.AddUint64(&testDBs, 1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// newTestEngine returns an engine without the gin logger
+func newTestEngine() *Engine {
+	engine := NewEngine("test-system", "test")
+	engine.GinEngine = gin.New()
+	engine.GinEngine.Use(Recovery(engine))
+	return engine
+}
+
+// serve send the request to the engine
+func serve(engine *Engine, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", MIME_JSON)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	engine.GinEngine.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,250 @@
+package micro
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	HEADER_IDEMPOTENCY_KEY      = "Idempotency-Key"
+	HEADER_IDEMPOTENCY_REPLAYED = "Idempotency-Replayed" // set to true on the replayed responses
+)
+
+// IDEMPOTENCY_TTL is how long the response of an Idempotency-Key is replayed
+var IDEMPOTENCY_TTL = 24 * time.Hour
+
+// IDEMPOTENCY_LOCK is how long a request in flight blocks its duplicates, the key is claimable again after it, e.g. the instance crashed
+var IDEMPOTENCY_LOCK = time.Minute
+
+// IdempotencyRecord is the stored form of an Idempotency-Key
+type IdempotencyRecord struct {
+	Key         string    `gorm:"column:idempotency_key;primaryKey;size:64"`
+	RequestHash string    `gorm:"size:64"`
+	Response    []byte    // the response envelope in json, nil while the request is in flight
+	ExpireAt    time.Time `gorm:"index"`
+}
+
+func (IdempotencyRecord) TableName() string {
+	return "micro_idempotency_keys"
+}
+
+// IdempotencyStore keeps the Idempotency-Keys of the Idempotent handlers
+// Use a shared store if the service has more than one instance
+type IdempotencyStore interface {
+	// Claim claim the key until expireAt, it returns the record and false if the key is claimed already
+	Claim(key string, requestHash string, expireAt time.Time) (*IdempotencyRecord, bool, error)
+	// Complete keep the response of the key until expireAt
+	Complete(key string, response []byte, expireAt time.Time) error
+	// Release remove the key, so the request can be retried
+	Release(key string) error
+}
+
+// runIdempotent run the service once for an Idempotency-Key of the caller, the duplicates get the response of the first request
+// The response is kept only if the service succeeds, the key is released on an error so the client can retry
+// The requests without the header run as usual
+func runIdempotent[T any](engine *Engine, ctx *Context[T], handlerSetup HandlerResponse[T]) (resp interface{}, err Error) {
+	idempotencyKey := ctx.Header(HEADER_IDEMPOTENCY_KEY)
+	if idempotencyKey == "" || engine.IdempotencyStore == nil {
+		return runService(engine, ctx, handlerSetup)
+	}
+	key, requestHash := idempotencyHash(engine, ctx.GinContext, idempotencyKey, ctx.Request)
+	record, claimed, storeErr := engine.IdempotencyStore.Claim(key, requestHash, time.Now().Add(IDEMPOTENCY_LOCK))
+	if storeErr != nil {
+		log.Println("Idempotency: failed to claim the key", storeErr)
+		return nil, NewError(ERR_CODE_DATABASE)
+	}
+	if !claimed {
+		switch {
+		case record.RequestHash != requestHash:
+			return nil, NewError(ERR_CODE_IDEMPOTENCY_KEY_REUSED)
+		case record.Response == nil:
+			return nil, NewError(ERR_CODE_IDEMPOTENCY_IN_FLIGHT)
+		}
+		return idempotentReplay{body: record.Response}, nil
+	}
+
+	completed := false
+	defer func() {
+		if !completed {
+			// failed or panicked, the Results are not kept either
+			engine.IdempotencyStore.Release(key)
+		}
+	}()
+	resp, err = runService(engine, ctx, handlerSetup)
+	if _, ok := resp.(Result); err != nil || ok {
+		return resp, err
+	}
+	completed = true
+	ctx.idempotencyKey = key
+	return resp, nil
+}
+
+// completeIdempotency keep the response envelope of the claimed key, called after the response is written
+func (ctx *Context[T]) completeIdempotency(engine *Engine) {
+	resp, ok := ctx.Response.(*Response)
+	if ctx.idempotencyKey == "" || !ok {
+		return
+	}
+	b, err := json.Marshal(resp)
+	if err == nil {
+		err = engine.IdempotencyStore.Complete(ctx.idempotencyKey, b, time.Now().Add(IDEMPOTENCY_TTL))
+	}
+	if err != nil {
+		log.Println("Idempotency: failed to keep the response", err)
+		engine.IdempotencyStore.Release(ctx.idempotencyKey)
+	}
+}
+
+// idempotencyHash returns the key scoped to the caller and the route, and the hash of the request
+// A key reused with another request is rejected instead of replaying the response of the first one
+func idempotencyHash(engine *Engine, c *gin.Context, idempotencyKey string, request interface{}) (string, string) {
+	key := sha256.Sum256([]byte(idempotencyCaller(engine, c) + "\x00" + c.Request.Method + " " + c.FullPath() + "\x00" + idempotencyKey))
+	body, _ := json.Marshal(request)
+	hash := sha256.Sum256(append([]byte(c.Request.URL.RequestURI()+"\x00"), body...))
+	return hex.EncodeToString(key[:]), hex.EncodeToString(hash[:])
+}
+
+// idempotencyCaller returns the caller scoping the keys, the actor of the engine,
+// otherwise the Authorization header, otherwise the client ip, so the callers do not get the responses of each other
+func idempotencyCaller(engine *Engine, c *gin.Context) string {
+	if engine.Actor != nil {
+		if actor := engine.Actor(c); actor != "" {
+			return "actor:" + actor
+		}
+	}
+	if authorization := c.GetHeader("Authorization"); authorization != "" {
+		hash := sha256.Sum256([]byte(authorization))
+		return "authorization:" + hex.EncodeToString(hash[:])
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// idempotentReplay is the response of the first request of the Idempotency-Key
+type idempotentReplay struct {
+	body []byte
+}
+
+// render write the kept json as is, or render the envelope again in the encoding accepted by the duplicate
+func (r idempotentReplay) render(c *gin.Context) {
+	c.Header(HEADER_IDEMPOTENCY_REPLAYED, "true")
+	resp := &Response{}
+	if err := json.Unmarshal(r.body, resp); err != nil || negotiateEncoding(c, resp.Data) == MIME_JSON {
+		c.Header("Vary", "Accept")
+		c.Data(200, MIME_JSON, r.body)
+		return
+	}
+	renderResponse(c, 200, resp)
+}
+
+// memoryIdempotencyStore keep the keys in memory, the keys are not shared by the instances
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*IdempotencyRecord
+	limit   int
+}
+
+// NewMemoryIdempotencyStore returns the store keeping the keys in memory
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{
+		entries: make(map[string]*IdempotencyRecord),
+		limit:   1024,
+	}
+}
+
+func (s *memoryIdempotencyStore) Claim(key string, requestHash string, expireAt time.Time) (*IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if record, ok := s.entries[key]; ok && record.ExpireAt.After(now) {
+		copied := *record
+		return &copied, false, nil
+	}
+	s.entries[key] = &IdempotencyRecord{Key: key, RequestHash: requestHash, ExpireAt: expireAt}
+	if len(s.entries) > s.limit {
+		for k, record := range s.entries {
+			if !record.ExpireAt.After(now) {
+				delete(s.entries, k)
+			}
+		}
+		if len(s.entries) > s.limit/2 {
+			s.limit *= 2
+		}
+	}
+	return nil, true, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(key string, response []byte, expireAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.entries[key]; ok {
+		record.Response = response
+		record.ExpireAt = expireAt
+	}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// gormIdempotencyStore keep the keys in the database, the keys are shared by the instances
+type gormIdempotencyStore struct {
+	db    *gorm.DB
+	calls uint64
+}
+
+// NewGormIdempotencyStore returns the store keeping the keys in the database, the table is migrated
+// The expired keys are removed from time to time
+func NewGormIdempotencyStore(db *gorm.DB) (IdempotencyStore, error) {
+	if err := db.AutoMigrate(&IdempotencyRecord{}); err != nil {
+		return nil, err
+	}
+	return &gormIdempotencyStore{db: db}, nil
+}
+
+func (s *gormIdempotencyStore) Claim(key string, requestHash string, expireAt time.Time) (*IdempotencyRecord, bool, error) {
+	now := time.Now()
+	if atomic.AddUint64(&s.calls, 1)%1000 == 0 {
+		s.db.Where("expire_at < ?", now).Delete(&IdempotencyRecord{})
+	}
+	if err := s.db.Where("idempotency_key = ? AND expire_at < ?", key, now).Delete(&IdempotencyRecord{}).Error; err != nil {
+		return nil, false, err
+	}
+	// only one of the instances inserts the key
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&IdempotencyRecord{Key: key, RequestHash: requestHash, ExpireAt: expireAt})
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil, true, nil
+	}
+	record := &IdempotencyRecord{}
+	if err := s.db.Where("idempotency_key = ?", key).Take(record).Error; err != nil {
+		return nil, false, err
+	}
+	return record, false, nil
+}
+
+func (s *gormIdempotencyStore) Complete(key string, response []byte, expireAt time.Time) error {
+	return s.db.Model(&IdempotencyRecord{}).Where("idempotency_key = ?", key).Updates(map[string]interface{}{
+		"response":  response,
+		"expire_at": expireAt,
+	}).Error
+}
+
+func (s *gormIdempotencyStore) Release(key string) error {
+	return s.db.Where("idempotency_key = ?", key).Delete(&IdempotencyRecord{}).Error
+}
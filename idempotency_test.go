@@ -0,0 +1,191 @@
+package micro
+
+import (
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func idempotencyStores(t *testing.T) map[string]IdempotencyStore {
+	gormStore, err := NewGormIdempotencyStore(newTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]IdempotencyStore{
+		"memory": NewMemoryIdempotencyStore(),
+		"gorm":   gormStore,
+	}
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	for name, store := range idempotencyStores(t) {
+		t.Run(name, func(t *testing.T) {
+			lock := time.Now().Add(time.Minute)
+			if _, claimed, err := store.Claim("a", "hash", lock); err != nil || !claimed {
+				t.Fatalf("the first claim: %v %v", claimed, err)
+			}
+			record, claimed, err := store.Claim("a", "hash", lock)
+			if err != nil || claimed || record.RequestHash != "hash" || record.Response != nil {
+				t.Fatalf("the claim in flight: %+v %v %v", record, claimed, err)
+			}
+
+			if err := store.Complete("a", []byte(`{"success":true}`), time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			record, claimed, _ = store.Claim("a", "hash", lock)
+			if claimed || string(record.Response) != `{"success":true}` {
+				t.Errorf("the claim after complete: %+v %v", record, claimed)
+			}
+
+			store.Release("a")
+			if _, claimed, _ := store.Claim("a", "hash", lock); !claimed {
+				t.Error("the released key is not claimable")
+			}
+
+			store.Claim("b", "hash", time.Now().Add(-time.Second))
+			if _, claimed, _ := store.Claim("b", "other", lock); !claimed {
+				t.Error("the expired key is not claimable")
+			}
+		})
+	}
+}
+
+type testIdempotentRequest struct {
+	Amount int `json:"amount"`
+}
+
+func newIdempotentEngine(t *testing.T, calls *int64, block chan struct{}) *Engine {
+	store, err := NewGormIdempotencyStore(newTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := newTestEngine()
+	engine.IdempotencyStore = store
+	POST(engine, "/payments", func() HandlerResponse[testIdempotentRequest] {
+		return HandlerResponse[testIdempotentRequest]{
+			Idempotent: true,
+			Service: func(ctx *Context[testIdempotentRequest]) (interface{}, Error) {
+				n := atomic.AddInt64(calls, 1)
+				if block != nil {
+					<-block
+				}
+				return map[string]int64{"call": n, "amount": int64(ctx.Request.Amount)}, nil
+			},
+		}
+	})
+	return engine
+}
+
+func TestIdempotentReplay(t *testing.T) {
+	var calls int64
+	engine := newIdempotentEngine(t, &calls, nil)
+	headers := map[string]string{HEADER_IDEMPOTENCY_KEY: "k1", "Authorization": "Bearer alice"}
+
+	first := serve(engine, "POST", "/payments", `{"amount":10}`, headers)
+	second := serve(engine, "POST", "/payments", `{"amount":10}`, headers)
+	if first.Code != 200 || second.Code != 200 || calls != 1 {
+		t.Fatalf("status %d %d, %d calls, want the service run once", first.Code, second.Code, calls)
+	}
+	if second.Header().Get(HEADER_IDEMPOTENCY_REPLAYED) != "true" || second.Body.String() != first.Body.String() {
+		t.Errorf("the replay %s, want %s", second.Body, first.Body)
+	}
+
+	reused := serve(engine, "POST", "/payments", `{"amount":20}`, headers)
+	if resp := decodeResponse(t, reused.Body.Bytes(), nil); resp.Error == nil || resp.Error.Code != ERR_CODE_IDEMPOTENCY_KEY_REUSED {
+		t.Errorf("the reused key: %s", reused.Body)
+	}
+
+	// the key is scoped to the caller, another caller runs the service
+	other := serve(engine, "POST", "/payments", `{"amount":10}`, map[string]string{HEADER_IDEMPOTENCY_KEY: "k1", "Authorization": "Bearer bob"})
+	if other.Header().Get(HEADER_IDEMPOTENCY_REPLAYED) != "" || calls != 2 {
+		t.Errorf("another caller got the replay, %d calls", calls)
+	}
+
+	serve(engine, "POST", "/payments", `{"amount":10}`, nil)
+	serve(engine, "POST", "/payments", `{"amount":10}`, nil)
+	if calls != 4 {
+		t.Errorf("%d calls, want the requests without the key run each time", calls)
+	}
+}
+
+func TestIdempotentInFlight(t *testing.T) {
+	var calls int64
+	block := make(chan struct{})
+	engine := newIdempotentEngine(t, &calls, block)
+	headers := map[string]string{HEADER_IDEMPOTENCY_KEY: "k1"}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serve(engine, "POST", "/payments", `{"amount":10}`, headers)
+	}()
+	for atomic.LoadInt64(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	inFlight := serve(engine, "POST", "/payments", `{"amount":10}`, headers)
+	close(block)
+	if first := <-done; first.Code != 200 {
+		t.Errorf("the first request: %d %s", first.Code, first.Body)
+	}
+	if resp := decodeResponse(t, inFlight.Body.Bytes(), nil); resp.Error == nil || resp.Error.Code != ERR_CODE_IDEMPOTENCY_IN_FLIGHT {
+		t.Errorf("the duplicate in flight: %s", inFlight.Body)
+	}
+}
+
+func TestIdempotentReplayEncoding(t *testing.T) {
+	var calls int64
+	engine := newIdempotentEngine(t, &calls, nil)
+	headers := map[string]string{HEADER_IDEMPOTENCY_KEY: "k1"}
+	serve(engine, "POST", "/payments", `{"amount":10}`, headers)
+
+	headers["Accept"] = MIME_MSGPACK
+	w := serve(engine, "POST", "/payments", `{"amount":10}`, headers)
+	if w.Header().Get("Content-Type") != MIME_MSGPACK || w.Header().Get(HEADER_IDEMPOTENCY_REPLAYED) != "true" {
+		t.Fatalf("headers %v, want the replay in msgpack", w.Header())
+	}
+	data := map[string]int64{}
+	resp := Response{Data: &data}
+	if err := Unmarshal(MIME_MSGPACK, w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || data["call"] != 1 || data["amount"] != 10 || calls != 1 {
+		t.Errorf("replay %+v %v, %d calls, want the response of the first request", resp, data, calls)
+	}
+
+	headers["Accept"] = "text/plain"
+	if w := serve(engine, "POST", "/payments", `{"amount":10}`, headers); w.Code != 406 {
+		t.Errorf("status %d, want 406 for the unacceptable replay", w.Code)
+	}
+}
+
+func TestIdempotentNotModified(t *testing.T) {
+	var calls int64
+	store, err := NewGormIdempotencyStore(newTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := newTestEngine()
+	engine.IdempotencyStore = store
+	GET(engine, "/payments/:id", func() HandlerResponse[testOrderRequest] {
+		return HandlerResponse[testOrderRequest]{
+			Idempotent: true,
+			ETag:       ETAG_STRONG,
+			Service: func(ctx *Context[testOrderRequest]) (interface{}, Error) {
+				atomic.AddInt64(&calls, 1)
+				return &testOrder{ID: ctx.Request.ID}, nil
+			},
+		}
+	})
+	headers := map[string]string{HEADER_IDEMPOTENCY_KEY: "k1", "If-None-Match": "*"}
+
+	first := serve(engine, "GET", "/payments/1", "", headers)
+	second := serve(engine, "GET", "/payments/1", "", headers)
+	if first.Code != 200 || second.Header().Get(HEADER_IDEMPOTENCY_REPLAYED) != "true" || second.Body.String() != first.Body.String() || calls != 1 {
+		t.Errorf("status %d, replay %s, %d calls, want the key completed instead of 304", first.Code, second.Body, calls)
+	}
+
+	delete(headers, HEADER_IDEMPOTENCY_KEY)
+	if w := serve(engine, "GET", "/payments/1", "", headers); w.Code != 304 {
+		t.Errorf("status %d, want 304 without the key", w.Code)
+	}
+}
@@ -0,0 +1,17 @@
+// Package testenv set the environment variables required by the plugins, e.g. the system of auth
+// Import it for its side effect in the tests of the packages importing auth, it is initialized before auth
+package testenv
+
+import "os"
+
+func init() {
+	for key, value := range map[string]string{
+		"SYSTEM_ID":    "test-system",
+		"SYSTEM_NAME":  "test",
+		"SYSTEM_TOKEN": "test-token",
+	} {
+		if os.Getenv(key) == "" {
+			os.Setenv(key, value)
+		}
+	}
+}
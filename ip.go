@@ -0,0 +1,149 @@
+package micro
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ginger-go/env"
+)
+
+// TRUSTED_PROXIES are the IPs or CIDRs of the proxies in front of the services, e.g. the ingress
+// The client IP is read from CLIENT_IP_HEADERS only if the request comes from them, otherwise it is the remote address
+// Please set it to the environment variable MICRO_TRUSTED_PROXIES, e.g. 10.0.0.0/8,fd00::/8, no proxy is trusted by default
+var TRUSTED_PROXIES = env.Strings("MICRO_TRUSTED_PROXIES", []string{})
+
+// CLIENT_IP_HEADERS are the headers set by the trusted proxies to carry the client IP, the first one present is used
+// Please set it to the environment variable MICRO_CLIENT_IP_HEADERS, e.g. CF-Connecting-IP
+var CLIENT_IP_HEADERS = env.Strings("MICRO_CLIENT_IP_HEADERS", []string{"X-Forwarded-For", "X-Real-IP"})
+
+// SetTrustedProxies set the proxies trusted to forward the client IP, and the headers of the client IP if given
+// The gin context ClientIP, and so the IP restrictions of the tokens and the rate limits, use them
+func (e *Engine) SetTrustedProxies(proxies []string, headers ...string) error {
+	trimmed := make([]string, 0, len(proxies))
+	for _, proxy := range proxies {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trimmed = append(trimmed, proxy)
+		}
+	}
+	if err := e.GinEngine.SetTrustedProxies(trimmed); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(headers))
+	for _, header := range headers {
+		if header = strings.TrimSpace(header); header != "" {
+			names = append(names, header)
+		}
+	}
+	if len(names) > 0 {
+		e.GinEngine.RemoteIPHeaders = names
+	}
+	e.GinEngine.ForwardedByClientIP = len(trimmed) > 0
+	return nil
+}
+
+// MatchIP returns if the ip is allowed by the restriction
+// The restriction is a comma separated list of IPs and CIDRs, e.g. 203.0.113.7,10.0.0.0/8,2001:db8::/32
+// The IPv4-mapped IPv6 addresses match their IPv4 form, and the ports are ignored, e.g. 203.0.113.7:443
+func MatchIP(restriction string, ip string) bool {
+	addr, ok := parseIP(ip)
+	if !ok {
+		return false
+	}
+	for _, entry := range strings.Split(restriction, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				continue
+			}
+			if prefix.Addr().Is4In6() {
+				prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+			}
+			if prefix.Masked().Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if allowed, ok := parseIP(entry); ok && allowed == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// HOST_CACHE_TTL is how long the addresses of a domain name resolved by MatchHost are kept
+var HOST_CACHE_TTL = 30 * time.Second
+
+// MatchHost returns if the ip is the address of the host, the host can be a url, a host:port, an IP or a domain name
+// The domain names are resolved and cached for HOST_CACHE_TTL, so the requests do not wait for the DNS
+func MatchHost(host string, ip string) bool {
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if _, ok := parseIP(host); ok {
+		return MatchIP(host, ip)
+	}
+	addrs := lookupHost(host)
+	if addrs == "" {
+		return false
+	}
+	return MatchIP(addrs, ip)
+}
+
+type hostEntry struct {
+	addrs    string
+	expireAt time.Time
+}
+
+var (
+	hostCacheMu sync.Mutex
+	hostCache   = make(map[string]hostEntry)
+	lookupAddrs = net.LookupHost
+)
+
+// lookupHost returns the comma separated addresses of the host, the last known addresses are kept if the lookup fails
+func lookupHost(host string) string {
+	hostCacheMu.Lock()
+	entry, ok := hostCache[host]
+	hostCacheMu.Unlock()
+	if ok && time.Now().Before(entry.expireAt) {
+		return entry.addrs
+	}
+	if addrs, err := lookupAddrs(host); err == nil {
+		entry.addrs = strings.Join(addrs, ",")
+	}
+	entry.expireAt = time.Now().Add(HOST_CACHE_TTL)
+	hostCacheMu.Lock()
+	hostCache[host] = entry
+	hostCacheMu.Unlock()
+	return entry.addrs
+}
+
+// parseIP parse the ip, with or without the port, and returns it in the canonical form
+func parseIP(ip string) (netip.Addr, bool) {
+	ip = strings.TrimSpace(ip)
+	addr, err := netip.ParseAddr(strings.Trim(ip, "[]"))
+	if err != nil {
+		host, _, splitErr := net.SplitHostPort(ip)
+		if splitErr != nil {
+			return netip.Addr{}, false
+		}
+		if addr, err = netip.ParseAddr(host); err != nil {
+			return netip.Addr{}, false
+		}
+	}
+	return addr.Unmap().WithZone(""), true
+}
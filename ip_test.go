@@ -0,0 +1,74 @@
+package micro
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMatchIP(t *testing.T) {
+	for _, c := range []struct {
+		restriction, ip string
+		want            bool
+	}{
+		{"203.0.113.7", "203.0.113.7", true},
+		{"203.0.113.7", "203.0.113.7:443", true},
+		{"203.0.113.7", "::ffff:203.0.113.7", true},
+		{"10.0.0.0/8, 192.168.0.1", "10.2.3.4", true},
+		{"10.0.0.0/8", "11.0.0.1", false},
+		{"2001:db8::/32", "[2001:db8::1]:80", true},
+		{"", "10.0.0.1", false},
+		{"10.0.0.1", "not an ip", false},
+	} {
+		if got := MatchIP(c.restriction, c.ip); got != c.want {
+			t.Errorf("MatchIP(%q, %q) = %v, want %v", c.restriction, c.ip, got, c.want)
+		}
+	}
+}
+
+func TestMatchHostCachesLookups(t *testing.T) {
+	defer func(lookup func(string) ([]string, error), ttl time.Duration) {
+		lookupAddrs, HOST_CACHE_TTL = lookup, ttl
+	}(lookupAddrs, HOST_CACHE_TTL)
+	lookups := 0
+	addrs := []string{"10.0.0.5"}
+	var lookupErr error
+	lookupAddrs = func(host string) ([]string, error) {
+		lookups++
+		return addrs, lookupErr
+	}
+	HOST_CACHE_TTL = time.Hour
+
+	for i := 0; i < 3; i++ {
+		if !MatchHost("http://auth.test:8080/path", "10.0.0.5") {
+			t.Fatal("the address of the host does not match")
+		}
+	}
+	if MatchHost("auth.test", "10.0.0.6") {
+		t.Error("another address matches")
+	}
+	if lookups != 1 {
+		t.Errorf("%d lookups, want the host resolved once", lookups)
+	}
+
+	if !MatchHost("10.0.0.9:80", "10.0.0.9") || lookups != 1 {
+		t.Error("the IP host is resolved")
+	}
+
+	// the expired entry is resolved again, the last addresses are kept if it fails
+	HOST_CACHE_TTL = 0
+	hostCacheMu.Lock()
+	hostCache["auth.test"] = hostEntry{addrs: hostCache["auth.test"].addrs}
+	hostCacheMu.Unlock()
+	addrs = []string{"10.0.0.7"}
+	if !MatchHost("auth.test", "10.0.0.7") {
+		t.Error("the new address does not match after the ttl")
+	}
+	lookupErr = errors.New("dns down")
+	if !MatchHost("auth.test", "10.0.0.7") {
+		t.Error("the last address is dropped when the lookup fails")
+	}
+	if lookups != 3 {
+		t.Errorf("%d lookups, want 3", lookups)
+	}
+}
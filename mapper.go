@@ -1,6 +1,12 @@
 package micro
 
-import "reflect"
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type BaseMapper[T any] struct {
 	BeforeMap2Model func(from interface{}) interface{}
@@ -19,7 +25,28 @@ func (m *BaseMapper[T]) Map2Model(from interface{}) *T {
 	return output
 }
 
+func (m *BaseMapper[T]) Patch(from interface{}, to *T, mask FieldMask) FieldMask {
+	from = neverBePtr(from)
+	if m.BeforeMap2Model != nil {
+		from = m.BeforeMap2Model(from)
+	}
+	set := PatchModel(from, to, mask)
+	if m.AfterMap2Model != nil {
+		if output := m.AfterMap2Model(from, to); output != nil && output != to {
+			*to = *output
+		}
+	}
+	return set
+}
+
 func (m *BaseMapper[T]) Map2Models(from interface{}) []T {
+	if m.BeforeMap2Model == nil && m.AfterMap2Model == nil {
+		output := Map2Models[T](from)
+		if output == nil {
+			output = make([]T, 0)
+		}
+		return output
+	}
 	from = neverBePtr(from)
 	fromVal := reflect.ValueOf(from)
 	if fromVal.Kind() != reflect.Slice {
@@ -32,90 +59,504 @@ func (m *BaseMapper[T]) Map2Models(from interface{}) []T {
 	return output
 }
 
+// Map2Model copy the non-zero fields of from to a new T
+// Fields are matched by name, or by the name in the map tag (`map:"OtherName"`), `map:"-"` skips the field
+// Embedded structs are flattened, nested structs, slices and maps are mapped recursively
+// Pointers and values are coerced, and the registered converters are used for the other type pairs
 func Map2Model[T any](from interface{}) *T {
 	from = neverBePtr(from)
+	if from == nil {
+		return nil
+	}
+
 	to := reflect.ValueOf(new(T)).Elem()
+	mapStruct(reflect.ValueOf(from), to)
 
-	if from == nil {
+	output := to.Interface().(T)
+	return &output
+}
+
+// PatchModel copy the non-zero fields of from to the existing to, the fields in the mask are copied even if they are zero
+// The mask holds the field names of from, the returned mask holds the field names of to that are set
+func PatchModel[T any](from interface{}, to *T, mask FieldMask) FieldMask {
+	set := FieldMask{}
+	from = neverBePtr(from)
+	if from == nil || to == nil {
+		return set
+	}
+	fromVal := reflect.ValueOf(from)
+	toVal := reflect.ValueOf(to).Elem()
+	mapPlanFor(fromVal.Type(), toVal.Type()).patch(fromVal, toVal, mask, set)
+	return set
+}
+
+func Map2Models[T any](fromArray interface{}) []T {
+	fromArray = neverBePtr(fromArray)
+	fromVal := reflect.ValueOf(fromArray)
+	if fromVal.Kind() != reflect.Slice {
+		panic("from must be a slice")
+	}
+
+	if fromVal.Len() == 0 {
 		return nil
 	}
-	if reflect.TypeOf(from).Kind() == reflect.Ptr {
-		from = reflect.ValueOf(from).Elem().Interface()
-	}
-
-	val := reflect.ValueOf(from)
-	for i := 0; i < val.NumField(); i++ {
-		field := val.Field(i)
-		if !field.IsZero() {
-			fieldName := val.Type().Field(i).Name
-			_, ok := to.Type().FieldByName(fieldName)
-			if ok {
-				switch field.Kind() {
-				case reflect.String:
-					to.FieldByName(fieldName).SetString(field.String())
-				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-					to.FieldByName(fieldName).SetInt(field.Int())
-				case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-					to.FieldByName(fieldName).SetUint(field.Uint())
-				case reflect.Float32, reflect.Float64:
-					to.FieldByName(fieldName).SetFloat(field.Float())
-				case reflect.Bool:
-					to.FieldByName(fieldName).SetBool(field.Bool())
-				case reflect.Slice, reflect.Array, reflect.Struct, reflect.Map, reflect.Ptr:
-					if to.FieldByName(fieldName).Type() == field.Type() {
-						to.FieldByName(fieldName).Set(field)
-					}
-				}
-			}
+
+	to := make([]T, fromVal.Len())
+	toVal := reflect.ValueOf(to)
+	toType := toVal.Type().Elem()
+	var plan *mapPlan
+	var planType reflect.Type
+	for i := 0; i < fromVal.Len(); i++ {
+		elem := fromVal.Index(i)
+		for elem.Kind() == reflect.Interface || elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		// the plan is looked up once for the slices of the same element type
+		if elem.Type() != planType {
+			planType = elem.Type()
+			plan = mapPlanFor(planType, toType)
 		}
+		plan.apply(elem, toVal.Index(i))
 	}
+	return to
+}
 
-	// handle gorm.Model
-	_, ok := reflect.TypeOf(from).FieldByName("Model")
-	if ok {
-		for _, fieldName := range []string{"ID", "CreatedAt", "UpdatedAt", "DeletedAt"} {
-			_, ok := reflect.ValueOf(from).FieldByName("Model").Type().FieldByName(fieldName)
-			if !ok {
+type converterKey struct {
+	from reflect.Type
+	to   reflect.Type
+}
+
+// converters keep the registered converters by the type pair, the plans compiled on the request goroutines read it
+var converters sync.Map
+
+// converter returns the converted value, and false if from cannot be converted, the field is not set then
+type converter func(from reflect.Value) (reflect.Value, bool)
+
+// RegisterConverter register the function used to map the From type to the To type
+// A registered converter takes priority over the default mapping
+// Register the converters in init, the mappings compiled before the registration are dropped
+func RegisterConverter[From any, To any](convert func(from From) To) {
+	registerConverter[From, To](func(from reflect.Value) (reflect.Value, bool) {
+		return reflect.ValueOf(convert(from.Interface().(From))), true
+	})
+}
+
+// RegisterConverterE register the function used to map the From type to the To type, the field is not set if it returns an error
+func RegisterConverterE[From any, To any](convert func(from From) (To, error)) {
+	registerConverter[From, To](func(from reflect.Value) (reflect.Value, bool) {
+		to, err := convert(from.Interface().(From))
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		return reflect.ValueOf(to), true
+	})
+}
+
+func registerConverter[From any, To any](convert converter) {
+	key := converterKey{
+		from: reflect.TypeOf((*From)(nil)).Elem(),
+		to:   reflect.TypeOf((*To)(nil)).Elem(),
+	}
+	converters.Store(key, convert)
+	resetMapPlans()
+}
+
+func init() {
+	RegisterConverter(func(from time.Time) string {
+		return from.Format(time.RFC3339)
+	})
+	RegisterConverterE(func(from string) (time.Time, error) {
+		return time.Parse(time.RFC3339, from)
+	})
+	RegisterConverter(func(from gorm.DeletedAt) time.Time {
+		return from.Time
+	})
+}
+
+type mapperField struct {
+	name  string
+	key   string // the name in the map tag, or the field name
+	index []int
+	depth int
+}
+
+// mapperFields list the mappable fields of the struct type, the embedded structs are flattened
+// The shallower field wins when the names collide, the same as the promoted fields in Go
+func mapperFields(t reflect.Type) []mapperField {
+	fields := make([]mapperField, 0)
+	seen := make(map[string]int)
+	var walk func(t reflect.Type, index []int, depth int)
+	walk = func(t reflect.Type, index []int, depth int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get(tag_map)
+			if tag == "-" {
 				continue
 			}
-			field := reflect.ValueOf(from).FieldByName("Model").FieldByName(fieldName)
-			if !field.IsZero() {
-				_, ok := to.Type().FieldByName(fieldName)
-				if !ok {
+			fieldIndex := append(append(make([]int, 0, len(index)+1), index...), i)
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			// an unexported embedded pointer cannot be allocated, so it is not flattened
+			if f.Anonymous && tag == "" && ft.Kind() == reflect.Struct && (f.IsExported() || f.Type.Kind() != reflect.Ptr) {
+				walk(ft, fieldIndex, depth+1)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			key := f.Name
+			if tag != "" {
+				key = tag
+			}
+			if at, ok := seen[key]; ok {
+				if fields[at].depth <= depth {
 					continue
 				}
-				to.FieldByName(fieldName).Set(field)
+				fields[at] = mapperField{name: f.Name, key: key, index: fieldIndex, depth: depth}
+				continue
 			}
+			seen[key] = len(fields)
+			fields = append(fields, mapperField{name: f.Name, key: key, index: fieldIndex, depth: depth})
 		}
 	}
+	walk(t, nil, 0)
+	return fields
+}
 
-	output := to.Interface().(T)
-	return &output
+// mapAssigner set from to to, returns false if nothing is set
+type mapAssigner func(from reflect.Value, to reflect.Value) bool
+
+// mapPlan is the compiled mapping between two struct types
+type mapPlan struct {
+	fields []mapPlanField
 }
 
-func Map2Models[T any](fromArray interface{}) []T {
-	fromArray = neverBePtr(fromArray)
-	fromVal := reflect.ValueOf(fromArray)
-	if fromVal.Kind() != reflect.Slice {
-		panic("from must be a slice")
+type mapPlanField struct {
+	from     []int
+	to       []int
+	fromName string
+	toName   string
+	nested   bool // the field is inside an embedded struct
+	assign   mapAssigner
+}
+
+// the plans and the assigners are compiled on first use and cached by the type pair
+var mapPlans sync.Map
+var mapAssigners sync.Map
+
+// resetMapPlans drop the compiled plans, called when a converter is registered
+func resetMapPlans() {
+	mapPlans.Range(func(key, _ interface{}) bool {
+		mapPlans.Delete(key)
+		return true
+	})
+	mapAssigners.Range(func(key, _ interface{}) bool {
+		mapAssigners.Delete(key)
+		return true
+	})
+}
+
+func mapPlanFor(from reflect.Type, to reflect.Type) *mapPlan {
+	key := converterKey{from: from, to: to}
+	if plan, ok := mapPlans.Load(key); ok {
+		return plan.(*mapPlan)
 	}
+	plan, _ := mapPlans.LoadOrStore(key, compileMapPlan(from, to))
+	return plan.(*mapPlan)
+}
 
-	var from = make([]interface{}, fromVal.Len())
-	for i := 0; i < fromVal.Len(); i++ {
-		from[i] = fromVal.Index(i).Interface()
+func compileMapPlan(from reflect.Type, to reflect.Type) *mapPlan {
+	fromFields := make(map[string]mapperField)
+	for _, f := range mapperFields(from) {
+		fromFields[f.key] = f
+	}
+
+	plan := &mapPlan{fields: make([]mapPlanField, 0)}
+	for _, toField := range mapperFields(to) {
+		fromField, ok := fromFields[toField.key]
+		if !ok && toField.key != toField.name {
+			fromField, ok = fromFields[toField.name]
+		}
+		if !ok {
+			continue
+		}
+		assign := mapAssignerFor(from.FieldByIndex(fromField.index).Type, to.FieldByIndex(toField.index).Type)
+		if assign == nil {
+			continue
+		}
+		plan.fields = append(plan.fields, mapPlanField{
+			from:     fromField.index,
+			to:       toField.index,
+			fromName: fromField.name,
+			toName:   toField.name,
+			nested:   len(fromField.index) > 1 || len(toField.index) > 1,
+			assign:   assign,
+		})
 	}
+	return plan
+}
 
-	var to []T
-	for _, f := range from {
-		t := Map2Model[T](f)
-		to = append(to, *t)
+// apply copy the non-zero fields of the from struct to the to struct
+func (p *mapPlan) apply(from reflect.Value, to reflect.Value) {
+	for i := range p.fields {
+		f := &p.fields[i]
+		if !f.nested {
+			field := from.Field(f.from[0])
+			if !field.IsZero() {
+				f.assign(field, to.Field(f.to[0]))
+			}
+			continue
+		}
+		field, ok := fieldByIndex(from, f.from)
+		if !ok || field.IsZero() {
+			continue
+		}
+		f.assign(field, fieldByIndexAlloc(to, f.to))
 	}
-	return to
+}
+
+// patch copy the non-zero fields, and the zero fields in the mask, of the from struct to the to struct
+// The names of the set fields of to are added to set
+func (p *mapPlan) patch(from reflect.Value, to reflect.Value, mask FieldMask, set FieldMask) {
+	for i := range p.fields {
+		f := &p.fields[i]
+		field, ok := fieldByIndex(from, f.from)
+		if !ok {
+			continue
+		}
+		if field.IsZero() {
+			if !mask.Has(f.fromName) {
+				continue
+			}
+			target := fieldByIndexAlloc(to, f.to)
+			target.Set(reflect.Zero(target.Type()))
+			set[f.toName] = true
+			continue
+		}
+		if f.assign(field, fieldByIndexAlloc(to, f.to)) {
+			set[f.toName] = true
+		}
+	}
+}
+
+// mapStruct copy the non-zero fields of the from struct to the to struct
+func mapStruct(from reflect.Value, to reflect.Value) {
+	mapPlanFor(from.Type(), to.Type()).apply(from, to)
+}
+
+// mapValue set from to to, returns false if the types cannot be mapped
+func mapValue(from reflect.Value, to reflect.Value) bool {
+	assign := mapAssignerFor(from.Type(), to.Type())
+	if assign == nil {
+		return false
+	}
+	return assign(from, to)
+}
+
+func mapAssignerFor(from reflect.Type, to reflect.Type) mapAssigner {
+	key := converterKey{from: from, to: to}
+	if assign, ok := mapAssigners.Load(key); ok {
+		return assign.(mapAssigner)
+	}
+	assign, _ := mapAssigners.LoadOrStore(key, compileMapAssigner(from, to))
+	return assign.(mapAssigner)
+}
+
+// compileMapAssigner returns nil if the types cannot be mapped
+// The struct pairs are resolved through mapPlanFor at run time, so the recursive types compile
+func compileMapAssigner(from reflect.Type, to reflect.Type) mapAssigner {
+	if c, ok := converters.Load(converterKey{from: from, to: to}); ok {
+		convert := c.(converter)
+		return func(f reflect.Value, t reflect.Value) bool {
+			v, ok := convert(f)
+			if !ok {
+				return false
+			}
+			t.Set(v)
+			return true
+		}
+	}
+	if from.AssignableTo(to) {
+		return func(f reflect.Value, t reflect.Value) bool {
+			t.Set(f)
+			return true
+		}
+	}
+	if from.Kind() == reflect.Ptr {
+		elem := compileMapAssigner(from.Elem(), to)
+		if elem == nil {
+			return nil
+		}
+		return func(f reflect.Value, t reflect.Value) bool {
+			if f.IsNil() {
+				return false
+			}
+			return elem(f.Elem(), t)
+		}
+	}
+	if to.Kind() == reflect.Ptr {
+		elemType := to.Elem()
+		elem := compileMapAssigner(from, elemType)
+		if elem == nil {
+			return nil
+		}
+		return func(f reflect.Value, t reflect.Value) bool {
+			v := reflect.New(elemType)
+			if !elem(f, v.Elem()) {
+				return false
+			}
+			t.Set(v)
+			return true
+		}
+	}
+
+	switch to.Kind() {
+	case reflect.String:
+		if from.Kind() == reflect.String {
+			return func(f reflect.Value, t reflect.Value) bool {
+				t.SetString(f.String())
+				return true
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch from.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return func(f reflect.Value, t reflect.Value) bool {
+				t.SetInt(f.Int())
+				return true
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch from.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return func(f reflect.Value, t reflect.Value) bool {
+				t.SetUint(f.Uint())
+				return true
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		switch from.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return func(f reflect.Value, t reflect.Value) bool {
+				t.SetFloat(f.Float())
+				return true
+			}
+		}
+	case reflect.Bool:
+		if from.Kind() == reflect.Bool {
+			return func(f reflect.Value, t reflect.Value) bool {
+				t.SetBool(f.Bool())
+				return true
+			}
+		}
+	case reflect.Struct:
+		if from.Kind() == reflect.Struct {
+			return func(f reflect.Value, t reflect.Value) bool {
+				mapPlanFor(from, to).apply(f, t)
+				return true
+			}
+		}
+	case reflect.Slice:
+		if from.Kind() == reflect.Slice || from.Kind() == reflect.Array {
+			elem := compileMapAssigner(from.Elem(), to.Elem())
+			if elem == nil {
+				return nil
+			}
+			return func(f reflect.Value, t reflect.Value) bool {
+				if f.Kind() == reflect.Slice && f.IsNil() {
+					return false
+				}
+				output := reflect.MakeSlice(to, f.Len(), f.Len())
+				for i := 0; i < f.Len(); i++ {
+					elem(f.Index(i), output.Index(i))
+				}
+				t.Set(output)
+				return true
+			}
+		}
+	case reflect.Array:
+		if from.Kind() == reflect.Slice || from.Kind() == reflect.Array {
+			elem := compileMapAssigner(from.Elem(), to.Elem())
+			if elem == nil {
+				return nil
+			}
+			return func(f reflect.Value, t reflect.Value) bool {
+				for i := 0; i < f.Len() && i < t.Len(); i++ {
+					elem(f.Index(i), t.Index(i))
+				}
+				return true
+			}
+		}
+	case reflect.Map:
+		if from.Kind() == reflect.Map {
+			key := compileMapAssigner(from.Key(), to.Key())
+			value := compileMapAssigner(from.Elem(), to.Elem())
+			if key == nil || value == nil {
+				return nil
+			}
+			return func(f reflect.Value, t reflect.Value) bool {
+				if f.IsNil() {
+					return false
+				}
+				output := reflect.MakeMapWithSize(to, f.Len())
+				iter := f.MapRange()
+				for iter.Next() {
+					k := reflect.New(to.Key()).Elem()
+					v := reflect.New(to.Elem()).Elem()
+					if !key(iter.Key(), k) {
+						continue
+					}
+					value(iter.Value(), v)
+					output.SetMapIndex(k, v)
+				}
+				t.Set(output)
+				return true
+			}
+		}
+	}
+	return nil
+}
+
+// fieldByIndex get the nested field, returns false if an embedded pointer on the way is nil
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// fieldByIndexAlloc get the nested field, the nil embedded pointers on the way are allocated
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
 }
 
 func neverBePtr(v interface{}) interface{} {
-	if reflect.TypeOf(v).Kind() == reflect.Ptr {
-		return reflect.ValueOf(v).Elem().Interface()
+	if v == nil {
+		return nil
+	}
+	val := reflect.ValueOf(v)
+	if val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil
+		}
+		return val.Elem().Interface()
 	}
 	return v
 }
@@ -0,0 +1,330 @@
+package micro
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type benchRow struct {
+	ID        uint
+	Name      string
+	Email     string
+	Age       int
+	Score     float64
+	Active    bool
+	Tags      []string
+	CreatedAt time.Time
+	Note      *string
+}
+
+type benchDTO struct {
+	ID        uint
+	Name      string
+	Email     string
+	Age       int
+	Score     float64
+	Active    bool
+	Tags      []string
+	CreatedAt time.Time
+	Note      *string
+}
+
+func benchRows(n int) []benchRow {
+	note := "note"
+	rows := make([]benchRow, n)
+	for i := range rows {
+		rows[i] = benchRow{
+			ID:        uint(i + 1),
+			Name:      "name",
+			Email:     "name@example.com",
+			Age:       i % 90,
+			Score:     float64(i) / 3,
+			Active:    i%2 == 0,
+			Tags:      []string{"a", "b"},
+			CreatedAt: time.Unix(int64(i), 0),
+			Note:      &note,
+		}
+	}
+	return rows
+}
+
+// baselineMap2Model and baselineMap2Models are the mapping before the compiled plans, kept verbatim to benchmark against
+func baselineMap2Model[T any](from interface{}) *T {
+	from = neverBePtr(from)
+	to := reflect.ValueOf(new(T)).Elem()
+
+	if from == nil {
+		return nil
+	}
+	if reflect.TypeOf(from).Kind() == reflect.Ptr {
+		from = reflect.ValueOf(from).Elem().Interface()
+	}
+
+	val := reflect.ValueOf(from)
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Field(i)
+		if !field.IsZero() {
+			fieldName := val.Type().Field(i).Name
+			_, ok := to.Type().FieldByName(fieldName)
+			if ok {
+				switch field.Kind() {
+				case reflect.String:
+					to.FieldByName(fieldName).SetString(field.String())
+				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+					to.FieldByName(fieldName).SetInt(field.Int())
+				case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+					to.FieldByName(fieldName).SetUint(field.Uint())
+				case reflect.Float32, reflect.Float64:
+					to.FieldByName(fieldName).SetFloat(field.Float())
+				case reflect.Bool:
+					to.FieldByName(fieldName).SetBool(field.Bool())
+				case reflect.Slice, reflect.Array, reflect.Struct, reflect.Map, reflect.Ptr:
+					if to.FieldByName(fieldName).Type() == field.Type() {
+						to.FieldByName(fieldName).Set(field)
+					}
+				}
+			}
+		}
+	}
+
+	// handle gorm.Model
+	_, ok := reflect.TypeOf(from).FieldByName("Model")
+	if ok {
+		for _, fieldName := range []string{"ID", "CreatedAt", "UpdatedAt", "DeletedAt"} {
+			_, ok := reflect.ValueOf(from).FieldByName("Model").Type().FieldByName(fieldName)
+			if !ok {
+				continue
+			}
+			field := reflect.ValueOf(from).FieldByName("Model").FieldByName(fieldName)
+			if !field.IsZero() {
+				_, ok := to.Type().FieldByName(fieldName)
+				if !ok {
+					continue
+				}
+				to.FieldByName(fieldName).Set(field)
+			}
+		}
+	}
+
+	output := to.Interface().(T)
+	return &output
+}
+
+func baselineMap2Models[T any](fromArray interface{}) []T {
+	fromArray = neverBePtr(fromArray)
+	fromVal := reflect.ValueOf(fromArray)
+	if fromVal.Kind() != reflect.Slice {
+		panic("from must be a slice")
+	}
+
+	var from = make([]interface{}, fromVal.Len())
+	for i := 0; i < fromVal.Len(); i++ {
+		from[i] = fromVal.Index(i).Interface()
+	}
+
+	var to []T
+	for _, f := range from {
+		t := baselineMap2Model[T](f)
+		to = append(to, *t)
+	}
+	return to
+}
+
+func TestMap2ModelsMatchesBaseline(t *testing.T) {
+	rows := benchRows(10)
+	rows[3].Name = ""
+	rows[4].Note = nil
+	got := Map2Models[benchDTO](rows)
+	want := baselineMap2Models[benchDTO](rows)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Map2Models = %+v, want %+v", got, want)
+	}
+	if Map2Models[benchDTO]([]benchRow{}) != nil {
+		t.Errorf("Map2Models of an empty slice is not nil")
+	}
+}
+
+func BenchmarkMap2Models(b *testing.B) {
+	rows := benchRows(1000)
+	b.Run("plan", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			Map2Models[benchDTO](rows)
+		}
+	})
+	b.Run("baseline", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			baselineMap2Models[benchDTO](rows)
+		}
+	})
+}
+
+func BenchmarkMap2Model(b *testing.B) {
+	row := benchRows(1)[0]
+	b.Run("plan", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			Map2Model[benchDTO](row)
+		}
+	})
+	b.Run("baseline", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			baselineMap2Model[benchDTO](row)
+		}
+	})
+}
+
+type testAddress struct {
+	City   string
+	Street string
+}
+
+type testAddressDTO struct {
+	City string
+}
+
+type testAudit struct {
+	CreatedBy string
+	UpdatedAt time.Time
+}
+
+type testCustomer struct {
+	testAudit
+	ID        uint
+	FullName  string
+	Password  string
+	Age       *int
+	Score     int
+	Address   testAddress
+	Addresses []testAddress
+	Contacts  map[string]testAddress
+	Joined    time.Time
+	Birthday  string
+}
+
+type testCustomerDTO struct {
+	ID        uint
+	Name      string `map:"FullName"`
+	Password  string `map:"-"`
+	Age       int
+	Score     *int
+	Address   *testAddressDTO
+	Addresses []testAddressDTO
+	Contacts  map[string]testAddressDTO
+	CreatedBy string
+	UpdatedAt string
+	Joined    string
+	Birthday  time.Time
+}
+
+func TestMap2Model(t *testing.T) {
+	age := 30
+	updated := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	customer := testCustomer{
+		testAudit: testAudit{CreatedBy: "alice", UpdatedAt: updated},
+		ID:        1,
+		FullName:  "Ada",
+		Password:  "secret",
+		Age:       &age,
+		Score:     7,
+		Address:   testAddress{City: "Paris", Street: "Rue"},
+		Addresses: []testAddress{{City: "Lyon"}, {City: "Nice"}},
+		Contacts:  map[string]testAddress{"home": {City: "Lille"}},
+		Joined:    updated,
+		Birthday:  "2000-01-02T00:00:00Z",
+	}
+	dto := Map2Model[testCustomerDTO](&customer)
+
+	if dto.ID != 1 || dto.Name != "Ada" || dto.Password != "" {
+		t.Errorf("the renamed and skipped fields: %+v", dto)
+	}
+	if dto.Age != 30 || dto.Score == nil || *dto.Score != 7 {
+		t.Errorf("the coerced pointers: Age %d, Score %v", dto.Age, dto.Score)
+	}
+	if dto.Address == nil || dto.Address.City != "Paris" {
+		t.Errorf("the nested struct: %+v", dto.Address)
+	}
+	if len(dto.Addresses) != 2 || dto.Addresses[1].City != "Nice" || dto.Contacts["home"].City != "Lille" {
+		t.Errorf("the nested slice and map: %+v %+v", dto.Addresses, dto.Contacts)
+	}
+	if dto.CreatedBy != "alice" || dto.UpdatedAt != updated.Format(time.RFC3339) {
+		t.Errorf("the flattened embedded struct: %q %q", dto.CreatedBy, dto.UpdatedAt)
+	}
+	if dto.Joined != updated.Format(time.RFC3339) || !dto.Birthday.Equal(time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("the converted times: %q %v", dto.Joined, dto.Birthday)
+	}
+
+	// the invalid time is not set instead of the zero time
+	customer.Birthday = "yesterday"
+	existing := testCustomerDTO{Birthday: updated}
+	PatchModel(customer, &existing, nil)
+	if !existing.Birthday.Equal(updated) {
+		t.Errorf("the invalid time overwrote the field: %v", existing.Birthday)
+	}
+
+	// the map tag works both ways, and the embedded struct of the target is filled from the flat source
+	back := Map2Model[testCustomer](testCustomerDTO{Name: "Ada", CreatedBy: "bob", Age: 5})
+	if back.FullName != "Ada" || back.CreatedBy != "bob" || back.Age == nil || *back.Age != 5 {
+		t.Errorf("the reverse mapping: %+v", back)
+	}
+
+	if Map2Model[testCustomerDTO](testCustomer{}).Address != nil {
+		t.Error("the zero nested struct is mapped")
+	}
+}
+
+type testCents int64
+
+type testPrice struct {
+	Amount testCents
+}
+
+type testPriceDTO struct {
+	Amount string
+}
+
+func TestRegisterConverter(t *testing.T) {
+	if dto := Map2Model[testPriceDTO](testPrice{Amount: 1250}); dto.Amount != "" {
+		t.Fatalf("the amount is mapped without a converter: %q", dto.Amount)
+	}
+	RegisterConverter(func(from testCents) string {
+		return fmt.Sprintf("%d.%02d", from/100, from%100)
+	})
+	if dto := Map2Model[testPriceDTO](testPrice{Amount: 1250}); dto.Amount != "12.50" {
+		t.Errorf("the converted amount is %q, want 12.50", dto.Amount)
+	}
+
+	RegisterConverterE(func(from string) (testCents, error) {
+		var units, cents int64
+		if _, err := fmt.Sscanf(from, "%d.%d", &units, &cents); err != nil {
+			return 0, err
+		}
+		return testCents(units*100 + cents), nil
+	})
+	price := testPrice{Amount: 1}
+	PatchModel(testPriceDTO{Amount: "3.20"}, &price, nil)
+	if price.Amount != 320 {
+		t.Errorf("the parsed amount is %d, want 320", price.Amount)
+	}
+	if set := PatchModel(testPriceDTO{Amount: "free"}, &price, nil); price.Amount != 320 || set.Has("Amount") {
+		t.Errorf("the failed conversion set the amount to %d, %v", price.Amount, set)
+	}
+}
+
+func TestPatchModel(t *testing.T) {
+	customer := testCustomer{ID: 1, FullName: "Ada", Score: 7, testAudit: testAudit{CreatedBy: "alice"}}
+	set := PatchModel(testCustomerDTO{Name: "Grace", Score: new(int)}, &customer, FieldMask{"Score": true, "CreatedBy": true})
+	if customer.FullName != "Grace" || customer.Score != 0 || customer.ID != 1 {
+		t.Errorf("the patched customer: %+v", customer)
+	}
+	if customer.CreatedBy != "" {
+		t.Errorf("the zero field in the mask is not set: %q", customer.CreatedBy)
+	}
+	if !reflect.DeepEqual(set, FieldMask{"FullName": true, "Score": true, "CreatedBy": true}) {
+		t.Errorf("the set fields are %v", set)
+	}
+}
@@ -0,0 +1,92 @@
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	OUTBOX_EVENT_CREATED = "created"
+	OUTBOX_EVENT_UPDATED = "updated"
+	OUTBOX_EVENT_DELETED = "deleted"
+)
+
+// OutboxMessage is an event written in the same transaction as the data, so it is never lost if the data is saved
+// The messages are published by the relay of plugins/outbox, in order for the same Key
+type OutboxMessage struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	Topic       string     `gorm:"size:255" json:"topic"`
+	Key         string     `gorm:"column:message_key;size:255;index" json:"key"` // the aggregate key, e.g. the primary key of the entity
+	Payload     string     `json:"payload"`
+	TraceID     string     `gorm:"size:64" json:"trace_id"`
+	Attempts    int        `json:"attempts"`
+	AvailableAt time.Time  `gorm:"index" json:"available_at"` // the message is not published before, it is leased or backed off
+	DeliveredAt *time.Time `gorm:"index" json:"delivered_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (OutboxMessage) TableName() string {
+	return "micro_outbox"
+}
+
+// MigrateOutbox create the outbox table
+func MigrateOutbox(db *gorm.DB) error {
+	return db.AutoMigrate(&OutboxMessage{})
+}
+
+// WriteOutbox write an event to the outbox, use the transaction of the data to save them atomically
+// The payload is encoded in json
+func WriteOutbox(tx *gorm.DB, topic string, key string, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return tx.Create(&OutboxMessage{
+		Topic:       topic,
+		Key:         key,
+		Payload:     string(b),
+		TraceID:     getTraceID(tx),
+		AvailableAt: now,
+		CreatedAt:   now,
+	}).Error
+}
+
+// writeEntityOutbox write the event of the entity, the key is the topic and the primary key of the entity
+func (r *BaseRepository[T]) writeEntityOutbox(tx *gorm.DB, event string, entity *T) error {
+	sch, err := r.schema(tx)
+	if err != nil {
+		return err
+	}
+	var key string
+	if sch.PrioritizedPrimaryField != nil {
+		id, _ := sch.PrioritizedPrimaryField.ValueOf(tx.Statement.Context, reflect.ValueOf(entity).Elem())
+		key = r.Topic + ":" + fmt.Sprint(id)
+	}
+	return WriteOutbox(tx, r.Topic+"."+event, key, entity)
+}
+
+type traceIDKey struct{}
+
+// withTraceID set the trace id to the database, it is recorded in the outbox messages
+func withTraceID(tx *gorm.DB, traceID string) *gorm.DB {
+	ctx := tx.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tx.WithContext(context.WithValue(ctx, traceIDKey{}, traceID))
+}
+
+func getTraceID(tx *gorm.DB) string {
+	if tx == nil || tx.Statement == nil || tx.Statement.Context == nil {
+		return ""
+	}
+	traceID, _ := tx.Statement.Context.Value(traceIDKey{}).(string)
+	return traceID
+}
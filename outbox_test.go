@@ -0,0 +1,91 @@
+package micro
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestRepositoryOutbox(t *testing.T) {
+	db := newTestDB(t)
+	db.AutoMigrate(&testNote{})
+	MigrateOutbox(db)
+	repo := &BaseRepository[testNote]{Topic: "note"}
+
+	// the message is written in the transaction of the data, and rolled back with it
+	rollback := errors.New("rollback")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := repo.Save(tx, &testNote{Title: "lost"}); err != nil {
+			return err
+		}
+		var count int64
+		tx.Model(&OutboxMessage{}).Count(&count)
+		if count != 1 {
+			t.Errorf("%d messages in the transaction, want 1", count)
+		}
+		return rollback
+	})
+	if err != rollback {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&OutboxMessage{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d messages after the rollback, want 0", count)
+	}
+	db.Model(&testNote{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d notes after the rollback, want 0", count)
+	}
+
+	note, err := repo.Save(withTraceID(db, "trace-1"), &testNote{Title: "kept"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	note.Title = "changed"
+	if _, err := repo.Save(db, note); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(db, note); err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []OutboxMessage
+	db.Order("id").Find(&messages)
+	if len(messages) != 3 {
+		t.Fatalf("%d messages, want created, updated and deleted", len(messages))
+	}
+	for i, topic := range []string{"note.created", "note.updated", "note.deleted"} {
+		if messages[i].Topic != topic || messages[i].Key != "note:1" || messages[i].DeliveredAt != nil {
+			t.Errorf("message %d = %+v, want %s of note:1", i, messages[i], topic)
+		}
+	}
+	var payload testNote
+	if err := json.Unmarshal([]byte(messages[1].Payload), &payload); err != nil || payload.Title != "changed" {
+		t.Errorf("payload %s, %v", messages[1].Payload, err)
+	}
+	if messages[0].TraceID != "trace-1" {
+		t.Errorf("trace id %q, want the trace of the database", messages[0].TraceID)
+	}
+}
+
+func TestRepositoryOutboxFailedSave(t *testing.T) {
+	db := newTestDB(t)
+	db.AutoMigrate(&testVersionedNote{})
+	MigrateOutbox(db)
+	repo := &BaseRepository[testVersionedNote]{Topic: "note", Versioned: true}
+
+	note, _ := repo.Save(db, &testVersionedNote{Title: "v1"})
+	stale := *note
+	repo.Save(db, note)
+	if _, err := repo.Save(db, &stale); err == nil {
+		t.Fatal("the stale save succeeded")
+	}
+	var count int64
+	db.Model(&OutboxMessage{}).Count(&count)
+	if count != 2 {
+		t.Errorf("%d messages, want none for the conflicting save", count)
+	}
+}
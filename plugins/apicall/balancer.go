@@ -0,0 +1,366 @@
+package apicall
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	BALANCE_ROUND_ROBIN     = "round-robin"
+	BALANCE_LEAST_IN_FLIGHT = "least-in-flight"
+	BALANCE_CONSISTENT_HASH = "consistent-hash" // by the HEADER_HASH_KEY of the request, round robin without it
+)
+
+// HEADER_HASH_KEY is the key of the consistent hash, e.g. the user id, so the requests of the key go to the same endpoint
+const HEADER_HASH_KEY = "Micro-Hash-Key"
+
+// UpstreamConfig is the setting of the endpoints of a logical service name, called by micro://{name}
+type UpstreamConfig struct {
+	Endpoints       []string      // the base urls, RESOLVER is used if empty
+	Strategy        string        // default BALANCE_ROUND_ROBIN
+	EjectAfter      int           // consecutive failures before the endpoint is ejected, default 5
+	EjectDuration   time.Duration // how long the endpoint is ejected, default 30 seconds
+	Hedge           bool          // send a second GET to another endpoint if the first is slower than the percentile
+	HedgePercentile float64       // default 0.95
+	Encoding        string        // the encoding of the request bodies, default ENCODING, e.g. micro.MIME_MSGPACK if the service binds it
+}
+
+// SetupUpstream set the endpoints and the balancing of the service name
+// The services not setup are balanced round robin over the endpoints from RESOLVER
+func SetupUpstream(name string, config UpstreamConfig) {
+	upstreams.Store(name, newUpstream(name, config))
+}
+
+const (
+	latencySamples    = 100
+	minLatencySamples = 10
+)
+
+type upstream struct {
+	name    string
+	config  UpstreamConfig
+	counter uint64
+
+	mu        sync.Mutex
+	stats     map[string]*endpointStats
+	latencies []time.Duration
+	next      int
+}
+
+type endpointStats struct {
+	inFlight     int64
+	failures     int
+	ejectedUntil time.Time
+}
+
+var upstreams sync.Map // name to *upstream
+
+func newUpstream(name string, config UpstreamConfig) *upstream {
+	if config.Strategy == "" {
+		config.Strategy = BALANCE_ROUND_ROBIN
+	}
+	if config.EjectAfter <= 0 {
+		config.EjectAfter = 5
+	}
+	if config.EjectDuration <= 0 {
+		config.EjectDuration = 30 * time.Second
+	}
+	if config.HedgePercentile <= 0 || config.HedgePercentile >= 1 {
+		config.HedgePercentile = 0.95
+	}
+	return &upstream{
+		name:   name,
+		config: config,
+		stats:  make(map[string]*endpointStats),
+	}
+}
+
+// encodingOf returns the encoding of the request bodies to the service name
+func encodingOf(name string) string {
+	if u, ok := upstreams.Load(name); ok && u.(*upstream).config.Encoding != "" {
+		return u.(*upstream).config.Encoding
+	}
+	return ENCODING
+}
+
+func upstreamOf(name string) *upstream {
+	u, _ := upstreams.LoadOrStore(name, newUpstream(name, UpstreamConfig{}))
+	return u.(*upstream)
+}
+
+// send send the request, the micro://{name} urls are sent to an endpoint of the upstream
+// It returns the endpoint chosen
+func send(req *http.Request) (*http.Response, string, error) {
+	if req.URL.Scheme != SCHEME_MICRO {
+		resp, err := roundTrip(req)
+		return resp, "", err
+	}
+	u := upstreamOf(req.URL.Host)
+	key := req.Header.Get(HEADER_HASH_KEY)
+	if u.config.Hedge && req.Method == http.MethodGet {
+		if delay, ok := u.hedgeDelay(); ok {
+			return u.hedged(req, key, delay)
+		}
+	}
+	endpoint, err := u.pick(key, "")
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := u.try(req, endpoint)
+	return resp, endpoint, err
+}
+
+func (u *upstream) endpoints() ([]string, error) {
+	if len(u.config.Endpoints) > 0 {
+		return u.config.Endpoints, nil
+	}
+	if RESOLVER == nil {
+		return nil, errors.New("apicall: no endpoint for micro://" + u.name)
+	}
+	return RESOLVER(u.name)
+}
+
+// pick choose an endpoint by the strategy, the ejected endpoints and exclude are skipped if possible
+func (u *upstream) pick(key string, exclude string) (string, error) {
+	all, err := u.endpoints()
+	if err != nil {
+		return "", err
+	}
+	if len(all) == 0 {
+		return "", errors.New("apicall: no endpoint for micro://" + u.name)
+	}
+
+	now := time.Now()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	candidates := make([]string, 0, len(all))
+	for _, endpoint := range all {
+		if endpoint != exclude && !u.statsOf(endpoint).ejectedUntil.After(now) {
+			candidates = append(candidates, endpoint)
+		}
+	}
+	if len(candidates) == 0 {
+		// all are ejected, it is better to try than to fail
+		for _, endpoint := range all {
+			if endpoint != exclude {
+				candidates = append(candidates, endpoint)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return exclude, nil
+	}
+
+	n := atomic.AddUint64(&u.counter, 1) - 1
+	switch {
+	case u.config.Strategy == BALANCE_LEAST_IN_FLIGHT:
+		best := ""
+		for i := range candidates {
+			endpoint := candidates[(int(n%uint64(len(candidates)))+i)%len(candidates)]
+			if best == "" || u.statsOf(endpoint).inFlight < u.statsOf(best).inFlight {
+				best = endpoint
+			}
+		}
+		return best, nil
+	case u.config.Strategy == BALANCE_CONSISTENT_HASH && key != "":
+		// rendezvous hashing, only the keys of a removed endpoint move
+		best, bestScore := "", uint64(0)
+		for _, endpoint := range candidates {
+			h := fnv.New64a()
+			h.Write([]byte(key))
+			h.Write([]byte(endpoint))
+			if score := h.Sum64(); best == "" || score > bestScore {
+				best, bestScore = endpoint, score
+			}
+		}
+		return best, nil
+	}
+	return candidates[n%uint64(len(candidates))], nil
+}
+
+func (u *upstream) statsOf(endpoint string) *endpointStats {
+	stats, ok := u.stats[endpoint]
+	if !ok {
+		stats = &endpointStats{}
+		u.stats[endpoint] = stats
+	}
+	return stats
+}
+
+// try send the request to the endpoint and record the result
+// The endpoint is ejected after EjectAfter consecutive failures, an error or a 5xx status is a failure
+func (u *upstream) try(req *http.Request, endpoint string) (*http.Response, error) {
+	r, err := rewrite(req, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	u.mu.Lock()
+	u.statsOf(endpoint).inFlight++
+	u.mu.Unlock()
+	start := time.Now()
+	resp, err := roundTrip(r)
+	latency := time.Since(start)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	stats := u.statsOf(endpoint)
+	stats.inFlight--
+	if errors.Is(err, context.Canceled) {
+		return resp, err
+	}
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		stats.failures++
+		if stats.failures >= u.config.EjectAfter {
+			stats.failures = 0
+			stats.ejectedUntil = time.Now().Add(u.config.EjectDuration)
+		}
+		return resp, err
+	}
+	stats.failures = 0
+	if len(u.latencies) < latencySamples {
+		u.latencies = append(u.latencies, latency)
+	} else {
+		u.latencies[u.next] = latency
+		u.next = (u.next + 1) % latencySamples
+	}
+	return resp, nil
+}
+
+// hedgeDelay returns the latency percentile, it is not known before enough requests succeed
+func (u *upstream) hedgeDelay() (time.Duration, bool) {
+	u.mu.Lock()
+	samples := make([]time.Duration, len(u.latencies))
+	copy(samples, u.latencies)
+	u.mu.Unlock()
+	if len(samples) < minLatencySamples {
+		return 0, false
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	return samples[int(float64(len(samples)-1)*u.config.HedgePercentile)], true
+}
+
+type hedgeResult struct {
+	resp     *http.Response
+	endpoint string
+	err      error
+	cancel   context.CancelFunc
+}
+
+// hedged send the GET to an endpoint, and to another if there is no response after the delay
+// The first successful response wins, the other request is cancelled
+func (u *upstream) hedged(req *http.Request, key string, delay time.Duration) (*http.Response, string, error) {
+	first, err := u.pick(key, "")
+	if err != nil {
+		return nil, "", err
+	}
+	results := make(chan hedgeResult, 2)
+	cancels := make(map[string]context.CancelFunc)
+	launch := func(endpoint string) {
+		ctx, cancel := context.WithCancel(req.Context())
+		cancels[endpoint] = cancel
+		go func() {
+			resp, err := u.try(req.WithContext(ctx), endpoint)
+			results <- hedgeResult{resp: resp, endpoint: endpoint, err: err, cancel: cancel}
+		}()
+	}
+	launch(first)
+	pending := 1
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if second, err := u.pick(key, first); err == nil && second != first {
+				launch(second)
+				pending++
+			}
+		case r := <-results:
+			pending--
+			if pending > 0 && (r.err != nil || r.resp.StatusCode >= http.StatusInternalServerError) {
+				closeResponse(r)
+				continue
+			}
+			for endpoint, cancel := range cancels {
+				if endpoint != r.endpoint {
+					cancel()
+				}
+			}
+			go func(pending int) {
+				for ; pending > 0; pending-- {
+					closeResponse(<-results)
+				}
+			}(pending)
+			if r.err != nil {
+				r.cancel()
+				return nil, r.endpoint, r.err
+			}
+			r.resp.Body = &cancelBody{ReadCloser: r.resp.Body, cancel: r.cancel}
+			return r.resp, r.endpoint, nil
+		}
+	}
+}
+
+func closeResponse(r hedgeResult) {
+	if r.resp != nil {
+		r.resp.Body.Close()
+	}
+	r.cancel()
+}
+
+// roundTrip sign the request by SIGNER and send it by HTTP_CLIENT
+func roundTrip(req *http.Request) (*http.Response, error) {
+	if SIGNER != nil {
+		if err := SIGNER(req); err != nil {
+			return nil, err
+		}
+	}
+	return HTTP_CLIENT.Do(req)
+}
+
+// cancelBody cancel the context of the request when the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// rewrite returns the request to the endpoint, the path of the endpoint is kept as the prefix
+func rewrite(req *http.Request, endpoint string) (*http.Request, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.URL.Scheme = u.Scheme
+	r.URL.Host = u.Host
+	r.URL.Path = strings.TrimSuffix(u.Path, "/") + req.URL.Path
+	if req.URL.RawPath != "" {
+		// keep the escaped path parameters, e.g. %2F
+		r.URL.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + req.URL.RawPath
+	}
+	r.Host = u.Host
+	if req.GetBody != nil {
+		if r.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
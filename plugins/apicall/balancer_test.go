@@ -0,0 +1,101 @@
+package apicall
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPickRoundRobin(t *testing.T) {
+	u := newUpstream("rr", UpstreamConfig{Endpoints: []string{"a", "b", "c"}})
+	counts := map[string]int{}
+	for i := 0; i < 9; i++ {
+		endpoint, err := u.pick("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[endpoint]++
+	}
+	if counts["a"] != 3 || counts["b"] != 3 || counts["c"] != 3 {
+		t.Errorf("picked %v, want 3 of each", counts)
+	}
+	if endpoint, _ := u.pick("", "a"); endpoint == "a" {
+		t.Error("the excluded endpoint is picked")
+	}
+}
+
+func TestPickConsistentHash(t *testing.T) {
+	u := newUpstream("hash", UpstreamConfig{Endpoints: []string{"a", "b", "c"}, Strategy: BALANCE_CONSISTENT_HASH})
+	picked := map[string]string{}
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprint("user-", i)
+		picked[key], _ = u.pick(key, "")
+		if again, _ := u.pick(key, ""); again != picked[key] {
+			t.Fatalf("key %s moved from %s to %s", key, picked[key], again)
+		}
+	}
+	// only the keys of the removed endpoint move
+	u.config.Endpoints = []string{"a", "b"}
+	for key, before := range picked {
+		after, _ := u.pick(key, "")
+		if before != "c" && after != before {
+			t.Errorf("key %s moved from %s to %s", key, before, after)
+		}
+	}
+}
+
+func TestPickLeastInFlight(t *testing.T) {
+	u := newUpstream("lif", UpstreamConfig{Endpoints: []string{"a", "b"}, Strategy: BALANCE_LEAST_IN_FLIGHT})
+	u.statsOf("a").inFlight = 3
+	for i := 0; i < 4; i++ {
+		if endpoint, _ := u.pick("", ""); endpoint != "b" {
+			t.Errorf("picked %s, want the idle b", endpoint)
+		}
+	}
+}
+
+func TestEjectFailingEndpoint(t *testing.T) {
+	var okCalls, badCalls int32
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&okCalls, 1)
+	}))
+	defer ok.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&badCalls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer bad.Close()
+
+	SetupUpstream("eject", UpstreamConfig{Endpoints: []string{ok.URL, bad.URL}, EjectAfter: 2, EjectDuration: time.Minute})
+	for i := 0; i < 10; i++ {
+		req, _ := NewRequest("GET", "micro://eject/ping").Build()
+		resp, endpoint, err := send(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if endpoint != ok.URL && endpoint != bad.URL {
+			t.Fatalf("endpoint = %s", endpoint)
+		}
+	}
+	if badCalls != 2 || okCalls != 8 {
+		t.Errorf("the failing endpoint got %d calls and the other %d, want it ejected after 2", badCalls, okCalls)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	req, _ := NewRequest("GET", "micro://svc/files/:name").Param("name", "a/b").Build()
+	r, err := rewrite(req, "http://10.0.0.1:8080/base/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.URL.String(); got != "http://10.0.0.1:8080/base/files/a%2Fb" {
+		t.Errorf("url = %s", got)
+	}
+	if r.Host != "10.0.0.1:8080" {
+		t.Errorf("host = %s", r.Host)
+	}
+}
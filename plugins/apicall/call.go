@@ -2,7 +2,8 @@ package apicall
 
 import "github.com/ginger-go/micro"
 
-// GET make a GET request with micro trace standard
+// GET make a GET request with micro trace standard, the params are escaped and added to the query of the url
+// Use NewRequest for the repeated keys, the path parameters and the query structs
 func GET[T any](url string, params map[string]string, headers map[string]string, traceID string, traces []micro.Trace) (*Response[T], error) {
 	return get[T](url, params, headers, traceID, traces)
 }
@@ -17,7 +18,7 @@ func PUT[T any](url string, body interface{}, headers map[string]string, traceID
 	return nonGet[T](url, "PUT", body, headers, traceID, traces)
 }
 
-// DELETE make a DELETE request with micro trace standard
+// DELETE make a DELETE request with micro trace standard, a nil body is not sent
 func DELETE[T any](url string, body interface{}, headers map[string]string, traceID string, traces []micro.Trace) (*Response[T], error) {
 	return nonGet[T](url, "DELETE", body, headers, traceID, traces)
 }
@@ -0,0 +1,36 @@
+package apicall
+
+import (
+	"net/http"
+
+	"github.com/ginger-go/micro"
+)
+
+// ENCODING is the default encoding of the request bodies and the preferred encoding of the responses
+// The binary encodings are opt-in for the services binding them, see UpstreamConfig.Encoding and Request.Encoding
+// The responses are decoded by their Content-Type, so the services answering in json still work
+var ENCODING = micro.MIME_JSON
+
+// SCHEME_MICRO is the scheme of the urls addressed by the logical service name, e.g. micro://auth/micro/token
+const SCHEME_MICRO = "micro"
+
+// RESOLVER resolve the logical service name of the micro:// urls to the base urls of the live instances
+// It is set by the discovery plugin, the instances are balanced by the upstream of the name, see SetupUpstream
+var RESOLVER func(name string) ([]string, error)
+
+// HTTP_CLIENT send the requests, its transport presents the client certificate if the trust plugin sets up the mutual TLS
+var HTTP_CLIENT = http.DefaultClient
+
+// SIGNER sign the requests before they are sent, it is set by the trust plugin
+// It is called for every endpoint tried, after the micro:// url is rewritten to the endpoint
+var SIGNER func(req *http.Request) error
+
+// These are the apicall related error code and message
+const (
+	ERR_CODE_REQUEST_FAILED = "2b6f9d1c-8e47-4a35-b3c2-5d0e7a9f4b18"
+	ERR_MSG_REQUEST_FAILED  = "Request failed"
+)
+
+func init() {
+	micro.RegisterError(ERR_CODE_REQUEST_FAILED, ERR_MSG_REQUEST_FAILED)
+}
@@ -9,6 +9,22 @@ type Response[T any] struct {
 	Success    bool                 `json:"success"`
 	Error      *micro.ResponseError `json:"error,omitempty"`
 	Pagination *sql.Pagination      `json:"pagination,omitempty"`
+	Cursor     *micro.Cursor        `json:"cursor,omitempty"`
 	Data       *T                   `json:"data,omitempty"`
 	Traces     []micro.Trace        `json:"traces,omitempty"`
 }
+
+// Error returns the error of the call, nil if it succeeds
+// The error of the callee is returned as it is, the other failures are ERR_CODE_REQUEST_FAILED
+func Error[T any](resp *Response[T], err error) micro.Error {
+	if err != nil {
+		return micro.NewErrorWithMessage(ERR_CODE_REQUEST_FAILED, err.Error())
+	}
+	if resp.Success {
+		return nil
+	}
+	if resp.Error != nil {
+		return micro.NewErrorWithMessage(resp.Error.Code, resp.Error.Message)
+	}
+	return micro.NewError(ERR_CODE_REQUEST_FAILED)
+}
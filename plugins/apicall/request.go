@@ -0,0 +1,380 @@
+package apicall
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ginger-go/micro"
+)
+
+// Request build a request with micro trace standard, send it by Send
+//
+//	resp, err := apicall.Send[Order](apicall.NewRequest("GET", "micro://order/orders/:id").
+//		Param("id", "42").
+//		QueryStruct(filter).
+//		Trace(ctx.Trace()).
+//		Context(ctx))
+type Request struct {
+	method   string
+	url      string
+	params   map[string]string
+	query    url.Values
+	headers  http.Header
+	body     interface{}
+	hasBody  bool
+	encoding string
+	traceID  string
+	traces   []micro.Trace
+	ctx      context.Context
+	err      error
+}
+
+// NewRequest returns the request builder, the url can be a route template, e.g. http://host/orders/:id/*path
+// The query of the url is kept, the query added by the builder is appended
+func NewRequest(method string, url string) *Request {
+	return &Request{
+		method:  strings.ToUpper(method),
+		url:     url,
+		params:  make(map[string]string),
+		query:   make(map[string][]string),
+		headers: make(http.Header),
+		traces:  make([]micro.Trace, 0),
+		ctx:     context.Background(),
+	}
+}
+
+// Param set the path parameter, :name is replaced by the escaped value, *name by the value with its slashes kept
+func (r *Request) Param(name string, value string) *Request {
+	r.params[name] = value
+	return r
+}
+
+// Query add the values of the key, the key can be repeated
+func (r *Request) Query(key string, values ...string) *Request {
+	for _, v := range values {
+		r.query.Add(key, v)
+	}
+	return r
+}
+
+// QueryValues add the values
+func (r *Request) QueryValues(values url.Values) *Request {
+	for k, vs := range values {
+		r.Query(k, vs...)
+	}
+	return r
+}
+
+// QueryStruct add the fields of the struct by their form tags, as GinRequest binds them
+// The fields without any tag are named by the field name, the zero values and the nil pointers are skipped
+func (r *Request) QueryStruct(v interface{}) *Request {
+	if r.err == nil {
+		r.err = encodeQuery(r.query, reflect.ValueOf(v))
+	}
+	return r
+}
+
+// Header set the header
+func (r *Request) Header(key string, value string) *Request {
+	r.headers.Set(key, value)
+	return r
+}
+
+// Headers set the headers
+func (r *Request) Headers(headers map[string]string) *Request {
+	for k, v := range headers {
+		r.headers.Set(k, v)
+	}
+	return r
+}
+
+// IdempotencyKey set the Idempotency-Key, the retries with the same key run an Idempotent handler once
+func (r *Request) IdempotencyKey(key string) *Request {
+	return r.Header(micro.HEADER_IDEMPOTENCY_KEY, key)
+}
+
+// Body set the body, encoded in the encoding of the request
+// GET and HEAD do not send a body, DELETE sends it only if it is set
+func (r *Request) Body(body interface{}) *Request {
+	r.body = body
+	r.hasBody = true
+	return r
+}
+
+// Encoding set the encoding of the body and the preferred encoding of the response, e.g. micro.MIME_MSGPACK
+// The default is the Encoding of the upstream of a micro:// url, or ENCODING
+func (r *Request) Encoding(mime string) *Request {
+	r.encoding = mime
+	return r
+}
+
+// Trace set the trace id and the traces, e.g. Trace(ctx.Trace())
+func (r *Request) Trace(traceID string, traces []micro.Trace) *Request {
+	r.traceID = traceID
+	if traces != nil {
+		r.traces = traces
+	}
+	return r
+}
+
+// Context set the context of the request, e.g. the micro.Context of the service
+// The request is cancelled with the context, and its deadline is sent in the Micro-Deadline header so the callee stops by it too
+func (r *Request) Context(ctx context.Context) *Request {
+	if ctx != nil {
+		r.ctx = ctx
+	}
+	return r
+}
+
+// Build returns the http request
+func (r *Request) Build() (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return nil, err
+	}
+	if err := fillPath(u, r.params); err != nil {
+		return nil, err
+	}
+	if len(r.query) > 0 {
+		query := u.Query()
+		for k, vs := range r.query {
+			for _, v := range vs {
+				query.Add(k, v)
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	encoding := r.encoding
+	if encoding == "" && u.Scheme == SCHEME_MICRO {
+		encoding = encodingOf(u.Host)
+	} else if encoding == "" {
+		encoding = ENCODING
+	}
+
+	var body []byte
+	switch r.method {
+	case http.MethodGet, http.MethodHead:
+		if r.hasBody {
+			return nil, errors.New("apicall: " + r.method + " request can not have a body")
+		}
+	case http.MethodDelete:
+		if r.hasBody && r.body != nil {
+			if body, err = micro.Marshal(encoding, r.body); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		if body, err = micro.Marshal(encoding, r.body); err != nil {
+			return nil, err
+		}
+	}
+
+	var req *http.Request
+	if body != nil {
+		req, err = http.NewRequestWithContext(r.ctx, r.method, u.String(), bytes.NewReader(body))
+	} else {
+		req, err = http.NewRequestWithContext(r.ctx, r.method, u.String(), nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range r.headers {
+		req.Header[k] = vs
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", encoding)
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", accept(encoding))
+	}
+	tracesStr, _ := json.Marshal(r.traces)
+	req.Header.Set(micro.MICRO_HEADER_TRACE_ID, r.traceID)
+	req.Header.Set(micro.MICRO_HEADER_TRACES, string(tracesStr))
+	if deadline, ok := r.ctx.Deadline(); ok {
+		req.Header.Set(micro.MICRO_HEADER_DEADLINE, micro.FormatDeadline(deadline))
+	}
+	return req, nil
+}
+
+// Send send the request and decode the response
+func Send[T any](r *Request) (*Response[T], error) {
+	req, err := r.Build()
+	if err != nil {
+		return nil, err
+	}
+	return do[T](req, len(r.traces))
+}
+
+// fillPath replace the :name and *name segments of the path by the params
+func fillPath(u *url.URL, params map[string]string) error {
+	if !strings.ContainsAny(u.Path, ":*") {
+		return nil
+	}
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, segment := range segments {
+		if len(segment) < 2 || (segment[0] != ':' && segment[0] != '*') {
+			continue
+		}
+		value, ok := params[segment[1:]]
+		if !ok {
+			return errors.New("apicall: missing path parameter " + segment[1:])
+		}
+		if segment[0] == ':' {
+			segments[i] = url.PathEscape(value)
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(value, "/"), "/")
+		for j := range parts {
+			parts[j] = url.PathEscape(parts[j])
+		}
+		segments[i] = strings.Join(parts, "/")
+	}
+	escaped := strings.Join(segments, "/")
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return err
+	}
+	u.Path = path
+	u.RawPath = escaped
+	return nil
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	queryTagKeys = []string{"json", "uri", "header", "cookie"} // the fields with only these tags are not in the query
+)
+
+// encodeQuery add the fields of the struct to the query, the same way gin maps the form to the struct
+func encodeQuery(query url.Values, v reflect.Value) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("apicall: query struct is %s", v.Type())
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		tag, hasTag := field.Tag.Lookup("form")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			continue
+		}
+		value := field.Type
+		for value.Kind() == reflect.Ptr {
+			value = value.Elem()
+		}
+		if value.Kind() == reflect.Struct && value != timeType && (field.Anonymous || !hasTag) {
+			// the nested structs are flattened
+			if err := encodeQuery(query, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !hasTag {
+			if otherTag(field.Tag) || !field.IsExported() {
+				continue
+			}
+			name = field.Name
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if err := encodeQueryValue(query, name, field, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func otherTag(tag reflect.StructTag) bool {
+	for _, key := range queryTagKeys {
+		if _, ok := tag.Lookup(key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeQueryValue(query url.Values, name string, field reflect.StructField, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	} else if v.IsZero() {
+		return nil
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			for i := 0; i < v.Len(); i++ {
+				s, err := queryString(field, v.Index(i))
+				if err != nil {
+					return err
+				}
+				query.Add(name, s)
+			}
+			return nil
+		}
+	}
+	s, err := queryString(field, v)
+	if err != nil {
+		return err
+	}
+	query.Add(name, s)
+	return nil
+}
+
+// queryString format the value as gin parses it
+func queryString(field reflect.StructField, v reflect.Value) (string, error) {
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		switch format := field.Tag.Get("time_format"); strings.ToLower(format) {
+		case "":
+			return t.Format(time.RFC3339), nil
+		case "unix":
+			return strconv.FormatInt(t.Unix(), 10), nil
+		case "unixnano":
+			return strconv.FormatInt(t.UnixNano(), 10), nil
+		default:
+			return t.Format(format), nil
+		}
+	}
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String(), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	}
+	// gin decodes the other values, e.g. the maps and the tagged structs, from json
+	b, err := json.Marshal(v.Interface())
+	return string(b), err
+}
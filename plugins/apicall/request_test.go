@@ -0,0 +1,84 @@
+package apicall
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ginger-go/micro"
+)
+
+type testBody struct {
+	Name string `json:"name" msgpack:"name"`
+}
+
+func TestRequestEncoding(t *testing.T) {
+	req, err := NewRequest("POST", "http://example.com/orders").Body(testBody{Name: "a"}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := req.Header.Get("Content-Type"); ct != micro.MIME_JSON {
+		t.Errorf("Content-Type = %q, want json by default", ct)
+	}
+	if b, _ := io.ReadAll(req.Body); string(b) != `{"name":"a"}` {
+		t.Errorf("body = %s", b)
+	}
+
+	req, _ = NewRequest("POST", "http://example.com/orders").Encoding(micro.MIME_MSGPACK).Body(testBody{Name: "a"}).Build()
+	if ct := req.Header.Get("Content-Type"); ct != micro.MIME_MSGPACK {
+		t.Errorf("Content-Type = %q, want msgpack of the request", ct)
+	}
+	if accept := req.Header.Get("Accept"); accept != micro.MIME_MSGPACK+", "+micro.MIME_JSON+";q=0.9" {
+		t.Errorf("Accept = %q", accept)
+	}
+	var decoded testBody
+	b, _ := io.ReadAll(req.Body)
+	if err := micro.Unmarshal(micro.MIME_MSGPACK, b, &decoded); err != nil || decoded.Name != "a" {
+		t.Errorf("msgpack body = %+v, %v", decoded, err)
+	}
+
+	SetupUpstream("encoding-test", UpstreamConfig{Endpoints: []string{"http://127.0.0.1:1"}, Encoding: micro.MIME_MSGPACK})
+	req, _ = NewRequest("PUT", "micro://encoding-test/orders").Body(testBody{Name: "a"}).Build()
+	if ct := req.Header.Get("Content-Type"); ct != micro.MIME_MSGPACK {
+		t.Errorf("Content-Type = %q, want msgpack of the upstream", ct)
+	}
+	req, _ = NewRequest("PUT", "micro://other-service/orders").Body(testBody{Name: "a"}).Build()
+	if ct := req.Header.Get("Content-Type"); ct != micro.MIME_JSON {
+		t.Errorf("Content-Type = %q, want json of the other services", ct)
+	}
+}
+
+func TestRequestBuild(t *testing.T) {
+	type filter struct {
+		Status []string  `form:"status"`
+		Since  time.Time `form:"since" time_format:"2006-01-02"`
+		Limit  int       `form:"limit"`
+		Empty  string    `form:"empty"`
+		Body   string    `json:"body"`
+	}
+	req, err := NewRequest("get", "http://example.com/files/:id/*path?keep=1").
+		Param("id", "a/b").
+		Param("path", "/x y/z").
+		QueryStruct(filter{Status: []string{"new", "paid"}, Since: time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC), Limit: 10}).
+		Trace("trace", nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.URL.EscapedPath(); got != "/files/a%2Fb/x%20y/z" {
+		t.Errorf("path = %s", got)
+	}
+	if got := req.URL.RawQuery; got != "keep=1&limit=10&since=2024-05-06&status=new&status=paid" {
+		t.Errorf("query = %s", got)
+	}
+	if req.Header.Get(micro.MICRO_HEADER_TRACE_ID) != "trace" || req.Body != nil {
+		t.Errorf("trace = %q, body = %v", req.Header.Get(micro.MICRO_HEADER_TRACE_ID), req.Body)
+	}
+
+	if _, err := NewRequest("GET", "http://example.com/:id").Build(); err == nil {
+		t.Error("the missing path parameter is not reported")
+	}
+	if _, err := NewRequest("GET", "http://example.com").Body("x").Build(); err == nil {
+		t.Error("the body of GET is not reported")
+	}
+}
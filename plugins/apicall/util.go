@@ -1,80 +1,62 @@
 package apicall
 
 import (
-	"bytes"
-	"encoding/json"
+	"io"
 	"net/http"
 
 	"github.com/ginger-go/micro"
 )
 
 func get[T any](url string, params map[string]string, headers map[string]string, traceID string, traces []micro.Trace) (*Response[T], error) {
-	if headers == nil {
-		headers = make(map[string]string)
-	}
-	headers[micro.MICRO_HEADER_TRACE_ID] = traceID
-	tracesStr, _ := json.Marshal(traces)
-	headers[micro.MICRO_HEADER_TRACES] = string(tracesStr)
-	url += "?"
+	req := NewRequest("GET", url).Headers(headers).Trace(traceID, traces)
 	for k, v := range params {
-		url += k + "=" + v + "&"
-	}
-	url = url[:len(url)-1]
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	for k, v := range headers {
-		req.Header.Set(k, v)
+		req.Query(k, v)
 	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	var response Response[T]
-	err = json.NewDecoder(resp.Body).Decode(&response)
-	if err != nil {
-		return nil, err
-	}
-
-	return &response, nil
+	return Send[T](req)
 }
 
 func nonGet[T any](url string, method string, body interface{}, headers map[string]string, traceID string, traces []micro.Trace) (*Response[T], error) {
-	if headers == nil {
-		headers = make(map[string]string)
-	}
-	headers[micro.MICRO_HEADER_TRACE_ID] = traceID
-	tracesStr, _ := json.Marshal(traces)
-	headers[micro.MICRO_HEADER_TRACES] = string(tracesStr)
-	b, err := json.Marshal(body)
-	if err != nil {
-		return nil, err
+	return Send[T](NewRequest(method, url).Body(body).Headers(headers).Trace(traceID, traces))
+}
+
+// do send the request and decode the response by its Content-Type
+// The endpoint chosen for a micro:// url is recorded in the traces added by the callee
+func do[T any](req *http.Request, sent int) (*Response[T], error) {
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", accept(ENCODING))
 	}
 
-	req, err := http.NewRequest(method, url, bytes.NewReader(b))
+	resp, endpoint, err := send(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
-
-	resp, err := http.DefaultClient.Do(req)
+	b, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
 	var response Response[T]
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	err = micro.Unmarshal(resp.Header.Get("Content-Type"), b, &response)
 	if err != nil {
 		return nil, err
 	}
 
+	if endpoint != "" {
+		for i := sent; i < len(response.Traces); i++ {
+			if response.Traces[i].Instance == "" {
+				response.Traces[i].Instance = endpoint
+			}
+		}
+	}
 	return &response, nil
 }
+
+// accept prefer the encoding and fall back to json
+func accept(encoding string) string {
+	if encoding == micro.MIME_JSON {
+		return micro.MIME_JSON
+	}
+	return encoding + ", " + micro.MIME_JSON + ";q=0.9"
+}
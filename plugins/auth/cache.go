@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// These are the vary functions of micro.CacheConfig by the token of the caller
+
+// VaryByUser vary the cache by the uuid of the caller
+func VaryByUser(c *gin.Context) string {
+	claims := GetClaims(c)
+	if claims == nil {
+		return ""
+	}
+	return claims.UUID
+}
+
+// VaryByWorkspace vary the cache by the workspaces of the caller, the users of the same workspaces share the cache
+func VaryByWorkspace(c *gin.Context) string {
+	claims := GetClaims(c)
+	if claims == nil {
+		return ""
+	}
+	workspaces := append([]string{}, claims.Workspaces...)
+	sort.Strings(workspaces)
+	return strings.Join(workspaces, ",")
+}
+
+// VaryByAuthGroup vary the cache by the auth groups of the caller, the users of the same groups share the cache
+func VaryByAuthGroup(c *gin.Context) string {
+	claims := GetClaims(c)
+	if claims == nil {
+		return ""
+	}
+	groups := append([]string{}, claims.AuthGroup...)
+	sort.Strings(groups)
+	return strings.Join(groups, ",")
+}
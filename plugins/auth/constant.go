@@ -4,10 +4,16 @@ import "github.com/ginger-go/env"
 
 // AUTH_SERVICE_IP is the IP address of the auth service
 // Please set it to the environment variable AUTH_SERVICE_IP
+// It can be micro://{service name} if the discovery plugin is setup
 var AUTH_SERVICE_IP string
 
+// AUTH_SERVICE_ID is the identity of the auth service verified by the trust plugin, its signing key id or its certificate name
+// Please set it to the environment variable AUTH_SERVICE_ID if the trust plugin is setup, the IP of the auth service is not checked then
+var AUTH_SERVICE_ID string
+
 // USAGE_SERVICE_IP is the IP address of the usage service
 // Please set it to the environment variable USAGE_SERVICE_IP
+// It can be micro://{service name} if the discovery plugin is setup
 var USAGE_SERVICE_IP string
 
 // These public pem are used to verify the jwt token
@@ -2,17 +2,18 @@ package auth
 
 import (
 	"log"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ginger-go/micro"
 	"github.com/ginger-go/micro/plugins/jwt"
+	"github.com/ginger-go/micro/plugins/trust"
 )
 
 // Only allow the auth service to access this api
+// The auth service is identified by the trust plugin if it is setup, otherwise by its ip
 func AuthServiceOnly(ctx *gin.Context) {
-	if ctx.ClientIP() != strings.ReplaceAll(strings.ReplaceAll(strings.Split(AUTH_SERVICE_IP, ":")[0], "https://", ""), "http://", "") {
+	if !isAuthService(ctx) {
 		log.Println("AuthServiceOnly: unauthorized access from ip: ", ctx.ClientIP())
 		abortUnauthorized(ctx)
 		return
@@ -191,8 +192,13 @@ func RefreshTokenOnly(ctx *gin.Context) {
 }
 
 // Only allow to access with system token
+// The services trusted by the trust plugin, i.e. with a valid signature or client certificate, are allowed without the token
 func SystemTokenOnly(ctx *gin.Context) {
-	if ctx.ClientIP() == strings.ReplaceAll(strings.ReplaceAll(strings.Split(AUTH_SERVICE_IP, ":")[0], "https://", ""), "http://", "") { // allow auth service to access
+	if isAuthService(ctx) { // allow auth service to access
+		ctx.Next()
+		return
+	}
+	if trust.Enabled() && trust.Caller(ctx) != "" {
 		ctx.Next()
 		return
 	}
@@ -247,11 +253,17 @@ func UsageRequired(ctx *gin.Context) {
 	ctx.Next()
 }
 
-func checkIP(ctx *gin.Context, claims *jwt.Claims) bool {
-	if claims.IP != "" && strings.Split(claims.IP, ":")[0] != ctx.ClientIP() {
-		return false
+// isAuthService returns if the request is from the auth service
+func isAuthService(ctx *gin.Context) bool {
+	if trust.Enabled() {
+		return AUTH_SERVICE_ID != "" && trust.Caller(ctx) == AUTH_SERVICE_ID
 	}
-	return true
+	return micro.MatchHost(AUTH_SERVICE_IP, ctx.ClientIP())
+}
+
+// checkIP returns if the client IP is allowed by the IPs and CIDRs the token is restricted to
+func checkIP(ctx *gin.Context, claims *jwt.Claims) bool {
+	return claims.IP == "" || micro.MatchIP(claims.IP, ctx.ClientIP())
 }
 
 func GetClaims(ctx *gin.Context) *jwt.Claims {
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// These are the key functions of midware.RateLimitConfig by the token of the caller
+// The requests without a valid token are not limited by them, join them with midware.KeyByIP to limit them by IP
+
+// KeyByUser returns the uuid of the caller, e.g. the user, the api token or the system
+func KeyByUser(c *gin.Context) string {
+	claims := GetClaims(c)
+	if claims == nil {
+		return ""
+	}
+	return "user:" + claims.UUID
+}
+
+// KeyByTokenType returns the token type of the caller, e.g. to limit all the api tokens together
+func KeyByTokenType(c *gin.Context) string {
+	claims := GetClaims(c)
+	if claims == nil {
+		return ""
+	}
+	return "token-type:" + claims.TokenType
+}
+
+// KeyByApi returns the api uuid of the route determined by the auth service, or the route if it is not registered
+func KeyByApi(c *gin.Context) string {
+	if apiUUID := GetApiUUID(c); apiUUID != "" {
+		return "api:" + apiUUID
+	}
+	return "api:" + c.Request.Method + " " + c.FullPath()
+}
+
+// KeyByUserOrIP returns the uuid of the caller, or the client IP if there is no valid token
+func KeyByUserOrIP(c *gin.Context) string {
+	if key := KeyByUser(c); key != "" {
+		return key
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// TierByAuthGroup returns the auth groups of the caller as the tiers of midware.RateLimitConfig
+func TierByAuthGroup(c *gin.Context) []string {
+	claims := GetClaims(c)
+	if claims == nil {
+		return nil
+	}
+	return claims.AuthGroup
+}
@@ -107,3 +107,12 @@ func GetApiUUID(c *gin.Context) string {
 	path := c.FullPath()
 	return API_UUID_MAP[method+":"+path]
 }
+
+// GetActor returns the uuid of the caller, it is stamped in the CreatedBy and UpdatedBy of the entities
+func GetActor(c *gin.Context) string {
+	claims := GetClaims(c)
+	if claims == nil {
+		return ""
+	}
+	return claims.UUID
+}
@@ -17,17 +17,21 @@ func SetupAuthService(engine *micro.Engine) {
 	if AUTH_SERVICE_IP == "" {
 		panic("AUTH_SERVICE_IP is not set") // must set AUTH_SERVICE_IP
 	}
+	AUTH_SERVICE_ID = env.String("AUTH_SERVICE_ID", "")
 
 	// This api is called by public to get the system info
-	engine.GinEngine.GET("/micro/info", getSystemInfoHandler, midware.RateLimited(time.Minute, 30))
+	engine.GinEngine.GET("/micro/info", getSystemInfoHandler, micro.RateLimit(engine, midware.RateLimitConfig{Limit: 30, Period: time.Minute}))
 
 	// This api is called by the auth service to update the public pem
 	// The public pem is used to verify the jwt token
-	engine.GinEngine.POST("/micro/token", updatePublicPemHandler, midware.RateLimited(time.Minute, 30), AuthServiceOnly)
+	engine.GinEngine.POST("/micro/token", updatePublicPemHandler, micro.RateLimit(engine, midware.RateLimitConfig{Limit: 30, Period: time.Minute}), AuthServiceOnly)
 
 	// This cron will send the usage to the usage service every minute
 	micro.Cron(engine, "0 * * * * *", sendUsageCron)
 
+	// The caller of the request is stamped in the CreatedBy and UpdatedBy of the entities
+	engine.Actor = GetActor
+
 	// This is init func for initialize the api uuid map
 	initApiMap(engine)
 
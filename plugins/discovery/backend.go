@@ -0,0 +1,10 @@
+package discovery
+
+// Backend is where the instances are registered and resolved
+// The read-only backends, e.g. the static file and DNS SRV, ignore the registration
+type Backend interface {
+	Register(instance *Instance) error
+	Heartbeat(instance *Instance) error // returns an error if the instance is not registered, it is registered again then
+	Deregister(instance *Instance) error
+	Resolve(name string) ([]Instance, error)
+}
@@ -0,0 +1,28 @@
+package discovery
+
+import (
+	"time"
+
+	"github.com/ginger-go/micro"
+)
+
+const (
+	STATUS_UP   = "up"
+	STATUS_DOWN = "down"
+)
+
+// RESOLVE_CACHE_DURATION is how long the instances resolved from the backend are cached
+var RESOLVE_CACHE_DURATION = 5 * time.Second
+
+// These are the discovery related error code and message
+const (
+	ERR_CODE_INSTANCE_NOT_FOUND = "4d8b2f6e-9a13-4c7d-b5e0-1f3a6c8d2e97"
+	ERR_CODE_NO_LIVE_INSTANCE   = "9c1e5a3f-7b24-4d86-a0f9-2e6b8d4c1a53"
+	ERR_MSG_INSTANCE_NOT_FOUND  = "Instance not found"
+	ERR_MSG_NO_LIVE_INSTANCE    = "No live instance of the service"
+)
+
+func init() {
+	micro.RegisterError(ERR_CODE_INSTANCE_NOT_FOUND, ERR_MSG_INSTANCE_NOT_FOUND)
+	micro.RegisterError(ERR_CODE_NO_LIVE_INSTANCE, ERR_MSG_NO_LIVE_INSTANCE)
+}
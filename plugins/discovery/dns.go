@@ -0,0 +1,63 @@
+package discovery
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DNSBackend resolve the instances by the DNS SRV records _{name}._{Proto}.{Domain}
+// e.g. the headless services of kubernetes
+type DNSBackend struct {
+	Domain string // e.g. default.svc.cluster.local
+	Proto  string // default tcp
+	Scheme string // the scheme of the addresses, default http
+
+	// LookupSRV is net.LookupSRV by default
+	LookupSRV func(service, proto, name string) (string, []*net.SRV, error)
+}
+
+func NewDNSBackend(domain string) *DNSBackend {
+	return &DNSBackend{Domain: domain}
+}
+
+func (b *DNSBackend) Register(instance *Instance) error {
+	return nil
+}
+
+func (b *DNSBackend) Heartbeat(instance *Instance) error {
+	return nil
+}
+
+func (b *DNSBackend) Deregister(instance *Instance) error {
+	return nil
+}
+
+func (b *DNSBackend) Resolve(name string) ([]Instance, error) {
+	proto, scheme, lookup := b.Proto, b.Scheme, b.LookupSRV
+	if proto == "" {
+		proto = "tcp"
+	}
+	if scheme == "" {
+		scheme = "http"
+	}
+	if lookup == nil {
+		lookup = net.LookupSRV
+	}
+	_, records, err := lookup(name, proto, b.Domain)
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]Instance, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		address := scheme + "://" + net.JoinHostPort(host, strconv.Itoa(int(record.Port)))
+		instances = append(instances, Instance{
+			ID:         address,
+			SystemName: name,
+			Address:    address,
+			Status:     STATUS_UP,
+		})
+	}
+	return instances, nil
+}
@@ -0,0 +1,36 @@
+package discovery
+
+import "time"
+
+// Instance is a running instance of a service
+type Instance struct {
+	ID            string    `json:"id"`
+	SystemID      string    `json:"system_id"`
+	SystemName    string    `json:"system_name"`
+	Address       string    `json:"address"` // the base url, e.g. http://10.0.0.3:8080
+	Version       string    `json:"version"`
+	Status        string    `json:"status"`
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+}
+
+// Live returns true if the instance is up
+func (i *Instance) Live() bool {
+	return i.Status == "" || i.Status == STATUS_UP
+}
+
+// Match returns true if the name is the system name or the system id of the instance
+func (i *Instance) Match(name string) bool {
+	return i.SystemName == name || i.SystemID == name
+}
+
+type GetInstancesRequest struct {
+	Name string `form:"name"`
+}
+
+type GetInstancesResponse struct {
+	Instances []Instance `json:"instances"`
+}
+
+type DeregisterRequest struct {
+	ID string `json:"id"`
+}
@@ -0,0 +1,73 @@
+package discovery
+
+import (
+	"errors"
+
+	"github.com/ginger-go/micro"
+	"github.com/ginger-go/micro/plugins/apicall"
+)
+
+// RegistryBackend register and resolve the instances with the registry server hosted by HostRegistry
+type RegistryBackend struct {
+	URL     string            // the base url of the registry server
+	Headers map[string]string // e.g. the Authorization header
+}
+
+func NewRegistryBackend(url string, headers map[string]string) *RegistryBackend {
+	return &RegistryBackend{URL: url, Headers: headers}
+}
+
+func (b *RegistryBackend) Register(instance *Instance) error {
+	return b.post("/micro/discovery/register", instance)
+}
+
+func (b *RegistryBackend) Heartbeat(instance *Instance) error {
+	return b.post("/micro/discovery/heartbeat", instance)
+}
+
+func (b *RegistryBackend) Deregister(instance *Instance) error {
+	return b.post("/micro/discovery/deregister", &DeregisterRequest{ID: instance.ID})
+}
+
+func (b *RegistryBackend) Resolve(name string) ([]Instance, error) {
+	resp, err := apicall.GET[GetInstancesResponse](b.URL+"/micro/discovery/instances", map[string]string{
+		"name": name,
+	}, b.headers(), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := responseError(resp.Success, resp.Error); err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, nil
+	}
+	return resp.Data.Instances, nil
+}
+
+func (b *RegistryBackend) post(path string, body interface{}) error {
+	resp, err := apicall.POST[struct{}](b.URL+path, body, b.headers(), "", nil)
+	if err != nil {
+		return err
+	}
+	return responseError(resp.Success, resp.Error)
+}
+
+// headers copy the headers, apicall adds the trace headers to the map
+func (b *RegistryBackend) headers() map[string]string {
+	headers := make(map[string]string, len(b.Headers))
+	for k, v := range b.Headers {
+		headers[k] = v
+	}
+	return headers
+}
+
+func responseError(success bool, err *micro.ResponseError) error {
+	if success {
+		return nil
+	}
+	if err != nil {
+		return errors.New(err.Code + ": " + err.Message)
+	}
+	return errors.New("registry request failed")
+}
@@ -0,0 +1,106 @@
+package discovery
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ginger-go/micro"
+	"github.com/ginger-go/micro/plugins/trust"
+)
+
+// registry keeps the instances in memory, an instance expires if it does not heartbeat within the ttl
+type registry struct {
+	ttl       time.Duration
+	mu        sync.RWMutex
+	instances map[string]*Instance
+}
+
+// HostRegistry host the registry server in the engine, the services register with it by RegistryBackend
+// ttl is the time an instance is kept without heartbeat, default 30 seconds
+// The routes are guarded by the middleware, default trust.CallerOnly(), so only the trusted services register and resolve
+// Setup the signing or the mutual TLS of trust before it if no middleware is given
+func HostRegistry(engine *micro.Engine, ttl time.Duration, middleware ...gin.HandlerFunc) {
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	if len(middleware) == 0 {
+		if !trust.Enabled() {
+			panic("trust is not setup, the registry rejects every service") // must setup trust or give the middleware
+		}
+		middleware = []gin.HandlerFunc{trust.CallerOnly()}
+	}
+	r := &registry{ttl: ttl, instances: make(map[string]*Instance)}
+	micro.POST(engine, "/micro/discovery/register", r.registerHandler, middleware...)
+	micro.POST(engine, "/micro/discovery/heartbeat", r.heartbeatHandler, middleware...)
+	micro.POST(engine, "/micro/discovery/deregister", r.deregisterHandler, middleware...)
+	micro.GET(engine, "/micro/discovery/instances", r.instancesHandler, middleware...)
+}
+
+func (r *registry) registerHandler() micro.HandlerResponse[Instance] {
+	return micro.HandlerResponse[Instance]{
+		Service: func(ctx *micro.Context[Instance]) (interface{}, micro.Error) {
+			instance := *ctx.Request
+			instance.LastHeartbeat = time.Now()
+			r.mu.Lock()
+			r.instances[instance.ID] = &instance
+			r.mu.Unlock()
+			return nil, nil
+		},
+	}
+}
+
+func (r *registry) heartbeatHandler() micro.HandlerResponse[Instance] {
+	return micro.HandlerResponse[Instance]{
+		Service: func(ctx *micro.Context[Instance]) (interface{}, micro.Error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			instance, ok := r.instances[ctx.Request.ID]
+			if !ok || r.expired(instance) {
+				return nil, micro.NewError(ERR_CODE_INSTANCE_NOT_FOUND)
+			}
+			instance.Status = ctx.Request.Status
+			instance.LastHeartbeat = time.Now()
+			return nil, nil
+		},
+	}
+}
+
+func (r *registry) deregisterHandler() micro.HandlerResponse[DeregisterRequest] {
+	return micro.HandlerResponse[DeregisterRequest]{
+		Service: func(ctx *micro.Context[DeregisterRequest]) (interface{}, micro.Error) {
+			r.mu.Lock()
+			delete(r.instances, ctx.Request.ID)
+			r.mu.Unlock()
+			return nil, nil
+		},
+	}
+}
+
+func (r *registry) instancesHandler() micro.HandlerResponse[GetInstancesRequest] {
+	return micro.HandlerResponse[GetInstancesRequest]{
+		Service: func(ctx *micro.Context[GetInstancesRequest]) (interface{}, micro.Error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			instances := make([]Instance, 0)
+			for id, instance := range r.instances {
+				if r.expired(instance) {
+					delete(r.instances, id)
+					continue
+				}
+				if ctx.Request.Name == "" || instance.Match(ctx.Request.Name) {
+					instances = append(instances, *instance)
+				}
+			}
+			sort.Slice(instances, func(i, j int) bool {
+				return instances[i].ID < instances[j].ID
+			})
+			return &GetInstancesResponse{Instances: instances}, nil
+		},
+	}
+}
+
+func (r *registry) expired(instance *Instance) bool {
+	return time.Since(instance.LastHeartbeat) > r.ttl
+}
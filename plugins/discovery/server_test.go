@@ -0,0 +1,61 @@
+package discovery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ginger-go/micro"
+	"github.com/ginger-go/micro/plugins/trust"
+)
+
+func TestHostRegistryWithoutTrust(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if trust.Enabled() {
+		t.Skip("trust is setup in this process")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("HostRegistry without trust and middleware does not panic")
+		}
+	}()
+	HostRegistry(micro.NewEngine("registry", "registry"), 0)
+}
+
+func TestHostRegistryTrustedCallersOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("MICRO_SIGNING_KEY_ID", "order")
+	t.Setenv("MICRO_SIGNING_SECRET", "order-secret")
+	t.Setenv("MICRO_SIGNING_KEYS", "order=order-secret")
+	engine := micro.NewEngine("registry", "registry")
+	trust.SetupSigning(engine)
+	HostRegistry(engine, 0)
+	server := httptest.NewServer(engine.GinEngine)
+	defer server.Close()
+
+	// the unsigned requests are rejected
+	resp, err := http.Post(server.URL+"/micro/discovery/register", micro.MIME_JSON, strings.NewReader(`{"id":"evil","system_name":"order","address":"http://evil"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unsigned register: status %d, want 401", resp.StatusCode)
+	}
+
+	// the requests signed by apicall are trusted
+	backend := NewRegistryBackend(server.URL, nil)
+	instance := &Instance{ID: "order-1", SystemID: "order", SystemName: "order", Address: "http://10.0.0.3:8080"}
+	if err := backend.Register(instance); err != nil {
+		t.Fatal(err)
+	}
+	instances, err := backend.Resolve("order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances[0].ID != "order-1" {
+		t.Errorf("instances = %+v, want only the trusted one", instances)
+	}
+}
@@ -0,0 +1,142 @@
+package discovery
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ginger-go/micro"
+	"github.com/ginger-go/micro/plugins/apicall"
+	"github.com/google/uuid"
+)
+
+// Config is the setting of the instance registered by SetupDiscovery
+type Config struct {
+	Address           string        // the base url of this instance, e.g. http://10.0.0.3:8080
+	Version           string        // the version of the service
+	HeartbeatInterval time.Duration // default 10 seconds
+	HealthCheck       func() bool   // the instance is reported down if it returns false
+}
+
+var (
+	backend  Backend
+	instance *Instance
+)
+
+// Setup the discovery
+// Call this function in every service's main.go, the engine is registered with the backend and heartbeats
+// The micro://{name} urls of apicall are resolved by the backend after it
+func SetupDiscovery(engine *micro.Engine, b Backend, config Config) *Instance {
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = 10 * time.Second
+	}
+	backend = b
+	instance = &Instance{
+		ID:         uuid.NewString(),
+		SystemID:   engine.SystemID,
+		SystemName: engine.SystemName,
+		Address:    config.Address,
+		Version:    config.Version,
+		Status:     STATUS_UP,
+	}
+
+	// The services are resolved by the backend in apicall
+	apicall.RESOLVER = Addresses
+
+	// Register this instance, it is registered again by the heartbeat if the backend is not ready
+	if err := backend.Register(instance); err != nil {
+		log.Println("failed to register instance", err)
+	}
+
+	// This cron will send the heartbeat and the health of this instance
+	// The instance is copied per tick, it is read by Deregister in the other goroutines
+	micro.Cron(engine, "@every "+config.HeartbeatInterval.String(), func() {
+		current := *instance
+		current.Status = STATUS_UP
+		if config.HealthCheck != nil && !config.HealthCheck() {
+			current.Status = STATUS_DOWN
+		}
+		if err := backend.Heartbeat(&current); err != nil {
+			if err := backend.Register(&current); err != nil {
+				log.Println("failed to register instance", err)
+			}
+		}
+	})
+	return instance
+}
+
+// Deregister remove this instance from the backend, call it before the service shuts down
+func Deregister() error {
+	if backend == nil || instance == nil {
+		return nil
+	}
+	return backend.Deregister(instance)
+}
+
+type cachedInstances struct {
+	instances []Instance
+	expireAt  time.Time
+}
+
+var (
+	resolveCache sync.Map // name to cachedInstances
+	counters     sync.Map // name to *uint64, for the round robin
+)
+
+// Instances returns the live instances of the service, cached for RESOLVE_CACHE_DURATION
+// The cached instances are used if the backend is not reachable
+func Instances(name string) ([]Instance, error) {
+	cached, ok := resolveCache.Load(name)
+	if ok && cached.(*cachedInstances).expireAt.After(time.Now()) {
+		return cached.(*cachedInstances).instances, nil
+	}
+	if backend == nil {
+		return nil, micro.NewError(ERR_CODE_NO_LIVE_INSTANCE)
+	}
+	all, err := backend.Resolve(name)
+	if err != nil {
+		if ok {
+			return cached.(*cachedInstances).instances, nil
+		}
+		return nil, err
+	}
+	instances := make([]Instance, 0, len(all))
+	for _, i := range all {
+		if i.Live() {
+			instances = append(instances, i)
+		}
+	}
+	resolveCache.Store(name, &cachedInstances{
+		instances: instances,
+		expireAt:  time.Now().Add(RESOLVE_CACHE_DURATION),
+	})
+	return instances, nil
+}
+
+// Addresses returns the addresses of the live instances of the service
+func Addresses(name string) ([]string, error) {
+	instances, err := Instances(name)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, len(instances))
+	for i, instance := range instances {
+		addresses[i] = instance.Address
+	}
+	return addresses, nil
+}
+
+// Resolve returns the address of a live instance of the service, the instances are picked in turn
+func Resolve(name string) (string, error) {
+	instances, err := Instances(name)
+	if err != nil {
+		return "", err
+	}
+	if len(instances) == 0 {
+		return "", micro.NewError(ERR_CODE_NO_LIVE_INSTANCE)
+	}
+	counter, _ := counters.LoadOrStore(name, new(uint64))
+	n := atomic.AddUint64(counter.(*uint64), 1)
+	return instances[(n-1)%uint64(len(instances))].Address, nil
+}
@@ -0,0 +1,63 @@
+package discovery
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// StaticBackend resolve the instances listed in a json file, the file is reloaded when it is modified
+//
+//	[{"system_name": "auth", "address": "http://10.0.0.2:8080"}]
+type StaticBackend struct {
+	Path string
+
+	mu        sync.Mutex
+	modTime   time.Time
+	instances []Instance
+}
+
+func NewStaticBackend(path string) *StaticBackend {
+	return &StaticBackend{Path: path}
+}
+
+func (b *StaticBackend) Register(instance *Instance) error {
+	return nil
+}
+
+func (b *StaticBackend) Heartbeat(instance *Instance) error {
+	return nil
+}
+
+func (b *StaticBackend) Deregister(instance *Instance) error {
+	return nil
+}
+
+func (b *StaticBackend) Resolve(name string) ([]Instance, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	info, err := os.Stat(b.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.ModTime().Equal(b.modTime) {
+		data, err := os.ReadFile(b.Path)
+		if err != nil {
+			return nil, err
+		}
+		var instances []Instance
+		if err := json.Unmarshal(data, &instances); err != nil {
+			return nil, err
+		}
+		b.instances = instances
+		b.modTime = info.ModTime()
+	}
+	result := make([]Instance, 0)
+	for _, instance := range b.instances {
+		if instance.Match(name) {
+			result = append(result, instance)
+		}
+	}
+	return result, nil
+}
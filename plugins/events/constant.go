@@ -0,0 +1,29 @@
+package events
+
+import (
+	"time"
+
+	"github.com/ginger-go/micro"
+)
+
+// EVENT_SERVICE_IP is the IP address of the event service, the registry of the subscriptions
+// Please set it to the environment variable EVENT_SERVICE_IP
+// It can be micro://{service name} if the discovery plugin is setup
+var EVENT_SERVICE_IP string
+
+// EVENT_QUEUE is the job queue of the async and remote deliveries
+// The failed deliveries are retried, and moved to the dead letter after the max attempts of the queue
+const EVENT_QUEUE = "micro.events"
+
+// SUBSCRIBERS_CACHE_DURATION is how long the subscribers from the registry are cached
+var SUBSCRIBERS_CACHE_DURATION = time.Minute
+
+// These are the event related error code and message
+const (
+	ERR_CODE_EVENT_FAILED = "e1c7a9d4-3b62-4f8e-a5d0-9c4b2e7f1a86"
+	ERR_MSG_EVENT_FAILED  = "Failed to handle the event"
+)
+
+func init() {
+	micro.RegisterError(ERR_CODE_EVENT_FAILED, ERR_MSG_EVENT_FAILED)
+}
@@ -0,0 +1,224 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ginger-go/micro"
+	"github.com/google/uuid"
+)
+
+// Handler handles an event, returning an error fails the delivery
+// The sync handlers fail the Publish, the async and remote deliveries are retried
+type Handler[T any] func(event *Event[T]) error
+
+// SubscribeConfig is the setting of a subscriber
+type SubscribeConfig struct {
+	Name  string // identify the subscriber in the queued deliveries, default {topic}#{n}
+	Async bool   // handle the event in EVENT_QUEUE instead of in Publish, with retries and dead letter
+}
+
+// Topic is implemented by the events to name their topic
+// The topic of the other events is the name of the type, so the services sharing the event need the same type name
+type Topic interface {
+	Topic() string
+}
+
+type subscriber struct {
+	name   string
+	async  bool
+	handle func(message *Message, traceID string) error
+}
+
+// registry keeps the subscribers of an engine
+type registry struct {
+	mu          sync.RWMutex
+	subscribers map[string][]*subscriber // topic to subscribers
+	byName      map[string]*subscriber
+	count       int
+}
+
+var registries sync.Map // engine to registry
+
+func registryOf(engine *micro.Engine) *registry {
+	if r, ok := registries.Load(engine); ok {
+		return r.(*registry)
+	}
+	r, _ := registries.LoadOrStore(engine, &registry{
+		subscribers: make(map[string][]*subscriber),
+		byName:      make(map[string]*subscriber),
+	})
+	return r.(*registry)
+}
+
+// Subscribe register the handler of the event T in the engine, the events published by the other engines are not handled
+// The subscriptions are sent to the registry by SetupEventService, so subscribe before it
+// Call unsubscribe to remove the handler, its queued deliveries are dropped
+func Subscribe[T any](engine *micro.Engine, handler Handler[T], config ...SubscribeConfig) (unsubscribe func()) {
+	topic := TopicOf[T]()
+	c := SubscribeConfig{}
+	if len(config) > 0 {
+		c = config[0]
+	}
+
+	r := registryOf(engine)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c.Name == "" {
+		c.Name = topic + "#" + strconv.Itoa(r.count)
+	}
+	r.count++
+	s := &subscriber{
+		name:  c.Name,
+		async: c.Async,
+		handle: func(message *Message, traceID string) error {
+			data := new(T)
+			if err := json.Unmarshal(message.Payload, data); err != nil {
+				return err
+			}
+			return handler(&Event[T]{
+				ID:      message.ID,
+				Topic:   message.Topic,
+				Source:  message.Source,
+				TraceID: traceID,
+				Time:    message.Time,
+				Data:    data,
+			})
+		},
+	}
+	r.subscribers[topic] = append(r.subscribers[topic], s)
+	r.byName[s.name] = s
+	if c.Async {
+		setupQueue(engine)
+	}
+	return func() {
+		r.unsubscribe(topic, s)
+	}
+}
+
+func (r *registry) unsubscribe(topic string, s *subscriber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]*subscriber, 0, len(r.subscribers[topic]))
+	for _, other := range r.subscribers[topic] {
+		if other != s {
+			list = append(list, other)
+		}
+	}
+	if len(list) == 0 {
+		delete(r.subscribers, topic)
+	} else {
+		r.subscribers[topic] = list
+	}
+	if r.byName[s.name] == s {
+		delete(r.byName, s.name)
+	}
+}
+
+// Publish dispatch the event to the subscribers in this service, and to the subscribing services if the event service is setup
+// The errors of the sync subscribers are returned, the async and remote deliveries are queued
+func Publish[T any](engine *micro.Engine, traceID string, data *T) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	message := &Message{
+		ID:      uuid.NewString(),
+		Topic:   TopicOf[T](),
+		Source:  engine.SystemID,
+		Time:    time.Now(),
+		Payload: payload,
+	}
+	err = dispatch(engine, message, traceID)
+	if EVENT_SERVICE_IP == "" {
+		return err
+	}
+	for _, s := range getSubscribers(message.Topic, traceID) {
+		if s.SystemID == engine.SystemID {
+			continue
+		}
+		if qErr := micro.Enqueue(engine, EVENT_QUEUE, traceID, &remoteDelivery{Address: s.Address, Message: *message}); qErr != nil {
+			err = errors.Join(err, qErr)
+		}
+	}
+	return err
+}
+
+// TopicOf returns the topic of the event T
+func TopicOf[T any]() string {
+	var event T
+	if t, ok := any(event).(Topic); ok {
+		return t.Topic()
+	}
+	if t, ok := any(&event).(Topic); ok {
+		return t.Topic()
+	}
+	return reflect.TypeOf(event).Name()
+}
+
+// DeadEvents list the deliveries in the dead letter of EVENT_QUEUE, requeue them by micro.RequeueDeadJob
+func DeadEvents(engine *micro.Engine) ([]micro.JobRecord, error) {
+	return micro.DeadJobs(engine, EVENT_QUEUE)
+}
+
+// dispatch call the sync subscribers and queue the async subscribers of the message
+func dispatch(engine *micro.Engine, message *Message, traceID string) error {
+	r := registryOf(engine)
+	r.mu.RLock()
+	list := r.subscribers[message.Topic]
+	r.mu.RUnlock()
+
+	var err error
+	for _, s := range list {
+		if s.async {
+			if qErr := micro.Enqueue(engine, EVENT_QUEUE, traceID, &localDelivery{Subscriber: s.name, Message: *message}); qErr != nil {
+				err = errors.Join(err, qErr)
+			}
+			continue
+		}
+		if hErr := s.handle(message, traceID); hErr != nil {
+			err = errors.Join(err, hErr)
+		}
+	}
+	return err
+}
+
+// topics returns the topics subscribed in the engine
+func topics(engine *micro.Engine) []string {
+	r := registryOf(engine)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]string, 0, len(r.subscribers))
+	for topic := range r.subscribers {
+		list = append(list, topic)
+	}
+	return list
+}
+
+var queueEngines sync.Map
+
+// setupQueue register the job handlers of the deliveries in the engine once
+func setupQueue(engine *micro.Engine) {
+	if _, loaded := queueEngines.LoadOrStore(engine, true); loaded {
+		return
+	}
+	r := registryOf(engine)
+	micro.HandleJob(engine, EVENT_QUEUE, func(job *micro.Job[localDelivery]) error {
+		r.mu.RLock()
+		s, ok := r.byName[job.Payload.Subscriber]
+		r.mu.RUnlock()
+		if !ok {
+			log.Println("the subscriber is gone, the event is dropped", job.Payload.Subscriber, job.Payload.Message.ID)
+			return nil
+		}
+		return s.handle(&job.Payload.Message, job.TraceID)
+	})
+	micro.HandleJob(engine, EVENT_QUEUE, func(job *micro.Job[remoteDelivery]) error {
+		return sendEvent(job.Payload.Address, &job.Payload.Message, job.TraceID)
+	})
+}
@@ -0,0 +1,185 @@
+package events
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ginger-go/micro"
+	_ "github.com/ginger-go/micro/internal/testenv"
+)
+
+type testCreated struct {
+	Name string
+}
+
+type testRenamed struct {
+	Name string
+}
+
+func (testRenamed) Topic() string {
+	return "test.renamed"
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTopicOf(t *testing.T) {
+	if topic := TopicOf[testCreated](); topic != "testCreated" {
+		t.Fatalf("topic %q, want testCreated", topic)
+	}
+	if topic := TopicOf[testRenamed](); topic != "test.renamed" {
+		t.Fatalf("topic %q, want test.renamed", topic)
+	}
+}
+
+func TestPublishSync(t *testing.T) {
+	engine := micro.NewEngine("events-sync", "events")
+	var got *Event[testCreated]
+	Subscribe(engine, func(event *Event[testCreated]) error {
+		got = event
+		return nil
+	})
+	failure := errors.New("failed")
+	Subscribe(engine, func(event *Event[testRenamed]) error {
+		return failure
+	})
+
+	if err := Publish(engine, "trace", &testCreated{Name: "ada"}); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Data.Name != "ada" || got.TraceID != "trace" || got.Source != "events-sync" || got.Topic != "testCreated" {
+		t.Fatalf("event %+v", got)
+	}
+	if err := Publish(engine, "trace", &testRenamed{Name: "ada"}); !errors.Is(err, failure) {
+		t.Fatalf("error %v, want the error of the sync subscriber", err)
+	}
+}
+
+func TestSubscribeScopedByEngine(t *testing.T) {
+	first := micro.NewEngine("events-first", "events")
+	second := micro.NewEngine("events-second", "events")
+	var firstCalls, secondCalls int
+	Subscribe(first, func(event *Event[testCreated]) error {
+		firstCalls++
+		return nil
+	})
+	Subscribe(second, func(event *Event[testCreated]) error {
+		secondCalls++
+		return nil
+	})
+
+	if err := Publish(first, "trace", &testCreated{}); err != nil {
+		t.Fatal(err)
+	}
+	if firstCalls != 1 || secondCalls != 0 {
+		t.Fatalf("calls %d and %d, want 1 and 0", firstCalls, secondCalls)
+	}
+	if list := topics(second); len(list) != 1 || list[0] != "testCreated" {
+		t.Fatalf("topics %v", list)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	engine := micro.NewEngine("events-unsubscribe", "events")
+	var kept, removed int
+	Subscribe(engine, func(event *Event[testCreated]) error {
+		kept++
+		return nil
+	})
+	unsubscribe := Subscribe(engine, func(event *Event[testCreated]) error {
+		removed++
+		return nil
+	})
+
+	Publish(engine, "trace", &testCreated{})
+	unsubscribe()
+	Publish(engine, "trace", &testCreated{})
+	if kept != 2 || removed != 1 {
+		t.Fatalf("calls %d and %d, want 2 and 1", kept, removed)
+	}
+
+	unsubscribe = Subscribe(engine, func(event *Event[testRenamed]) error { return nil })
+	unsubscribe()
+	if list := topics(engine); len(list) != 1 || list[0] != "testCreated" {
+		t.Fatalf("topics %v, want the unsubscribed topic removed", list)
+	}
+}
+
+func TestPublishAsyncRetry(t *testing.T) {
+	engine := micro.NewEngine("events-async", "events")
+	micro.SetupQueue(engine, EVENT_QUEUE, micro.QueueConfig{
+		PollInterval: 5 * time.Millisecond,
+		MaxAttempts:  2,
+		Backoff:      func(int) time.Duration { return 0 },
+	})
+	var attempts, delivered int32
+	Subscribe(engine, func(event *Event[testCreated]) error {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return errors.New("failed")
+		}
+		atomic.AddInt32(&delivered, 1)
+		return nil
+	}, SubscribeConfig{Async: true})
+	Subscribe(engine, func(event *Event[testRenamed]) error {
+		return errors.New("failed")
+	}, SubscribeConfig{Name: "renamed", Async: true})
+
+	if err := Publish(engine, "trace", &testCreated{Name: "ada"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Publish(engine, "trace", &testRenamed{Name: "ada"}); err != nil {
+		t.Fatalf("error %v, want the async failure not returned", err)
+	}
+	if atomic.LoadInt32(&attempts) != 0 {
+		t.Fatal("the async subscriber is called in Publish")
+	}
+	engine.RunCronOnly()
+
+	waitFor(t, func() bool { return atomic.LoadInt32(&delivered) == 1 })
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Fatalf("attempts %d, want 2", n)
+	}
+	waitFor(t, func() bool {
+		dead, err := DeadEvents(engine)
+		return err == nil && len(dead) == 1
+	})
+}
+
+func TestUnsubscribeDropsQueued(t *testing.T) {
+	engine := micro.NewEngine("events-dropped", "events")
+	micro.SetupQueue(engine, EVENT_QUEUE, micro.QueueConfig{PollInterval: 5 * time.Millisecond})
+	var calls, after int32
+	unsubscribe := Subscribe(engine, func(event *Event[testCreated]) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}, SubscribeConfig{Async: true})
+	Subscribe(engine, func(event *Event[testRenamed]) error {
+		atomic.AddInt32(&after, 1)
+		return nil
+	}, SubscribeConfig{Async: true})
+
+	Publish(engine, "trace", &testCreated{})
+	unsubscribe()
+	Publish(engine, "trace", &testRenamed{})
+	engine.RunCronOnly()
+
+	// the queue runs one job at a time in order, so the dropped delivery is done before the next one
+	waitFor(t, func() bool { return atomic.LoadInt32(&after) == 1 })
+	dead, err := DeadEvents(engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 || len(dead) != 0 {
+		t.Fatalf("calls %d and dead %d, want the delivery dropped", n, len(dead))
+	}
+}
@@ -0,0 +1,23 @@
+package events
+
+import (
+	"log"
+
+	"github.com/ginger-go/micro"
+)
+
+// receiveEventHandler dispatch the event from the other services to the subscribers
+// An error makes the publisher retry the delivery
+func receiveEventHandler(engine *micro.Engine) micro.Handler[Message] {
+	return func() micro.HandlerResponse[Message] {
+		return micro.HandlerResponse[Message]{
+			Service: func(ctx *micro.Context[Message]) (interface{}, micro.Error) {
+				if err := dispatch(engine, ctx.Request, ctx.TraceID); err != nil {
+					log.Println("failed to handle event", ctx.Request.Topic, ctx.Request.ID, err)
+					return nil, micro.NewError(ERR_CODE_EVENT_FAILED)
+				}
+				return nil, nil
+			},
+		}
+	}
+}
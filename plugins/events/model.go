@@ -0,0 +1,58 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ginger-go/micro/plugins/auth"
+)
+
+// Event is the event passed to the subscribers
+type Event[T any] struct {
+	ID      string
+	Topic   string
+	Source  string // the system id of the publisher
+	TraceID string
+	Time    time.Time
+	Data    *T
+}
+
+// Message is the form of an event between the services
+type Message struct {
+	ID      string          `json:"id"`
+	Topic   string          `json:"topic"`
+	Source  string          `json:"source"`
+	Time    time.Time       `json:"time"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type Subscriber struct {
+	SystemID string `json:"system_id"`
+	Address  string `json:"address"`
+}
+
+type RegisterSubscriptionsRequest struct {
+	SystemInfo *auth.SystemInfo `json:"system_info"`
+	Address    string           `json:"address"`
+	Topics     []string         `json:"topics"`
+}
+
+type GetSubscribersRequest struct {
+	Topic string `form:"topic"`
+}
+
+type GetSubscribersResponse struct {
+	Subscribers []Subscriber `json:"subscribers"`
+}
+
+// localDelivery is the job of an async subscriber
+type localDelivery struct {
+	Subscriber string  `json:"subscriber"`
+	Message    Message `json:"message"`
+}
+
+// remoteDelivery is the job of a subscribing service
+type remoteDelivery struct {
+	Address string  `json:"address"`
+	Message Message `json:"message"`
+}
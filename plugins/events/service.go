@@ -0,0 +1,79 @@
+package events
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ginger-go/micro"
+	"github.com/ginger-go/micro/plugins/apicall"
+	"github.com/ginger-go/micro/plugins/auth"
+)
+
+// service will send the subscribed topics to the event service at the beginning
+func registerSubscriptions(engine *micro.Engine, address string) {
+	resp, err := apicall.POST[struct{}](EVENT_SERVICE_IP+"/micro/event-subscriptions", &RegisterSubscriptionsRequest{
+		SystemInfo: &auth.SystemInfo{
+			UUID: auth.SYSTEM_ID,
+			Name: auth.SYSTEM_NAME,
+		},
+		Address: address,
+		Topics:  topics(engine),
+	}, map[string]string{
+		"Authorization": "Bearer " + auth.SYSTEM_TOKEN,
+	}, "", nil)
+	if err != nil || !resp.Success {
+		panic("failed to register event subscriptions")
+	}
+}
+
+type cachedSubscribers struct {
+	subscribers []Subscriber
+	expireAt    time.Time
+}
+
+var subscribersCache sync.Map // topic to cachedSubscribers
+
+// getSubscribers get the subscribing services of the topic from the event service, cached for SUBSCRIBERS_CACHE_DURATION
+// The cached subscribers are used if the event service is not reachable
+func getSubscribers(topic string, traceID string) []Subscriber {
+	cached, ok := subscribersCache.Load(topic)
+	if ok && cached.(*cachedSubscribers).expireAt.After(time.Now()) {
+		return cached.(*cachedSubscribers).subscribers
+	}
+	resp, err := apicall.GET[GetSubscribersResponse](EVENT_SERVICE_IP+"/micro/event-subscribers", map[string]string{
+		"topic": topic,
+	}, map[string]string{
+		"Authorization": "Bearer " + auth.SYSTEM_TOKEN,
+	}, traceID, nil)
+	if err != nil || !resp.Success || resp.Data == nil {
+		log.Println("failed to get event subscribers", topic, err)
+		if ok {
+			return cached.(*cachedSubscribers).subscribers
+		}
+		return nil
+	}
+	subscribersCache.Store(topic, &cachedSubscribers{
+		subscribers: resp.Data.Subscribers,
+		expireAt:    time.Now().Add(SUBSCRIBERS_CACHE_DURATION),
+	})
+	return resp.Data.Subscribers
+}
+
+// sendEvent post the message to the subscribing service, the trace is propagated
+func sendEvent(address string, message *Message, traceID string) error {
+	resp, err := apicall.POST[struct{}](address+"/micro/events", message, map[string]string{
+		"Authorization": "Bearer " + auth.SYSTEM_TOKEN,
+	}, traceID, []micro.Trace{})
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		if resp.Error != nil {
+			return errors.New(resp.Error.Code + ": " + resp.Error.Message)
+		}
+		return errors.New(ERR_MSG_EVENT_FAILED)
+	}
+	return nil
+}
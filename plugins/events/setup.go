@@ -0,0 +1,27 @@
+package events
+
+import (
+	"github.com/ginger-go/env"
+	"github.com/ginger-go/micro"
+	"github.com/ginger-go/micro/plugins/auth"
+)
+
+// Setup the event service
+// Call this function in the service's main.go after the subscriptions, the events are only dispatched in-process without it
+// address is the base url of this service called by the publishers, e.g. http://order-service:8080
+func SetupEventService(engine *micro.Engine, address string) {
+	// Setup event service ip
+	EVENT_SERVICE_IP = env.String("EVENT_SERVICE_IP", "")
+	if EVENT_SERVICE_IP == "" {
+		panic("EVENT_SERVICE_IP is not set") // must set EVENT_SERVICE_IP
+	}
+
+	// This is the queue of the async and remote deliveries
+	setupQueue(engine)
+
+	// This api is called by the other services to deliver the events
+	micro.POST(engine, "/micro/events", receiveEventHandler(engine), auth.SystemTokenOnly)
+
+	// This is init func for registering the subscriptions to the event service
+	registerSubscriptions(engine, address)
+}
@@ -4,7 +4,7 @@ package jwt
 type Claims struct {
 	UUID       string                 `json:"uuid"`
 	Name       string                 `json:"name"`
-	IP         string                 `json:"ip"`
+	IP         string                 `json:"ip"`          // restrict the token to the comma separated IPs and CIDRs, e.g. 10.0.0.0/8,2001:db8::1
 	IsRoot     bool                   `json:"is_root"`     // root user is the billed user
 	IsAdmin    bool                   `json:"is_admin"`    // admin user is the user who can manage the system (non-client)
 	TokenType  string                 `json:"token_type"`  // system-token, access-token, refresh-token, api-token
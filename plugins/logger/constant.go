@@ -2,6 +2,7 @@ package logger
 
 // LOG_SERVICE_IP is the IP address of the auth service
 // Please set it to the environment variable LOG_SERVICE_IP
+// It can be micro://{service name} if the discovery plugin is setup
 var LOG_SERVICE_IP string
 
 // This is the folder where the logs will be stored
@@ -1,5 +1,10 @@
 package logger
 
+import (
+	"github.com/ginger-go/micro"
+	"github.com/ginger-go/micro/plugins/auth"
+)
+
 // Info logs the information should be logged
 func Info(systemID, apiUUID, traceID string, v ...any) {
 	stdLogger := getStdLogger()
@@ -29,3 +34,8 @@ func Debug(systemID, apiUUID, traceID string, v ...any) {
 	stdLogger := getStdLogger()
 	print(stdLogger, systemID, apiUUID, traceID, LOG_LEVEL_DEBUG, v...)
 }
+
+// Crash logs the panic of a request with its stack, set it to Engine.CrashLogger, SetupLogService does it
+func Crash(crash micro.Crash) {
+	Fatal(crash.SystemID, auth.GetApiUUID(crash.GinContext), crash.TraceID, crash.Method, crash.Path, crash.String())
+}
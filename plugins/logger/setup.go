@@ -21,6 +21,9 @@ func SetupLogService(engine *micro.Engine, logFolderPath string) {
 	// This api is called by logged-in user to get the system logs
 	engine.GinEngine.GET("/micro/log", getLog)
 
+	// The panics of the requests are logged with their trace ids
+	engine.CrashLogger = Crash
+
 	// This cron job runs every minute to send the logs to the log service
 	micro.Cron(engine, "0 * * * * *", sendLog)
 }
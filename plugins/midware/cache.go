@@ -1,13 +1,369 @@
 package midware
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/gin-contrib/cache"
-	"github.com/gin-contrib/cache/persistence"
 	"github.com/gin-gonic/gin"
 )
 
+const cacheSkipKey = "micro.cache.skip"
+
+// CachedResponse is a response kept in the CacheStore
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	ETag   string
+}
+
+// CacheStore keep the cached responses, a store is shared by the routes, so the tags invalidate the responses of all of them
+// Use a shared store if the service has more than one instance
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool, error)
+	Set(key string, resp *CachedResponse, ttl time.Duration, tags []string) error
+	// InvalidateTags remove the responses cached with any of the tags
+	InvalidateTags(tags ...string) error
+}
+
+// CacheVaryFunc returns a dimension of the cache key besides the url, e.g. the user
+type CacheVaryFunc func(c *gin.Context) string
+
+// CacheConfig is the setting of a cached route
+type CacheConfig struct {
+	Duration time.Duration
+	Store    CacheStore                    // default a memory store of the route
+	Public   bool                          // the response is the same for all the callers, otherwise it varies by the Authorization header if Vary is empty
+	Vary     []CacheVaryFunc               // the dimensions of the key, e.g. VaryByHeader("Accept-Language")
+	Tags     func(c *gin.Context) []string // the tags of the response, e.g. order:{id}, invalidate them after the writes
+}
+
+// Cache cache the successful responses of the handler by the url for the duration
 func Cache(duration time.Duration, handler gin.HandlerFunc) gin.HandlerFunc {
-	return cache.CachePage(persistence.NewInMemoryStore(time.Second), duration, handler)
+	return CacheWith(CacheConfig{Duration: duration}, handler)
+}
+
+// CacheWith cache the 2xx responses of the handler by the config, the responses marked by SkipCache are not cached
+// The responses carry an ETag, a request with the matched If-None-Match or If-Modified-Since gets 304
+func CacheWith(config CacheConfig, handler gin.HandlerFunc) gin.HandlerFunc {
+	if config.Store == nil {
+		config.Store = NewMemoryCacheStore()
+	}
+	vary := config.Vary
+	if !config.Public && len(vary) == 0 {
+		vary = []CacheVaryFunc{VaryByHeader("Authorization")}
+	}
+
+	return func(c *gin.Context) {
+		key := cacheKey(c, vary)
+		if cached, ok, err := config.Store.Get(key); err == nil && ok {
+			writeCached(c, cached)
+			return
+		}
+
+		w := &bufferedWriter{ResponseWriter: c.Writer, context: c, status: http.StatusOK}
+		c.Writer = w
+		func() {
+			// the writer is restored if the handler panics, so the recovery writes to the client
+			defer func() {
+				c.Writer = w.ResponseWriter
+			}()
+			handler(c)
+		}()
+		if w.direct {
+			return
+		}
+
+		resp := &CachedResponse{
+			Status: w.status,
+			Header: w.Header().Clone(),
+			Body:   w.body.Bytes(),
+			ETag:   w.Header().Get("ETag"), // the ETag set by the handler is kept, e.g. the version of the data
+		}
+		if resp.ETag == "" {
+			resp.ETag = ETag(resp.Body)
+		}
+		if _, skip := c.Get(cacheSkipKey); !skip && resp.Status >= 200 && resp.Status < 300 {
+			var tags []string
+			if config.Tags != nil {
+				tags = config.Tags(c)
+			}
+			config.Store.Set(key, resp, config.Duration, tags)
+		}
+		writeCached(c, resp)
+	}
+}
+
+// SkipCache mark the response of the request not to be cached, e.g. an error or a file
+// The response is written to the client without the buffer if it is marked before it is written
+func SkipCache(c *gin.Context) {
+	c.Set(cacheSkipKey, true)
+}
+
+// VaryByHeader vary the cache by the headers of the request
+func VaryByHeader(names ...string) CacheVaryFunc {
+	return func(c *gin.Context) string {
+		values := make([]string, 0, len(names))
+		for _, name := range names {
+			values = append(values, name+"="+c.GetHeader(name))
+		}
+		return strings.Join(values, "&")
+	}
+}
+
+// cacheKey returns the key of the request, the url, the Accept header and the vary dimensions are hashed
+func cacheKey(c *gin.Context, vary []CacheVaryFunc) string {
+	h := sha256.New()
+	h.Write([]byte(c.Request.URL.RequestURI()))
+	h.Write([]byte{0})
+	h.Write([]byte(c.GetHeader("Accept")))
+	for _, v := range vary {
+		h.Write([]byte{0})
+		h.Write([]byte(v(c)))
+	}
+	return "cache:" + base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// ETag returns the strong ETag of the body
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// writeCached write the response, or 304 if the copy of the client is fresh
+func writeCached(c *gin.Context, resp *CachedResponse) {
+	header := c.Writer.Header()
+	for k, vs := range resp.Header {
+		header[k] = vs
+	}
+	header.Set("ETag", resp.ETag)
+	if resp.Status == http.StatusOK && notModified(c.Request, resp) {
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		c.Abort()
+		return
+	}
+	c.Writer.WriteHeader(resp.Status)
+	c.Writer.Write(resp.Body)
+	c.Abort()
+}
+
+// notModified returns if the If-None-Match of the request has the ETag of the response
+// If-Modified-Since is only checked without If-None-Match
+func notModified(req *http.Request, resp *CachedResponse) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return NoneMatch(ifNoneMatch, resp.ETag)
+	}
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return err == nil && !modified.After(since)
+}
+
+// NoneMatch returns if the If-None-Match header has the etag, the tags are compared weakly
+func NoneMatch(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns if the If-Match header has the etag, the tags are compared strongly so a weak tag never matches
+func Match(ifMatch string, etag string) bool {
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedWriter keep the response of the handler, so its ETag is known before it is written
+// The response marked by SkipCache before it is written goes to the client directly, e.g. a file or a stream
+type bufferedWriter struct {
+	gin.ResponseWriter
+	context *gin.Context
+	status  int
+	written bool
+	direct  bool
+	body    bytes.Buffer
+}
+
+// passthrough returns if the response is written directly, it is decided on the first write
+func (w *bufferedWriter) passthrough() bool {
+	if !w.written && !w.direct {
+		_, w.direct = w.context.Get(cacheSkipKey)
+	}
+	return w.direct
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if w.passthrough() {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	if w.passthrough() {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	if w.passthrough() {
+		return w.ResponseWriter.Write(data)
+	}
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	if w.passthrough() {
+		return w.ResponseWriter.WriteString(s)
+	}
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+// Flush is ignored while the response is buffered, so the headers are not sent before the ETag
+func (w *bufferedWriter) Flush() {
+	if w.passthrough() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *bufferedWriter) Status() int {
+	if w.direct {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if w.direct {
+		return w.ResponseWriter.Size()
+	}
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	if w.direct {
+		return w.ResponseWriter.Written()
+	}
+	return w.written
+}
+
+// memoryCacheStore keep the responses in memory
+type memoryCacheStore struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	tags    map[string]map[string]bool // tag to keys
+	limit   int
+}
+
+type cacheEntry struct {
+	resp     *CachedResponse
+	expireAt time.Time
+	tags     []string
+}
+
+// NewMemoryCacheStore returns the store keeping the responses in memory
+func NewMemoryCacheStore() CacheStore {
+	return &memoryCacheStore{
+		entries: make(map[string]*cacheEntry),
+		tags:    make(map[string]map[string]bool),
+		limit:   1024,
+	}
+}
+
+func (s *memoryCacheStore) Get(key string) (*CachedResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expireAt.After(time.Now()) {
+		s.remove(key)
+		return nil, false, nil
+	}
+	return entry.resp, true, nil
+}
+
+func (s *memoryCacheStore) Set(key string, resp *CachedResponse, ttl time.Duration, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+	s.entries[key] = &cacheEntry{resp: resp, expireAt: time.Now().Add(ttl), tags: tags}
+	for _, tag := range tags {
+		if s.tags[tag] == nil {
+			s.tags[tag] = make(map[string]bool)
+		}
+		s.tags[tag][key] = true
+	}
+	if len(s.entries) > s.limit {
+		now := time.Now()
+		for k, entry := range s.entries {
+			if !entry.expireAt.After(now) {
+				s.remove(k)
+			}
+		}
+		if len(s.entries) > s.limit/2 {
+			s.limit *= 2
+		}
+	}
+	return nil
+}
+
+func (s *memoryCacheStore) InvalidateTags(tags ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tag := range tags {
+		for key := range s.tags[tag] {
+			s.remove(key)
+		}
+	}
+	return nil
+}
+
+func (s *memoryCacheStore) remove(key string) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	delete(s.entries, key)
+	for _, tag := range entry.tags {
+		delete(s.tags[tag], key)
+		if len(s.tags[tag]) == 0 {
+			delete(s.tags, tag)
+		}
+	}
 }
@@ -0,0 +1,87 @@
+package midware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNoneMatch(t *testing.T) {
+	for _, test := range []struct {
+		header, etag string
+		want         bool
+	}{
+		{"", `"a"`, false},
+		{`"a"`, `"a"`, true},
+		{`"b", "a"`, `"a"`, true},
+		{`W/"a"`, `"a"`, true},
+		{`"a"`, `W/"a"`, true},
+		{"*", `"a"`, true},
+		{`"b"`, `"a"`, false},
+	} {
+		if got := NoneMatch(test.header, test.etag); got != test.want {
+			t.Errorf("NoneMatch(%q, %q) = %v, want %v", test.header, test.etag, got, test.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, test := range []struct {
+		header, etag string
+		want         bool
+	}{
+		{`"a"`, `"a"`, true},
+		{`"b", "a"`, `"a"`, true},
+		{"*", `"a"`, true},
+		{`W/"a"`, `"a"`, false},
+		{`"a"`, `W/"a"`, false},
+		{"*", "", false},
+	} {
+		if got := Match(test.header, test.etag); got != test.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", test.header, test.etag, got, test.want)
+		}
+	}
+}
+
+func TestCacheConditional(t *testing.T) {
+	calls := 0
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	router := gin.New()
+	router.GET("/orders", CacheWith(CacheConfig{Duration: time.Minute, Public: true}, func(c *gin.Context) {
+		calls++
+		c.Header("Last-Modified", modified.Format(http.TimeFormat))
+		c.String(200, "orders")
+	}))
+	request := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/orders", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := request(nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != 200 || etag != ETag([]byte("orders")) {
+		t.Fatalf("status %d, ETag %q", first.Code, etag)
+	}
+	for _, headers := range []map[string]string{
+		{"If-None-Match": etag},
+		{"If-Modified-Since": modified.Format(http.TimeFormat)},
+	} {
+		if w := request(headers); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("status %d %q for %v, want 304 without a body", w.Code, w.Body, headers)
+		}
+	}
+	if w := request(map[string]string{"If-None-Match": `"stale"`}); w.Code != 200 || w.Body.String() != "orders" {
+		t.Errorf("status %d %q for a stale copy", w.Code, w.Body)
+	}
+	if calls != 1 {
+		t.Errorf("%d calls, want the cached response served", calls)
+	}
+}
@@ -1,14 +1,186 @@
 package midware
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	limiter "github.com/ulule/limiter/v3"
-	_gin "github.com/ulule/limiter/v3/drivers/middleware/gin"
-	"github.com/ulule/limiter/v3/drivers/store/memory"
 )
 
+// The headers of the rate limit, see the RateLimit header fields draft of the IETF
+const (
+	HEADER_RATE_LIMIT_LIMIT     = "RateLimit-Limit"
+	HEADER_RATE_LIMIT_REMAINING = "RateLimit-Remaining"
+	HEADER_RATE_LIMIT_RESET     = "RateLimit-Reset" // the seconds before the window resets
+	HEADER_RATE_LIMIT_POLICY    = "RateLimit-Policy"
+)
+
+// RateLimitKeyFunc returns the key the requests are counted by, e.g. the client IP or the user
+// An empty key is not limited
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// RateLimitRate is the number of requests allowed in the period
+type RateLimitRate struct {
+	Limit  int64
+	Period time.Duration
+}
+
+// RateLimitConfig is the setting of a rate limit
+type RateLimitConfig struct {
+	Name      string                                  // the limits sharing a store and a name share the counters, default the limit and the period
+	Limit     int64                                   // the requests allowed in the period
+	Period    time.Duration                           // the window of the limit, default 1 minute
+	Key       RateLimitKeyFunc                        // default KeyByIP
+	Tier      func(c *gin.Context) []string           // the tiers of the caller, e.g. the auth groups
+	Tiers     map[string]RateLimitRate                // the rates of the tiers, the most generous tier of the caller applies instead of the Limit
+	Store     RateLimitStore                          // default a memory store, use a shared store if the service has more than one instance
+	OnReject  func(c *gin.Context, r RateLimitResult) // write the rejection, default 429 without a body, see micro.RateLimit for the micro response
+	FailClose bool                                    // reject the requests if the store fails, they are allowed by default
+}
+
+// RateLimitResult is the state of the key after the request is counted
+type RateLimitResult struct {
+	Key       string
+	Limit     int64
+	Remaining int64
+	Reset     time.Time
+	Allowed   bool
+}
+
+// RateLimited limit the requests of the client IP to rate in the duration, counted in memory
 func RateLimited(duration time.Duration, rate int64) gin.HandlerFunc {
-	return _gin.NewMiddleware(limiter.New(memory.NewStore(), limiter.Rate{Period: duration, Limit: rate}))
+	return RateLimit(RateLimitConfig{Limit: rate, Period: duration})
+}
+
+// RateLimit limit the requests by the config in fixed windows, the RateLimit-* headers are set on every response
+func RateLimit(config RateLimitConfig) gin.HandlerFunc {
+	if config.Period <= 0 {
+		config.Period = time.Minute
+	}
+	if config.Key == nil {
+		config.Key = KeyByIP
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryRateLimitStore()
+	}
+	if config.OnReject == nil {
+		config.OnReject = func(c *gin.Context, r RateLimitResult) {
+			c.AbortWithStatus(http.StatusTooManyRequests)
+		}
+	}
+	if config.Name == "" {
+		config.Name = fmt.Sprintf("%d/%s", config.Limit, config.Period)
+	}
+
+	return func(c *gin.Context) {
+		key := config.Key(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+		rate := config.rateOf(c)
+		now := time.Now()
+		window := now.Truncate(rate.Period)
+		reset := window.Add(rate.Period)
+		storeKey := config.Name + ":" + key + ":" + strconv.FormatInt(window.Unix(), 10)
+		count, err := config.Store.Increment(c.Request.Context(), storeKey, reset)
+		if err != nil {
+			log.Println("RateLimit: failed to count the request", err)
+			if config.FailClose {
+				config.OnReject(c, RateLimitResult{Key: key, Limit: rate.Limit, Reset: reset})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		result := RateLimitResult{
+			Key:       key,
+			Limit:     rate.Limit,
+			Remaining: rate.Limit - count,
+			Reset:     reset,
+			Allowed:   count <= rate.Limit,
+		}
+		if result.Remaining < 0 {
+			result.Remaining = 0
+		}
+		resetSeconds := strconv.FormatInt(int64(math.Ceil(reset.Sub(now).Seconds())), 10)
+		c.Header(HEADER_RATE_LIMIT_LIMIT, strconv.FormatInt(rate.Limit, 10))
+		c.Header(HEADER_RATE_LIMIT_REMAINING, strconv.FormatInt(result.Remaining, 10))
+		c.Header(HEADER_RATE_LIMIT_RESET, resetSeconds)
+		c.Header(HEADER_RATE_LIMIT_POLICY, fmt.Sprintf("%d;w=%d", rate.Limit, int64(rate.Period.Seconds())))
+		if !result.Allowed {
+			c.Header("Retry-After", resetSeconds)
+			config.OnReject(c, result)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateOf returns the most generous rate of the tiers of the caller, or the default rate
+func (config *RateLimitConfig) rateOf(c *gin.Context) RateLimitRate {
+	rate := RateLimitRate{Limit: config.Limit, Period: config.Period}
+	if config.Tier == nil || len(config.Tiers) == 0 {
+		return rate
+	}
+	found := false
+	for _, name := range config.Tier(c) {
+		tier, ok := config.Tiers[name]
+		if !ok {
+			continue
+		}
+		if tier.Period <= 0 {
+			tier.Period = config.Period
+		}
+		if !found || perSecond(tier) > perSecond(rate) {
+			rate = tier
+			found = true
+		}
+	}
+	return rate
+}
+
+func perSecond(rate RateLimitRate) float64 {
+	return float64(rate.Limit) / rate.Period.Seconds()
+}
+
+// KeyByIP returns the client IP, the proxies trusted by the engine are skipped
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByRoute returns the method and the route, the requests of the route are limited together
+func KeyByRoute(c *gin.Context) string {
+	return "route:" + c.Request.Method + " " + c.FullPath()
+}
+
+// JoinKeys returns the key of the keys, e.g. JoinKeys(KeyByIP, KeyByRoute) limit each IP on each route
+// The request is not limited if a key is empty
+func JoinKeys(keys ...RateLimitKeyFunc) RateLimitKeyFunc {
+	return func(c *gin.Context) string {
+		parts := make([]string, 0, len(keys))
+		for _, key := range keys {
+			part := key(c)
+			if part == "" {
+				return ""
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, "|")
+	}
+}
+
+// RateLimitStore count the requests of the keys
+type RateLimitStore interface {
+	// Increment add a request to the key and returns the count, the key is removed after expireAt
+	Increment(ctx context.Context, key string, expireAt time.Time) (int64, error)
 }
@@ -0,0 +1,133 @@
+package midware
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type counter struct {
+	count    int64
+	expireAt time.Time
+}
+
+// memoryRateLimitStore count in memory, the counts are not shared by the instances
+type memoryRateLimitStore struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+	limit    int
+}
+
+// NewMemoryRateLimitStore returns the store counting in memory
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{
+		counters: make(map[string]*counter),
+		limit:    1024,
+	}
+}
+
+func (s *memoryRateLimitStore) Increment(ctx context.Context, key string, expireAt time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	c, ok := s.counters[key]
+	if !ok || !c.expireAt.After(now) {
+		c = &counter{expireAt: expireAt}
+		s.counters[key] = c
+	}
+	c.count++
+	if len(s.counters) > s.limit {
+		for k, c := range s.counters {
+			if !c.expireAt.After(now) {
+				delete(s.counters, k)
+			}
+		}
+		if len(s.counters) > s.limit/2 {
+			s.limit *= 2
+		}
+	}
+	return c.count, nil
+}
+
+// RateLimitCounter is a counter of the gorm store
+type RateLimitCounter struct {
+	Key      string `gorm:"column:counter_key;primaryKey;size:255"`
+	Hits     int64
+	ExpireAt time.Time `gorm:"index"`
+}
+
+func (RateLimitCounter) TableName() string {
+	return "micro_rate_limits"
+}
+
+// gormRateLimitStore count in the database, the counts are shared by the instances
+type gormRateLimitStore struct {
+	db    *gorm.DB
+	calls uint64
+}
+
+// NewGormRateLimitStore returns the store counting in the database, the table is migrated
+// The expired counters are removed from time to time
+func NewGormRateLimitStore(db *gorm.DB) (RateLimitStore, error) {
+	if err := db.AutoMigrate(&RateLimitCounter{}); err != nil {
+		return nil, err
+	}
+	return &gormRateLimitStore{db: db}, nil
+}
+
+func (s *gormRateLimitStore) Increment(ctx context.Context, key string, expireAt time.Time) (int64, error) {
+	db := s.db.WithContext(ctx)
+	if atomic.AddUint64(&s.calls, 1)%1000 == 0 {
+		db.Where("expire_at < ?", time.Now()).Delete(&RateLimitCounter{})
+	}
+	var count int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "counter_key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"hits": gorm.Expr("hits + 1")}),
+		}).Create(&RateLimitCounter{Key: key, Hits: 1, ExpireAt: expireAt}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&RateLimitCounter{}).Where("counter_key = ?", key).Select("hits").Scan(&count).Error
+	})
+	return count, err
+}
+
+// RedisClient is the part of a redis client used by the redis store, adapt the client of your redis library to it
+type RedisClient interface {
+	// Incr is the INCR command
+	Incr(ctx context.Context, key string) (int64, error)
+	// ExpireAt is the PEXPIREAT command
+	ExpireAt(ctx context.Context, key string, at time.Time) error
+}
+
+// redisRateLimitStore count in redis, the counts are shared by the instances
+type redisRateLimitStore struct {
+	client RedisClient
+	prefix string
+}
+
+// NewRedisRateLimitStore returns the store counting in redis, the keys are prefixed by the prefix
+func NewRedisRateLimitStore(client RedisClient, prefix string) RateLimitStore {
+	return &redisRateLimitStore{client: client, prefix: prefix}
+}
+
+func (s *redisRateLimitStore) Increment(ctx context.Context, key string, expireAt time.Time) (int64, error) {
+	key = s.prefix + key
+	count, err := s.client.Incr(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		// the windows are in the keys, so a key left without the expiry is only a leak
+		if err := s.client.ExpireAt(ctx, key, expireAt); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,145 @@
+package midware
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeRedis is an in-process RedisClient, to test the redis store without a redis server
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string]string
+	expiry map[string]time.Time
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		values: make(map[string]string),
+		expiry: make(map[string]time.Time),
+	}
+}
+
+func (r *fakeRedis) Incr(ctx context.Context, key string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(key)
+	n, err := strconv.ParseInt(r.values[key], 10, 64)
+	if r.values[key] != "" && err != nil {
+		return 0, err
+	}
+	n++
+	r.values[key] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (r *fakeRedis) ExpireAt(ctx context.Context, key string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(key)
+	if _, ok := r.values[key]; ok {
+		r.expiry[key] = at
+	}
+	return nil
+}
+
+func (r *fakeRedis) expire(key string) {
+	if at, ok := r.expiry[key]; ok && !at.After(time.Now()) {
+		delete(r.values, key)
+		delete(r.expiry, key)
+	}
+}
+
+var testDBs uint64
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:midware_test_%d?mode=memory&cache=shared", atomic.AddUint64(&testDBs, 1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func rateLimitStores(t *testing.T) map[string]RateLimitStore {
+	gormStore, err := NewGormRateLimitStore(newTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]RateLimitStore{
+		"memory": NewMemoryRateLimitStore(),
+		"gorm":   gormStore,
+		"redis":  NewRedisRateLimitStore(newFakeRedis(), "rl:"),
+	}
+}
+
+func TestRateLimitStoreIncrement(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range rateLimitStores(t) {
+		t.Run(name, func(t *testing.T) {
+			expireAt := time.Now().Add(time.Minute)
+			for want := int64(1); want <= 3; want++ {
+				count, err := store.Increment(ctx, "a", expireAt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if count != want {
+					t.Errorf("count = %d, want %d", count, want)
+				}
+			}
+			if count, _ := store.Increment(ctx, "b", expireAt); count != 1 {
+				t.Errorf("the count of another key is %d, want 1", count)
+			}
+		})
+	}
+}
+
+func TestRateLimitStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range rateLimitStores(t) {
+		if name == "gorm" {
+			// the gorm store counts by the keys, which carry the window, the expired rows are only swept
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			store.Increment(ctx, "a", time.Now().Add(-time.Second))
+			if count, _ := store.Increment(ctx, "a", time.Now().Add(time.Minute)); count != 1 {
+				t.Errorf("the count after the expiry is %d, want 1", count)
+			}
+		})
+	}
+}
+
+func TestGormRateLimitStoreShared(t *testing.T) {
+	db := newTestDB(t)
+	first, _ := NewGormRateLimitStore(db)
+	second, _ := NewGormRateLimitStore(db)
+	expireAt := time.Now().Add(time.Minute)
+	first.Increment(context.Background(), "a", expireAt)
+	if count, _ := second.Increment(context.Background(), "a", expireAt); count != 2 {
+		t.Errorf("the count of the other instance is %d, want 2", count)
+	}
+}
+
+func TestRedisRateLimitStoreExpireAt(t *testing.T) {
+	redis := newFakeRedis()
+	store := NewRedisRateLimitStore(redis, "rl:")
+	expireAt := time.Now().Add(time.Minute)
+	store.Increment(context.Background(), "a", expireAt)
+	store.Increment(context.Background(), "a", expireAt.Add(time.Hour))
+	if got := redis.expiry["rl:a"]; !got.Equal(expireAt) {
+		t.Errorf("the expiry is %v, want %v set by the first increment", got, expireAt)
+	}
+}
@@ -0,0 +1,96 @@
+package midware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func rateLimitedRouter(config RateLimitConfig) *gin.Engine {
+	router := gin.New()
+	router.GET("/ping", RateLimit(config), func(c *gin.Context) {
+		c.String(200, "pong")
+	})
+	return router
+}
+
+func get(router *gin.Engine, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/ping", nil)
+	req.RemoteAddr = "203.0.113.7:1234"
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	router := rateLimitedRouter(RateLimitConfig{Limit: 2, Period: time.Hour})
+	for remaining := 1; remaining >= 0; remaining-- {
+		w := get(router, nil)
+		if w.Code != 200 {
+			t.Fatalf("status %d within the limit", w.Code)
+		}
+		if got := w.Header().Get(HEADER_RATE_LIMIT_REMAINING); got != strconv.Itoa(remaining) {
+			t.Errorf("%s = %s, want %d", HEADER_RATE_LIMIT_REMAINING, got, remaining)
+		}
+		if w.Header().Get(HEADER_RATE_LIMIT_LIMIT) != "2" || w.Header().Get(HEADER_RATE_LIMIT_POLICY) != "2;w=3600" {
+			t.Errorf("headers = %v", w.Header())
+		}
+	}
+	w := get(router, nil)
+	if w.Code != http.StatusTooManyRequests || w.Body.Len() != 0 {
+		t.Errorf("over the limit: %d %s, want 429 without a body", w.Code, w.Body)
+	}
+	if w.Header().Get("Retry-After") == "" || w.Header().Get(HEADER_RATE_LIMIT_RESET) == "" {
+		t.Errorf("headers of the rejection = %v", w.Header())
+	}
+}
+
+func TestRateLimitTiers(t *testing.T) {
+	router := rateLimitedRouter(RateLimitConfig{
+		Limit:  1,
+		Period: time.Hour,
+		Key:    func(c *gin.Context) string { return c.GetHeader("X-User") },
+		Tier:   func(c *gin.Context) []string { return []string{c.GetHeader("X-Tier")} },
+		Tiers:  map[string]RateLimitRate{"pro": {Limit: 3}},
+	})
+	for i := 0; i < 3; i++ {
+		if w := get(router, map[string]string{"X-User": "pro-user", "X-Tier": "pro"}); w.Code != 200 {
+			t.Errorf("request %d of the pro tier: %d", i+1, w.Code)
+		}
+	}
+	get(router, map[string]string{"X-User": "free-user"})
+	if w := get(router, map[string]string{"X-User": "free-user"}); w.Code != http.StatusTooManyRequests {
+		t.Errorf("the second request of the default tier: %d, want 429", w.Code)
+	}
+	if w := get(router, nil); w.Code != 200 || w.Header().Get(HEADER_RATE_LIMIT_LIMIT) != "" {
+		t.Errorf("the request without a key is limited: %d", w.Code)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Increment(ctx context.Context, key string, expireAt time.Time) (int64, error) {
+	return 0, errors.New("store down")
+}
+
+func TestRateLimitStoreFailure(t *testing.T) {
+	if w := get(rateLimitedRouter(RateLimitConfig{Limit: 1, Store: failingStore{}}), nil); w.Code != 200 {
+		t.Errorf("fail open: %d, want 200", w.Code)
+	}
+	if w := get(rateLimitedRouter(RateLimitConfig{Limit: 1, Store: failingStore{}, FailClose: true}), nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("fail close: %d, want 429", w.Code)
+	}
+}
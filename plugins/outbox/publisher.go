@@ -0,0 +1,85 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ginger-go/micro"
+	"github.com/ginger-go/micro/plugins/apicall"
+)
+
+// Event is the published form of an outbox message
+type Event struct {
+	ID        uint            `json:"id"`
+	Topic     string          `json:"topic"`
+	Key       string          `json:"key"`
+	Payload   json.RawMessage `json:"payload"`
+	TraceID   string          `json:"trace_id"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Publisher publish the events of the outbox, the event is delivered if no error is returned
+// An event may be published more than once, so the consumers should be idempotent by Event.ID
+type Publisher interface {
+	Publish(event *Event) error
+}
+
+// HTTPPublisher post the events to URL with apicall, the event is delivered if the response is successful
+type HTTPPublisher struct {
+	URL     string
+	Headers map[string]string
+}
+
+func NewHTTPPublisher(url string) *HTTPPublisher {
+	return &HTTPPublisher{URL: url}
+}
+
+func (p *HTTPPublisher) Publish(event *Event) error {
+	resp, err := apicall.POST[struct{}](p.URL, event, p.Headers, event.TraceID, []micro.Trace{})
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		if resp.Error != nil {
+			return errors.New(resp.Error.Code + ": " + resp.Error.Message)
+		}
+		return errors.New("failed to publish the event")
+	}
+	return nil
+}
+
+// MemoryPublisher keep the published events in memory, it is useful for testing
+// If Handler is set, it is called with the events and its error fails the delivery
+type MemoryPublisher struct {
+	Handler func(event *Event) error
+
+	mu     sync.Mutex
+	events []Event
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(event *Event) error {
+	if p.Handler != nil {
+		if err := p.Handler(event); err != nil {
+			return err
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, *event)
+	return nil
+}
+
+// Events returns the published events in order
+func (p *MemoryPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	events := make([]Event, len(p.events))
+	copy(events, p.events)
+	return events
+}
@@ -0,0 +1,157 @@
+package outbox
+
+import (
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/ginger-go/micro"
+	"gorm.io/gorm"
+)
+
+// Config is the setting of the relay
+type Config struct {
+	BatchSize int                             // messages published in a run, default 100
+	Lease     time.Duration                   // a message is not published by others within the lease, default 1 minute
+	Retention time.Duration                   // the delivered messages are deleted after, default 24 hours
+	Backoff   func(attempt int) time.Duration // delay before the next attempt, default exponential
+}
+
+// Relay publish the messages of the outbox, at least once and in order for the same key
+// A failed message is retried after the backoff, the later messages of its key wait for it
+type Relay struct {
+	db        *gorm.DB
+	publisher Publisher
+	config    Config
+	running   int32
+}
+
+// NewRelay create a relay of the outbox in the database, the table is migrated automatically
+func NewRelay(db *gorm.DB, publisher Publisher, config ...Config) (*Relay, error) {
+	if err := micro.MigrateOutbox(db); err != nil {
+		return nil, err
+	}
+	c := Config{}
+	if len(config) > 0 {
+		c = config[0]
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.Lease <= 0 {
+		c.Lease = time.Minute
+	}
+	if c.Retention <= 0 {
+		c.Retention = 24 * time.Hour
+	}
+	if c.Backoff == nil {
+		c.Backoff = micro.ExponentialBackoff(time.Second, time.Hour)
+	}
+	return &Relay{db: db, publisher: publisher, config: c}, nil
+}
+
+// Setup create a relay and run it every second on the cron worker of the engine
+func Setup(engine *micro.Engine, db *gorm.DB, publisher Publisher, config ...Config) (*Relay, error) {
+	relay, err := NewRelay(db, publisher, config...)
+	if err != nil {
+		return nil, err
+	}
+	micro.Cron(engine, "@every 1s", relay.Run)
+	return relay, nil
+}
+
+// Start run the relay in a dedicated goroutine every interval, call stop to end it
+func (r *Relay) Start(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			r.Run()
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+// Run publish the available messages once and delete the expired delivered messages
+// It returns at once if the relay is already running
+func (r *Relay) Run() {
+	if !atomic.CompareAndSwapInt32(&r.running, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&r.running, 0)
+
+	now := time.Now()
+	// the keys having a leased or backed off message are skipped to keep the order
+	waiting := r.db.Model(&micro.OutboxMessage{}).Select("message_key").
+		Where("delivered_at IS NULL AND available_at > ?", now)
+	var messages []micro.OutboxMessage
+	err := r.db.Where("delivered_at IS NULL AND message_key NOT IN (?)", waiting).
+		Order("id").Limit(r.config.BatchSize).Find(&messages).Error
+	if err != nil {
+		log.Println("failed to fetch outbox messages", err)
+		return
+	}
+
+	failed := make(map[string]bool)
+	for i := range messages {
+		message := &messages[i]
+		if failed[message.Key] || !r.claim(message, now) {
+			failed[message.Key] = true
+			continue
+		}
+		if err := r.publisher.Publish(toEvent(message)); err != nil {
+			failed[message.Key] = true
+			r.retry(message, err)
+			continue
+		}
+		err := r.db.Model(message).Update("delivered_at", time.Now()).Error
+		if err != nil {
+			log.Println("failed to mark outbox message delivered", message.ID, err)
+		}
+	}
+
+	err = r.db.Where("delivered_at < ?", now.Add(-r.config.Retention)).Delete(&micro.OutboxMessage{}).Error
+	if err != nil {
+		log.Println("failed to clean up outbox messages", err)
+	}
+}
+
+// claim lease the message, so it is not published by the other relays at the same time
+func (r *Relay) claim(message *micro.OutboxMessage, now time.Time) bool {
+	result := r.db.Model(&micro.OutboxMessage{}).
+		Where("id = ? AND delivered_at IS NULL AND available_at <= ?", message.ID, now).
+		Update("available_at", now.Add(r.config.Lease))
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+func (r *Relay) retry(message *micro.OutboxMessage, reason error) {
+	attempts := message.Attempts + 1
+	err := r.db.Model(message).Updates(map[string]interface{}{
+		"attempts":     attempts,
+		"last_error":   reason.Error(),
+		"available_at": time.Now().Add(r.config.Backoff(attempts)),
+	}).Error
+	if err != nil {
+		log.Println("failed to retry outbox message", message.ID, err)
+	}
+}
+
+func toEvent(message *micro.OutboxMessage) *Event {
+	return &Event{
+		ID:        message.ID,
+		Topic:     message.Topic,
+		Key:       message.Key,
+		Payload:   json.RawMessage(message.Payload),
+		TraceID:   message.TraceID,
+		CreatedAt: message.CreatedAt,
+	}
+}
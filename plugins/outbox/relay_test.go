@@ -0,0 +1,152 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ginger-go/micro"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testDBs uint64
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:outbox_test_%d?mode=memory&cache=shared", atomic.AddUint64(&testDBs, 1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func newTestRelay(t *testing.T, publisher Publisher) (*Relay, *gorm.DB) {
+	db := newTestDB(t)
+	relay, err := NewRelay(db, publisher, Config{Backoff: func(int) time.Duration { return 0 }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return relay, db
+}
+
+func write(t *testing.T, db *gorm.DB, key string, payload string) {
+	if err := micro.WriteOutbox(db, "order.updated", key, payload); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func payloads(events []Event) []string {
+	result := make([]string, len(events))
+	for i, event := range events {
+		result[i] = string(event.Payload)
+	}
+	return result
+}
+
+func TestRelayOrderByKey(t *testing.T) {
+	publisher := NewMemoryPublisher()
+	failing := map[string]bool{`"a1"`: true}
+	publisher.Handler = func(event *Event) error {
+		if failing[string(event.Payload)] {
+			delete(failing, string(event.Payload))
+			return errors.New("subscriber down")
+		}
+		return nil
+	}
+	relay, db := newTestRelay(t, publisher)
+	write(t, db, "order:a", "a1")
+	write(t, db, "order:b", "b1")
+	write(t, db, "order:a", "a2")
+	write(t, db, "order:b", "b2")
+
+	// a1 fails, so a2 waits for it while the key b goes on
+	relay.Run()
+	if got := fmt.Sprint(payloads(publisher.Events())); got != `["b1" "b2"]` {
+		t.Fatalf("published %s after the failure", got)
+	}
+	var failed micro.OutboxMessage
+	db.Where("payload = ?", `"a1"`).Take(&failed)
+	if failed.Attempts != 1 || failed.LastError != "subscriber down" || failed.DeliveredAt != nil {
+		t.Errorf("the failed message %+v", failed)
+	}
+
+	time.Sleep(time.Millisecond)
+	relay.Run()
+	if got := fmt.Sprint(payloads(publisher.Events())); got != `["b1" "b2" "a1" "a2"]` {
+		t.Errorf("published %s, want a1 before a2", got)
+	}
+	var pending int64
+	db.Model(&micro.OutboxMessage{}).Where("delivered_at IS NULL").Count(&pending)
+	if pending != 0 {
+		t.Errorf("%d messages not delivered", pending)
+	}
+}
+
+func TestRelayLease(t *testing.T) {
+	publisher := NewMemoryPublisher()
+	relay, db := newTestRelay(t, publisher)
+	write(t, db, "order:a", "a1")
+	write(t, db, "order:a", "a2")
+
+	// a1 is leased by another relay, which crashed before publishing it
+	db.Model(&micro.OutboxMessage{}).Where("payload = ?", `"a1"`).Update("available_at", time.Now().Add(time.Minute))
+	relay.Run()
+	if events := publisher.Events(); len(events) != 0 {
+		t.Fatalf("published %v within the lease of another relay", payloads(events))
+	}
+
+	// the lease expires, the message is taken over
+	db.Model(&micro.OutboxMessage{}).Where("payload = ?", `"a1"`).Update("available_at", time.Now().Add(-time.Second))
+	relay.Run()
+	if got := fmt.Sprint(payloads(publisher.Events())); got != `["a1" "a2"]` {
+		t.Errorf("published %s after the lease expired", got)
+	}
+}
+
+func TestRelayOnce(t *testing.T) {
+	publisher := NewMemoryPublisher()
+	relay, db := newTestRelay(t, publisher)
+	other, _ := NewRelay(db, publisher)
+	for i := 0; i < 5; i++ {
+		write(t, db, fmt.Sprintf("order:%d", i), fmt.Sprint(i))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		other.Run()
+		close(done)
+	}()
+	relay.Run()
+	<-done
+	if events := publisher.Events(); len(events) != 5 {
+		t.Errorf("published %v, want each message once", payloads(events))
+	}
+}
+
+func TestRelayRetention(t *testing.T) {
+	publisher := NewMemoryPublisher()
+	relay, db := newTestRelay(t, publisher)
+	write(t, db, "order:a", "old")
+	write(t, db, "order:b", "recent")
+	write(t, db, "order:c", "pending")
+	old := time.Now().Add(-25 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	db.Model(&micro.OutboxMessage{}).Where("payload = ?", `"old"`).Update("delivered_at", old)
+	db.Model(&micro.OutboxMessage{}).Where("payload = ?", `"recent"`).Update("delivered_at", recent)
+	db.Model(&micro.OutboxMessage{}).Where("payload = ?", `"pending"`).Update("available_at", time.Now().Add(time.Minute))
+
+	relay.Run()
+	var kept []micro.OutboxMessage
+	db.Order("id").Find(&kept)
+	if len(kept) != 2 || string(kept[0].Payload) != `"recent"` || string(kept[1].Payload) != `"pending"` {
+		t.Errorf("kept %+v, want the delivered message deleted after the retention", kept)
+	}
+}
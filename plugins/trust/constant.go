@@ -0,0 +1,43 @@
+package trust
+
+import (
+	"time"
+
+	"github.com/ginger-go/micro"
+)
+
+// The headers of the signed requests
+const (
+	HEADER_SIGNATURE_KEY       = "Micro-Signature-Key"
+	HEADER_SIGNATURE_TIMESTAMP = "Micro-Signature-Timestamp"
+	HEADER_SIGNATURE_NONCE     = "Micro-Signature-Nonce"
+	HEADER_SIGNATURE           = "Micro-Signature"
+)
+
+// SIGNING_KEY_ID identify the secret signing the requests of this service, the callee finds the secret by it
+// Please set it to the environment variable MICRO_SIGNING_KEY_ID, default the system id
+var SIGNING_KEY_ID string
+
+// SIGNING_SECRET sign the requests of this service
+// Please set it to the environment variable MICRO_SIGNING_SECRET
+var SIGNING_SECRET string
+
+// SIGNING_KEYS are the secrets of the callers by their key id, the requests signed by them are trusted
+// Please set it to the environment variable MICRO_SIGNING_KEYS, e.g. auth=secret1,order=secret2
+var SIGNING_KEYS = make(map[string]string)
+
+// SIGNING_MAX_BODY is the max size of the body of a signed request in bytes, a larger body fails the verification
+var SIGNING_MAX_BODY int64 = 10 << 20
+
+// SIGNING_MAX_SKEW is how old or how far in the future the timestamp of a signed request can be
+var SIGNING_MAX_SKEW = 5 * time.Minute
+
+// These are the trust related error code and message
+const (
+	ERR_CODE_INVALID_SIGNATURE = "5e9a2c7d-3b18-4f60-a4d1-8c6f0b2e9a73"
+	ERR_MSG_INVALID_SIGNATURE  = "Invalid signature"
+)
+
+func init() {
+	micro.RegisterError(ERR_CODE_INVALID_SIGNATURE, ERR_MSG_INVALID_SIGNATURE)
+}
@@ -0,0 +1,90 @@
+package trust
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ginger-go/micro"
+)
+
+const (
+	callerKey      = "micro.trust.caller"
+	callerErrorKey = "micro.trust.error"
+)
+
+// Caller returns the identity of the calling service, empty if the caller is not trusted
+// It is the common name of the verified client certificate, or the key id of the valid signature
+// The result is kept in the context, so the nonce of the request is used once
+func Caller(ctx *gin.Context) string {
+	if caller, ok := ctx.Get(callerKey); ok {
+		return caller.(string)
+	}
+	caller, err := verifyCaller(ctx)
+	if err != nil {
+		ctx.Set(callerErrorKey, err)
+	}
+	ctx.Set(callerKey, caller)
+	return caller
+}
+
+func verifyCaller(ctx *gin.Context) (string, error) {
+	if mutualTLS {
+		if caller, err := certificateIdentity(ctx.Request); err == nil {
+			return caller, nil
+		}
+	}
+	if !signing {
+		return "", nil
+	}
+	return Verify(ctx.Request, nonceStore)
+}
+
+// CallerOnly only allow the trusted callers, or the given callers if any
+func CallerOnly(callers ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		caller := Caller(ctx)
+		if caller == "" {
+			if err, ok := ctx.Get(callerErrorKey); ok {
+				log.Println("CallerOnly: unauthorized access from ip: ", ctx.ClientIP(), err)
+			}
+			abortInvalidSignature(ctx)
+			return
+		}
+		if len(callers) == 0 {
+			ctx.Next()
+			return
+		}
+		for _, c := range callers {
+			if c == caller {
+				ctx.Next()
+				return
+			}
+		}
+		log.Println("CallerOnly: unauthorized access from caller: ", caller)
+		abortInvalidSignature(ctx)
+	}
+}
+
+func abortInvalidSignature(ctx *gin.Context) {
+	traceID := micro.GetTraceID(ctx)
+	traces := micro.GetTraces(ctx)
+	responseError := &micro.ResponseError{
+		Code:    ERR_CODE_INVALID_SIGNATURE,
+		Message: ERR_MSG_INVALID_SIGNATURE,
+	}
+	traces = append(traces, micro.Trace{
+		Success:    false,
+		Time:       time.Now(),
+		SystemID:   systemID,
+		SystemName: systemName,
+		TraceID:    traceID,
+		Error:      responseError,
+	})
+	ctx.AbortWithStatusJSON(401, micro.Response{
+		Success: false,
+		Error:   responseError,
+		TraceID: traceID,
+		Traces:  traces,
+	})
+}
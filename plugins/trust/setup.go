@@ -0,0 +1,50 @@
+package trust
+
+import (
+	"strings"
+
+	"github.com/ginger-go/env"
+	"github.com/ginger-go/micro"
+	"github.com/ginger-go/micro/plugins/apicall"
+)
+
+var (
+	signing    bool
+	mutualTLS  bool
+	nonceStore NonceStore
+	systemID   string
+	systemName string
+)
+
+// Setup the request signing
+// The apicall requests of this service are signed, and the requests signed by SIGNING_KEYS are trusted by Caller
+// The nonces are kept in memory if no store is given
+func SetupSigning(engine *micro.Engine, store ...NonceStore) {
+	SIGNING_KEY_ID = env.String("MICRO_SIGNING_KEY_ID", engine.SystemID)
+	SIGNING_SECRET = env.String("MICRO_SIGNING_SECRET", "")
+	if SIGNING_SECRET == "" {
+		panic("MICRO_SIGNING_SECRET is not set") // must set MICRO_SIGNING_SECRET
+	}
+	for _, pair := range strings.Split(env.String("MICRO_SIGNING_KEYS", ""), ",") {
+		keyID, secret, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && keyID != "" {
+			SIGNING_KEYS[keyID] = secret
+		}
+	}
+
+	nonceStore = NewMemoryNonceStore()
+	if len(store) > 0 && store[0] != nil {
+		nonceStore = store[0]
+	}
+
+	// The requests of this service are signed in apicall
+	apicall.SIGNER = Sign
+	signing = true
+	systemID = engine.SystemID
+	systemName = engine.SystemName
+}
+
+// Enabled returns if the signing or the mutual TLS is setup, the callers are identified by Caller instead of their IP
+func Enabled() bool {
+	return signing || mutualTLS
+}
@@ -0,0 +1,163 @@
+package trust
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NonceStore remember the nonces of the signed requests until they expire, so a request can not be replayed
+// Use a shared store if the service has more than one instance
+type NonceStore interface {
+	// Use returns false if the nonce of the key is used before
+	Use(keyID string, nonce string, expireAt time.Time) (bool, error)
+}
+
+// Sign sign the request with SIGNING_KEY_ID and SIGNING_SECRET, it is the apicall.SIGNER set by SetupSigning
+func Sign(req *http.Request) error {
+	return SignWith(req, SIGNING_KEY_ID, SIGNING_SECRET)
+}
+
+// SignWith sign the request with the key, the method, the path, the query, the body hash, the timestamp and the nonce are signed
+func SignWith(req *http.Request, keyID string, secret string) error {
+	bodyHash, err := hashBody(req)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := uuid.NewString()
+	req.Header.Set(HEADER_SIGNATURE_KEY, keyID)
+	req.Header.Set(HEADER_SIGNATURE_TIMESTAMP, timestamp)
+	req.Header.Set(HEADER_SIGNATURE_NONCE, nonce)
+	req.Header.Set(HEADER_SIGNATURE, signature(secret, req, bodyHash, keyID, timestamp, nonce))
+	return nil
+}
+
+// Verify verify the signature of the request, it returns the key id of the caller
+// The key is looked up in SIGNING_KEYS, and the nonce is used in the store
+func Verify(req *http.Request, store NonceStore) (string, error) {
+	keyID := req.Header.Get(HEADER_SIGNATURE_KEY)
+	timestamp := req.Header.Get(HEADER_SIGNATURE_TIMESTAMP)
+	nonce := req.Header.Get(HEADER_SIGNATURE_NONCE)
+	sig := req.Header.Get(HEADER_SIGNATURE)
+	if keyID == "" || timestamp == "" || nonce == "" || sig == "" {
+		return "", errors.New("trust: the request is not signed")
+	}
+	secret, ok := SIGNING_KEYS[keyID]
+	if !ok {
+		return "", errors.New("trust: unknown signing key " + keyID)
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", errors.New("trust: invalid signature timestamp")
+	}
+	signedAt := time.Unix(unix, 0)
+	if skew := time.Since(signedAt); skew > SIGNING_MAX_SKEW || skew < -SIGNING_MAX_SKEW {
+		return "", errors.New("trust: the signature is expired")
+	}
+	bodyHash, err := hashBody(req)
+	if err != nil {
+		return "", err
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, req, bodyHash, keyID, timestamp, nonce))) {
+		return "", errors.New("trust: signature mismatch")
+	}
+	// the nonce is used after the signature is verified, so the forged requests can not burn the nonces
+	fresh, err := store.Use(keyID, nonce, signedAt.Add(SIGNING_MAX_SKEW))
+	if err != nil {
+		return "", err
+	}
+	if !fresh {
+		return "", errors.New("trust: the request is replayed")
+	}
+	return keyID, nil
+}
+
+func signature(secret string, req *http.Request, bodyHash string, keyID string, timestamp string, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		bodyHash,
+		keyID,
+		timestamp,
+		nonce,
+	}, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hashBody returns the hex sha256 of the body, the body is kept readable
+// The body is read up to SIGNING_MAX_BODY, so the unsigned callers can not make the service buffer a huge body
+func hashBody(req *http.Request) (string, error) {
+	var b []byte
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+	case req.GetBody != nil:
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+		if b, err = io.ReadAll(body); err != nil {
+			return "", err
+		}
+	default:
+		var err error
+		if b, err = io.ReadAll(http.MaxBytesReader(nil, req.Body, SIGNING_MAX_BODY)); err != nil {
+			return "", err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(b))
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// memoryNonceStore keep the nonces in memory, the expired nonces are removed as the store grows
+type memoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	limit  int
+}
+
+// NewMemoryNonceStore returns the nonce store of a single instance
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{
+		nonces: make(map[string]time.Time),
+		limit:  1024,
+	}
+}
+
+func (s *memoryNonceStore) Use(keyID string, nonce string, expireAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	key := keyID + ":" + nonce
+	if until, ok := s.nonces[key]; ok && until.After(now) {
+		return false, nil
+	}
+	s.nonces[key] = expireAt
+	if len(s.nonces) > s.limit {
+		for k, until := range s.nonces {
+			if !until.After(now) {
+				delete(s.nonces, k)
+			}
+		}
+		if len(s.nonces) > s.limit/2 {
+			s.limit *= 2
+		}
+	}
+	return true, nil
+}
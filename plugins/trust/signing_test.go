@@ -0,0 +1,101 @@
+package trust
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signedRequest(t *testing.T, method, target, body string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if err := SignWith(req, "order", "order-secret"); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestVerify(t *testing.T) {
+	SIGNING_KEYS = map[string]string{"order": "order-secret"}
+	store := NewMemoryNonceStore()
+
+	req := signedRequest(t, "POST", "/orders?x=1", `{"id":1}`)
+	caller, err := Verify(req, store)
+	if err != nil || caller != "order" {
+		t.Fatalf("Verify = %q, %v", caller, err)
+	}
+	if b, _ := io.ReadAll(req.Body); string(b) != `{"id":1}` {
+		t.Errorf("the body is %q after the verification", b)
+	}
+	if _, err := Verify(req, store); err == nil {
+		t.Error("the replayed request is trusted")
+	}
+
+	tampered := signedRequest(t, "POST", "/orders?x=1", `{"id":1}`)
+	tampered.Body = io.NopCloser(strings.NewReader(`{"id":2}`))
+	if _, err := Verify(tampered, store); err == nil {
+		t.Error("the request with another body is trusted")
+	}
+	tampered = signedRequest(t, "POST", "/orders?x=1", "")
+	tampered.URL.RawQuery = "x=2"
+	if _, err := Verify(tampered, store); err == nil {
+		t.Error("the request with another query is trusted")
+	}
+
+	unknown := httptest.NewRequest("GET", "/orders", nil)
+	SignWith(unknown, "evil", "order-secret")
+	if _, err := Verify(unknown, store); err == nil {
+		t.Error("the request of an unknown key is trusted")
+	}
+
+	expired := signedRequest(t, "GET", "/orders", "")
+	expired.Header.Set(HEADER_SIGNATURE_TIMESTAMP, strconv.FormatInt(time.Now().Add(-2*SIGNING_MAX_SKEW).Unix(), 10))
+	if _, err := Verify(expired, store); err == nil {
+		t.Error("the expired request is trusted")
+	}
+
+	if _, err := Verify(httptest.NewRequest("GET", "/orders", nil), store); err == nil {
+		t.Error("the unsigned request is trusted")
+	}
+}
+
+func TestVerifyMaxBody(t *testing.T) {
+	SIGNING_KEYS = map[string]string{"order": "order-secret"}
+	defer func(max int64) { SIGNING_MAX_BODY = max }(SIGNING_MAX_BODY)
+	SIGNING_MAX_BODY = 16
+
+	req := signedRequest(t, "POST", "/orders", strings.Repeat("x", 16))
+	if _, err := Verify(req, NewMemoryNonceStore()); err != nil {
+		t.Errorf("the body of the max size: %v", err)
+	}
+	req = httptest.NewRequest("POST", "/orders", strings.NewReader(strings.Repeat("x", 17)))
+	req.Header.Set(HEADER_SIGNATURE_KEY, "order")
+	req.Header.Set(HEADER_SIGNATURE_TIMESTAMP, strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set(HEADER_SIGNATURE_NONCE, "nonce")
+	req.Header.Set(HEADER_SIGNATURE, "sig")
+	_, err := Verify(req, NewMemoryNonceStore())
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("the body over SIGNING_MAX_BODY: %v", err)
+	}
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	store := NewMemoryNonceStore()
+	if fresh, _ := store.Use("order", "n1", time.Now().Add(time.Minute)); !fresh {
+		t.Error("the new nonce is used")
+	}
+	if fresh, _ := store.Use("order", "n1", time.Now().Add(time.Minute)); fresh {
+		t.Error("the nonce is used twice")
+	}
+	if fresh, _ := store.Use("auth", "n1", time.Now().Add(time.Minute)); !fresh {
+		t.Error("the nonce of another key is used")
+	}
+	store.Use("order", "n2", time.Now().Add(-time.Second))
+	if fresh, _ := store.Use("order", "n2", time.Now().Add(time.Minute)); !fresh {
+		t.Error("the expired nonce is used")
+	}
+}
@@ -0,0 +1,62 @@
+package trust
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/ginger-go/micro/plugins/apicall"
+)
+
+// SetupMutualTLS present the certificate of this service in the apicall requests, and trust the servers signed by the CA bundle
+// It returns the server config verifying the client certificates by the CA bundle, pass it to Engine.RunTLS
+// The certificate is optional at the handshake, so the users and the callers signing their requests still connect,
+// guard the internal routes with CallerOnly or auth.SystemTokenOnly
+// The identity of a caller is the common name of its certificate, or its first DNS name, see Caller
+func SetupMutualTLS(certFile string, keyFile string, caFile string) *tls.Config {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		panic("failed to load the certificate: " + err.Error())
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		panic("failed to load the CA bundle: " + err.Error())
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		panic("failed to load the CA bundle: no certificate in " + caFile)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}
+	apicall.HTTP_CLIENT = &http.Client{Transport: transport}
+	mutualTLS = true
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// certificateIdentity returns the identity of the verified client certificate of the request
+func certificateIdentity(req *http.Request) (string, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return "", errors.New("trust: no verified client certificate")
+	}
+	cert := req.TLS.VerifiedChains[0][0]
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName, nil
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0], nil
+	}
+	return "", errors.New("trust: the client certificate has no identity")
+}
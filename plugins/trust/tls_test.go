@@ -0,0 +1,124 @@
+package trust
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ginger-go/micro/plugins/apicall"
+)
+
+// writeCertificates write a CA and a certificate of the service signed by it, it returns the files
+func writeCertificates(t *testing.T, name string) (certFile, keyFile, caFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(file string, blockType string, der []byte) string {
+		path := filepath.Join(dir, file)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, cert, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return write("cert.pem", "CERTIFICATE", certDER), write("key.pem", "EC PRIVATE KEY", keyDER), write("ca.pem", "CERTIFICATE", caDER)
+}
+
+func TestMutualTLSWithSigningFallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(client *http.Client) {
+		apicall.HTTP_CLIENT = client
+		mutualTLS, signing, nonceStore = false, false, nil
+	}(apicall.HTTP_CLIENT)
+
+	certFile, keyFile, caFile := writeCertificates(t, "order")
+	config := SetupMutualTLS(certFile, keyFile, caFile)
+	if config.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("ClientAuth = %v, the callers without a certificate can not connect", config.ClientAuth)
+	}
+	signing, nonceStore = true, NewMemoryNonceStore()
+	SIGNING_KEYS = map[string]string{"billing": "billing-secret"}
+
+	router := gin.New()
+	router.GET("/internal", CallerOnly(), func(c *gin.Context) {
+		c.String(200, Caller(c))
+	})
+	server := httptest.NewUnstartedServer(router)
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(client *http.Client, sign bool) (int, string) {
+		req, _ := http.NewRequest("GET", server.URL+"/internal", nil)
+		if sign {
+			SignWith(req, "billing", "billing-secret")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	// the caller presenting the certificate is identified by it
+	if status, caller := get(apicall.HTTP_CLIENT, false); status != 200 || caller != "order" {
+		t.Errorf("with the certificate: %d %s", status, caller)
+	}
+
+	// the caller without a certificate connects, and is identified by the signature
+	pool := x509.NewCertPool()
+	pemBytes, _ := os.ReadFile(caFile)
+	pool.AppendCertsFromPEM(pemBytes)
+	plain := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	if status, caller := get(plain, true); status != 200 || caller != "billing" {
+		t.Errorf("with the signature: %d %s", status, caller)
+	}
+	if status, _ := get(plain, false); status != http.StatusUnauthorized {
+		t.Errorf("without the certificate or the signature: %d, want 401", status)
+	}
+}
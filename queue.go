@@ -0,0 +1,203 @@
+package micro
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+)
+
+// Job is the job passed to the job handler
+type Job[T any] struct {
+	ID      uint
+	Queue   string
+	TraceID string
+	Attempt int // starts from 1
+	Payload *T
+}
+
+// JobHandler handles a job, returning an error makes the job retried
+type JobHandler[T any] func(job *Job[T]) error
+
+// QueueConfig is the setting of a job queue, zero values fall back to the defaults
+type QueueConfig struct {
+	Concurrency  int                             // max number of jobs running at the same time, default 1
+	MaxAttempts  int                             // attempts before the job is moved to the dead letter, default 5
+	PollInterval time.Duration                   // how often the store is polled, default 1s
+	Lease        time.Duration                   // a running job is fetched again after the lease, default 5m
+	Backoff      func(attempt int) time.Duration // delay before the next attempt, default exponential
+}
+
+type jobQueue struct {
+	name     string
+	config   QueueConfig
+	handlers map[string]func(record *JobRecord) error
+}
+
+// SetupQueue setup a job queue with the config
+// The workers of the queue start when the engine starts running
+func SetupQueue(engine *Engine, name string, config QueueConfig) {
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.Lease <= 0 {
+		config.Lease = 5 * time.Minute
+	}
+	if config.Backoff == nil {
+		config.Backoff = ExponentialBackoff(time.Second, time.Hour)
+	}
+	q, ok := engine.queues[name]
+	if !ok {
+		engine.queues[name] = &jobQueue{
+			name:     name,
+			config:   config,
+			handlers: make(map[string]func(record *JobRecord) error),
+		}
+		return
+	}
+	q.config = config
+}
+
+// HandleJob register the handler of the job type T in the queue
+// The queue is setup with the default config if it is not setup yet
+func HandleJob[T any](engine *Engine, queue string, handler JobHandler[T]) {
+	if _, ok := engine.queues[queue]; !ok {
+		SetupQueue(engine, queue, QueueConfig{})
+	}
+	engine.queues[queue].handlers[jobType[T]()] = func(record *JobRecord) error {
+		payload := new(T)
+		if err := json.Unmarshal([]byte(record.Payload), payload); err != nil {
+			return err
+		}
+		return handler(&Job[T]{
+			ID:      record.ID,
+			Queue:   record.Queue,
+			TraceID: record.TraceID,
+			Attempt: record.Attempts,
+			Payload: payload,
+		})
+	}
+}
+
+// Enqueue push a job to the queue, the job runs as soon as a worker is free
+func Enqueue[T any](engine *Engine, queue string, traceID string, payload *T) error {
+	return EnqueueAt(engine, queue, traceID, time.Now(), payload)
+}
+
+// EnqueueIn push a job to the queue, the job runs after the delay
+func EnqueueIn[T any](engine *Engine, queue string, traceID string, delay time.Duration, payload *T) error {
+	return EnqueueAt(engine, queue, traceID, time.Now().Add(delay), payload)
+}
+
+// EnqueueAt push a job to the queue, the job runs at the given time
+func EnqueueAt[T any](engine *Engine, queue string, traceID string, runAt time.Time, payload *T) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return engine.JobStore.Push(&JobRecord{
+		Queue:   queue,
+		Type:    jobType[T](),
+		Payload: string(b),
+		TraceID: traceID,
+		Status:  JOB_STATUS_PENDING,
+		RunAt:   runAt,
+	})
+}
+
+// ExponentialBackoff doubles the delay on every attempt, up to max
+func ExponentialBackoff(base, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		delay := base
+		for i := 1; i < attempt; i++ {
+			delay *= 2
+			if delay >= max {
+				return max
+			}
+		}
+		return delay
+	}
+}
+
+func (e *Engine) startJobWorkers() {
+	if e.jobsStarted {
+		return
+	}
+	e.jobsStarted = true
+	for _, q := range e.queues {
+		go q.run(e.JobStore)
+	}
+}
+
+func (q *jobQueue) run(store JobStore) {
+	slots := make(chan struct{}, q.config.Concurrency)
+	ticker := time.NewTicker(q.config.PollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		free := cap(slots) - len(slots)
+		if free == 0 {
+			continue
+		}
+		records, err := store.Fetch(q.name, free, q.config.Lease)
+		if err != nil {
+			log.Println("failed to fetch jobs of queue", q.name, err)
+			continue
+		}
+		for i := range records {
+			slots <- struct{}{}
+			go func(record *JobRecord) {
+				defer func() { <-slots }()
+				q.process(store, record)
+			}(&records[i])
+		}
+	}
+}
+
+// process run the job and record the result, the result is dropped if the lease is lost, the job is run by another worker
+func (q *jobQueue) process(store JobStore, record *JobRecord) {
+	err := q.handle(record)
+	if err == nil {
+		if err := store.Complete(record); err != nil {
+			log.Println("failed to complete job", record.ID, err)
+		}
+		return
+	}
+	if record.Attempts >= q.config.MaxAttempts {
+		log.Println("job is moved to dead letter", record.ID, record.TraceID, err)
+		if err := store.Bury(record, err.Error()); err != nil {
+			log.Println("failed to bury job", record.ID, err)
+		}
+		return
+	}
+	if err := store.Retry(record, time.Now().Add(q.config.Backoff(record.Attempts)), err.Error()); err != nil {
+		log.Println("failed to retry job", record.ID, err)
+	}
+}
+
+func (q *jobQueue) handle(record *JobRecord) (err error) {
+	handler, ok := q.handlers[record.Type]
+	if !ok {
+		return fmt.Errorf("no handler of job type %s in queue %s", record.Type, q.name)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panic: %v", r)
+		}
+	}()
+	return handler(record)
+}
+
+func jobType[T any]() string {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Name() != "" && t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	return t.String()
+}
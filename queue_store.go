@@ -0,0 +1,304 @@
+package micro
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	JOB_STATUS_PENDING = "pending"
+	JOB_STATUS_RUNNING = "running"
+	JOB_STATUS_DEAD    = "dead"
+)
+
+// ErrLeaseLost is returned by Complete, Retry and Bury if the job has been fetched again by another worker after the lease expired
+var ErrLeaseLost = errors.New("micro: the lease of the job is lost")
+
+// JobRecord is the stored form of a job
+type JobRecord struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	Queue       string     `gorm:"size:128;index:idx_micro_jobs_fetch,priority:1" json:"queue"`
+	Type        string     `gorm:"size:255" json:"type"`
+	Payload     string     `json:"payload"`
+	TraceID     string     `gorm:"size:64" json:"trace_id"`
+	Status      string     `gorm:"size:16;index:idx_micro_jobs_fetch,priority:2" json:"status"`
+	Attempts    int        `json:"attempts"`
+	RunAt       time.Time  `gorm:"index:idx_micro_jobs_fetch,priority:3" json:"run_at"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (JobRecord) TableName() string {
+	return "micro_jobs"
+}
+
+// JobStore keeps the jobs of the queues
+// Fetch must claim the jobs, so a job is never handed to two workers within its lease
+// Complete, Retry and Bury must only change the job claimed by the record, and return ErrLeaseLost otherwise
+type JobStore interface {
+	Push(record *JobRecord) error
+	Fetch(queue string, limit int, lease time.Duration) ([]JobRecord, error)
+	Complete(record *JobRecord) error
+	Retry(record *JobRecord, runAt time.Time, reason string) error
+	Bury(record *JobRecord, reason string) error
+	DeadJobs(queue string) ([]JobRecord, error)
+	Requeue(id uint) error
+}
+
+// UseJobStore replace the job store of the engine, the default one is in memory
+func (e *Engine) UseJobStore(store JobStore) {
+	e.JobStore = store
+}
+
+// RequeueDeadJob move a job from the dead letter back to its queue
+func RequeueDeadJob(engine *Engine, id uint) error {
+	return engine.JobStore.Requeue(id)
+}
+
+// DeadJobs list the jobs in the dead letter of the queue
+func DeadJobs(engine *Engine, queue string) ([]JobRecord, error) {
+	return engine.JobStore.DeadJobs(queue)
+}
+
+type gormJobStore struct {
+	db *gorm.DB
+}
+
+// NewGormJobStore create a job store backed by the database, the table is migrated automatically
+func NewGormJobStore(db *gorm.DB) (JobStore, error) {
+	if err := db.AutoMigrate(&JobRecord{}); err != nil {
+		return nil, err
+	}
+	return &gormJobStore{db: db}, nil
+}
+
+func (s *gormJobStore) Push(record *JobRecord) error {
+	return s.db.Create(record).Error
+}
+
+func (s *gormJobStore) Fetch(queue string, limit int, lease time.Duration) ([]JobRecord, error) {
+	now := time.Now()
+	var candidates []JobRecord
+	err := s.db.
+		Where("queue = ? AND ((status = ? AND run_at <= ?) OR (status = ? AND locked_until <= ?))",
+			queue, JOB_STATUS_PENDING, now, JOB_STATUS_RUNNING, now).
+		Order("run_at").
+		Limit(limit).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := make([]JobRecord, 0, len(candidates))
+	lockedUntil := now.Add(lease)
+	for _, c := range candidates {
+		// the update only succeeds if no other worker claimed the job in the meantime
+		result := s.db.Model(&JobRecord{}).
+			Where("id = ? AND status = ? AND attempts = ?", c.ID, c.Status, c.Attempts).
+			Updates(map[string]interface{}{
+				"status":       JOB_STATUS_RUNNING,
+				"attempts":     c.Attempts + 1,
+				"locked_until": lockedUntil,
+			})
+		if result.Error != nil {
+			return claimed, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		c.Status = JOB_STATUS_RUNNING
+		c.Attempts++
+		c.LockedUntil = &lockedUntil
+		claimed = append(claimed, c)
+	}
+	return claimed, nil
+}
+
+// claimed returns the query of the job claimed by the record, the attempts change when another worker fetches it
+func (s *gormJobStore) claimed(record *JobRecord) *gorm.DB {
+	return s.db.Model(&JobRecord{}).Where("id = ? AND status = ? AND attempts = ?", record.ID, JOB_STATUS_RUNNING, record.Attempts)
+}
+
+func (s *gormJobStore) Complete(record *JobRecord) error {
+	return leaseResult(s.claimed(record).Delete(&JobRecord{}))
+}
+
+func (s *gormJobStore) Retry(record *JobRecord, runAt time.Time, reason string) error {
+	return leaseResult(s.claimed(record).Updates(map[string]interface{}{
+		"status":       JOB_STATUS_PENDING,
+		"run_at":       runAt,
+		"locked_until": nil,
+		"last_error":   reason,
+	}))
+}
+
+func (s *gormJobStore) Bury(record *JobRecord, reason string) error {
+	return leaseResult(s.claimed(record).Updates(map[string]interface{}{
+		"status":       JOB_STATUS_DEAD,
+		"locked_until": nil,
+		"last_error":   reason,
+	}))
+}
+
+func leaseResult(result *gorm.DB) error {
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *gormJobStore) DeadJobs(queue string) ([]JobRecord, error) {
+	records := make([]JobRecord, 0)
+	err := s.db.Where("queue = ? AND status = ?", queue, JOB_STATUS_DEAD).Order("id").Find(&records).Error
+	return records, err
+}
+
+func (s *gormJobStore) Requeue(id uint) error {
+	return s.db.Model(&JobRecord{}).Where("id = ? AND status = ?", id, JOB_STATUS_DEAD).Updates(map[string]interface{}{
+		"status":   JOB_STATUS_PENDING,
+		"attempts": 0,
+		"run_at":   time.Now(),
+	}).Error
+}
+
+type memoryJobStore struct {
+	mu     sync.Mutex
+	nextID uint
+	jobs   map[uint]*JobRecord
+}
+
+// NewMemoryJobStore create a job store in memory, the jobs are lost on restart
+func NewMemoryJobStore() JobStore {
+	return &memoryJobStore{
+		jobs: make(map[uint]*JobRecord),
+	}
+}
+
+func (s *memoryJobStore) Push(record *JobRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	record.ID = s.nextID
+	record.CreatedAt = time.Now()
+	record.UpdatedAt = record.CreatedAt
+	stored := *record
+	s.jobs[record.ID] = &stored
+	return nil
+}
+
+func (s *memoryJobStore) Fetch(queue string, limit int, lease time.Duration) ([]JobRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	candidates := make([]*JobRecord, 0)
+	for _, job := range s.jobs {
+		if job.Queue != queue {
+			continue
+		}
+		if (job.Status == JOB_STATUS_PENDING && !job.RunAt.After(now)) ||
+			(job.Status == JOB_STATUS_RUNNING && job.LockedUntil != nil && !job.LockedUntil.After(now)) {
+			candidates = append(candidates, job)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].RunAt.Before(candidates[j].RunAt)
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	lockedUntil := now.Add(lease)
+	claimed := make([]JobRecord, 0, len(candidates))
+	for _, job := range candidates {
+		job.Status = JOB_STATUS_RUNNING
+		job.Attempts++
+		job.LockedUntil = &lockedUntil
+		job.UpdatedAt = now
+		claimed = append(claimed, *job)
+	}
+	return claimed, nil
+}
+
+// claimed returns the job claimed by the record, the attempts change when another worker fetches it
+func (s *memoryJobStore) claimed(record *JobRecord) (*JobRecord, error) {
+	job, ok := s.jobs[record.ID]
+	if !ok || job.Status != JOB_STATUS_RUNNING || job.Attempts != record.Attempts {
+		return nil, ErrLeaseLost
+	}
+	return job, nil
+}
+
+func (s *memoryJobStore) Complete(record *JobRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.claimed(record); err != nil {
+		return err
+	}
+	delete(s.jobs, record.ID)
+	return nil
+}
+
+func (s *memoryJobStore) Retry(record *JobRecord, runAt time.Time, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, err := s.claimed(record)
+	if err != nil {
+		return err
+	}
+	job.Status = JOB_STATUS_PENDING
+	job.RunAt = runAt
+	job.LockedUntil = nil
+	job.LastError = reason
+	job.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *memoryJobStore) Bury(record *JobRecord, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, err := s.claimed(record)
+	if err != nil {
+		return err
+	}
+	job.Status = JOB_STATUS_DEAD
+	job.LockedUntil = nil
+	job.LastError = reason
+	job.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *memoryJobStore) DeadJobs(queue string) ([]JobRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]JobRecord, 0)
+	for _, job := range s.jobs {
+		if job.Queue == queue && job.Status == JOB_STATUS_DEAD {
+			records = append(records, *job)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+	return records, nil
+}
+
+func (s *memoryJobStore) Requeue(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.jobs[id]; ok && job.Status == JOB_STATUS_DEAD {
+		job.Status = JOB_STATUS_PENDING
+		job.Attempts = 0
+		job.RunAt = time.Now()
+		job.UpdatedAt = job.RunAt
+	}
+	return nil
+}
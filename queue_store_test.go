@@ -0,0 +1,112 @@
+package micro
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func jobStores(t *testing.T) map[string]JobStore {
+	gormStore, err := NewGormJobStore(newTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]JobStore{
+		"memory": NewMemoryJobStore(),
+		"gorm":   gormStore,
+	}
+}
+
+func TestJobStoreFetchClaims(t *testing.T) {
+	for name, store := range jobStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				if err := store.Push(&JobRecord{Queue: "q", Type: "t", Status: JOB_STATUS_PENDING, RunAt: time.Now()}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			store.Push(&JobRecord{Queue: "other", Type: "t", Status: JOB_STATUS_PENDING, RunAt: time.Now()})
+			store.Push(&JobRecord{Queue: "q", Type: "t", Status: JOB_STATUS_PENDING, RunAt: time.Now().Add(time.Hour)})
+
+			first, err := store.Fetch("q", 2, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := store.Fetch("q", 10, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(first) != 2 || len(second) != 1 {
+				t.Fatalf("fetched %d and %d jobs, want 2 and 1", len(first), len(second))
+			}
+			for _, job := range append(first, second...) {
+				if job.Status != JOB_STATUS_RUNNING || job.Attempts != 1 || job.LockedUntil == nil {
+					t.Errorf("job %d is not claimed: %+v", job.ID, job)
+				}
+			}
+		})
+	}
+}
+
+func TestJobStoreLeaseLost(t *testing.T) {
+	for name, store := range jobStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.Push(&JobRecord{Queue: "q", Type: "t", Status: JOB_STATUS_PENDING, RunAt: time.Now()})
+			stale, _ := store.Fetch("q", 1, -time.Second) // the lease is already expired
+			fresh, _ := store.Fetch("q", 1, time.Minute)
+			if len(stale) != 1 || len(fresh) != 1 {
+				t.Fatalf("fetched %d and %d jobs, want the job twice", len(stale), len(fresh))
+			}
+
+			if err := store.Complete(&stale[0]); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("Complete of the stale worker: %v, want ErrLeaseLost", err)
+			}
+			if err := store.Retry(&stale[0], time.Now(), "stale"); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("Retry of the stale worker: %v, want ErrLeaseLost", err)
+			}
+			if err := store.Bury(&stale[0], "stale"); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("Bury of the stale worker: %v, want ErrLeaseLost", err)
+			}
+			if dead, _ := store.DeadJobs("q"); len(dead) != 0 {
+				t.Errorf("the stale worker buried the job")
+			}
+
+			if err := store.Complete(&fresh[0]); err != nil {
+				t.Errorf("Complete of the current worker: %v", err)
+			}
+			if err := store.Complete(&fresh[0]); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("Complete twice: %v, want ErrLeaseLost", err)
+			}
+		})
+	}
+}
+
+func TestJobStoreRetryBuryRequeue(t *testing.T) {
+	for name, store := range jobStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.Push(&JobRecord{Queue: "q", Type: "t", Status: JOB_STATUS_PENDING, RunAt: time.Now()})
+			jobs, _ := store.Fetch("q", 1, time.Minute)
+			if err := store.Retry(&jobs[0], time.Now(), "boom"); err != nil {
+				t.Fatal(err)
+			}
+			jobs, _ = store.Fetch("q", 1, time.Minute)
+			if len(jobs) != 1 || jobs[0].Attempts != 2 || jobs[0].LastError != "boom" {
+				t.Fatalf("retried job: %+v", jobs)
+			}
+			if err := store.Bury(&jobs[0], "dead"); err != nil {
+				t.Fatal(err)
+			}
+			dead, _ := store.DeadJobs("q")
+			if len(dead) != 1 || dead[0].LastError != "dead" {
+				t.Fatalf("dead jobs: %+v", dead)
+			}
+			if err := store.Requeue(dead[0].ID); err != nil {
+				t.Fatal(err)
+			}
+			jobs, _ = store.Fetch("q", 1, time.Minute)
+			if len(jobs) != 1 || jobs[0].Attempts != 1 {
+				t.Fatalf("requeued job: %+v", jobs)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package micro
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ginger-go/micro/plugins/midware"
+)
+
+// RateLimit limit the requests by the config, see midware.RateLimit
+// The rejected requests get the ERR_CODE_TOO_MANY_REQUESTS response with the trace of the engine
+func RateLimit(engine *Engine, config midware.RateLimitConfig) gin.HandlerFunc {
+	config.OnReject = func(c *gin.Context, r midware.RateLimitResult) {
+		traceID := GetTraceID(c)
+		traces := GetTraces(c)
+		err := NewError(ERR_CODE_TOO_MANY_REQUESTS)
+		responseError := &ResponseError{
+			Code:    err.Code(),
+			Message: err.Error(),
+		}
+		traces = append(traces, Trace{
+			TraceID:    traceID,
+			Success:    false,
+			Time:       time.Now(),
+			SystemID:   engine.SystemID,
+			SystemName: engine.SystemName,
+			Error:      responseError,
+		})
+		renderResponse(c, http.StatusTooManyRequests, &Response{
+			Success: false,
+			Error:   responseError,
+			TraceID: traceID,
+			Traces:  traces,
+		})
+	}
+	return midware.RateLimit(config)
+}
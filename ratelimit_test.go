@@ -0,0 +1,41 @@
+package micro
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ginger-go/micro/plugins/midware"
+)
+
+type testPingRequest struct{}
+
+func TestRateLimitResponse(t *testing.T) {
+	engine := newTestEngine()
+	engine.Use(RateLimit(engine, midware.RateLimitConfig{Limit: 1, Period: time.Minute}))
+	GET(engine, "/ping", func() HandlerResponse[testPingRequest] {
+		return HandlerResponse[testPingRequest]{
+			Service: func(ctx *Context[testPingRequest]) (interface{}, Error) {
+				return "pong", nil
+			},
+		}
+	})
+
+	if w := serve(engine, "GET", "/ping", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("status %d within the limit", w.Code)
+	}
+	w := serve(engine, "GET", "/ping", "", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429", w.Code)
+	}
+	resp := decodeResponse(t, w.Body.Bytes(), nil)
+	if resp.Success || resp.Error == nil || resp.Error.Code != ERR_CODE_TOO_MANY_REQUESTS {
+		t.Errorf("response = %+v, want the error %s", resp, ERR_CODE_TOO_MANY_REQUESTS)
+	}
+	if len(resp.Traces) != 1 || resp.Traces[0].SystemID != engine.SystemID {
+		t.Errorf("traces = %+v", resp.Traces)
+	}
+	if w.Header().Get("Retry-After") == "" || w.Header().Get(midware.HEADER_RATE_LIMIT_REMAINING) != "0" {
+		t.Errorf("headers = %v", w.Header())
+	}
+}
@@ -0,0 +1,115 @@
+package micro
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Crash is a panic of a request
+type Crash struct {
+	TraceID    string
+	SystemID   string
+	SystemName string
+	Method     string
+	Path       string // the route, e.g. /orders/:id
+	Panic      interface{}
+	Stack      []byte
+	Time       time.Time
+	GinContext *gin.Context // the request, e.g. to read the caller
+}
+
+// CrashReporter report the panics of the requests, e.g. to an error tracker
+type CrashReporter interface {
+	Report(crash Crash)
+}
+
+// Recovery recover the panics of the handlers, NewEngine uses it instead of the recovery of gin
+// The client gets ERR_CODE_INTERNAL in the Response envelope with a failing trace, the status is 500
+// The crash is logged by Engine.CrashLogger, and reported by Engine.CrashReporter if it is set
+func Recovery(engine *Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if r == http.ErrAbortHandler {
+				// the connection is aborted on purpose, net/http does not log it either
+				panic(r)
+			}
+			crash := Crash{
+				TraceID:    GetTraceID(c),
+				SystemID:   engine.SystemID,
+				SystemName: engine.SystemName,
+				Method:     c.Request.Method,
+				Path:       c.FullPath(),
+				Panic:      r,
+				Stack:      debug.Stack(),
+				Time:       time.Now(),
+				GinContext: c,
+			}
+			engine.reportCrash(crash)
+			if c.Writer.Written() {
+				// the response is partly sent, e.g. a stream or a websocket
+				c.Abort()
+				return
+			}
+			renderCrash(c, crash)
+		}()
+		c.Next()
+	}
+}
+
+// reportCrash log the crash and report it, a failing logger or reporter must not hide the response
+func (e *Engine) reportCrash(crash Crash) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("Recovery: failed to report the panic", r)
+		}
+	}()
+	if e.CrashLogger != nil {
+		e.CrashLogger(crash)
+	} else {
+		log.Printf("[PANIC] (%s@%s) %s %s %s", crash.SystemID, crash.TraceID, crash.Method, crash.Path, crash)
+	}
+	if e.CrashReporter != nil {
+		e.CrashReporter.Report(crash)
+	}
+}
+
+// renderCrash write ERR_CODE_INTERNAL with the traces of the request and a failing trace of the service
+func renderCrash(c *gin.Context, crash Crash) {
+	err := NewError(ERR_CODE_INTERNAL)
+	traces := append(GetTraces(c), Trace{
+		TraceID:    crash.TraceID,
+		Success:    false,
+		Time:       crash.Time,
+		SystemID:   crash.SystemID,
+		SystemName: crash.SystemName,
+		Error: &ResponseError{
+			Code:    err.Code(),
+			Message: err.Error(),
+		},
+	})
+	resp := &Response{
+		Success: false,
+		Error: &ResponseError{
+			Code:    err.Code(),
+			Message: err.Error(),
+		},
+		TraceID: crash.TraceID,
+		Traces:  traces,
+	}
+	renderResponse(c, http.StatusInternalServerError, resp)
+	c.Abort()
+}
+
+// String returns the panic and the stack
+func (crash Crash) String() string {
+	return fmt.Sprintf("panic: %v\n%s", crash.Panic, crash.Stack)
+}
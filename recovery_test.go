@@ -0,0 +1,159 @@
+package micro
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type testCrashReporter struct {
+	crashes []Crash
+	panics  bool
+}
+
+func (r *testCrashReporter) Report(crash Crash) {
+	r.crashes = append(r.crashes, crash)
+	if r.panics {
+		panic("reporter down")
+	}
+}
+
+type testPanicRequest struct{}
+
+func panicEngine(reporter *testCrashReporter, logged *[]Crash) *Engine {
+	engine := newTestEngine()
+	engine.CrashReporter = reporter
+	engine.CrashLogger = func(crash Crash) {
+		*logged = append(*logged, crash)
+	}
+	GET(engine, "/orders/:id", func() HandlerResponse[testPanicRequest] {
+		return HandlerResponse[testPanicRequest]{
+			Service: func(ctx *Context[testPanicRequest]) (interface{}, Error) {
+				panic("boom")
+			},
+		}
+	})
+	return engine
+}
+
+func TestRecovery(t *testing.T) {
+	reporter := &testCrashReporter{}
+	var logged []Crash
+	engine := panicEngine(reporter, &logged)
+
+	w := serve(engine, "GET", "/orders/1", "", map[string]string{MICRO_HEADER_TRACE_ID: "trace-1"})
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", w.Code)
+	}
+	resp := decodeResponse(t, w.Body.Bytes(), nil)
+	if resp.Success || resp.Error == nil || resp.Error.Code != ERR_CODE_INTERNAL || resp.TraceID != "trace-1" {
+		t.Errorf("response %s, want %s of the trace", w.Body, ERR_CODE_INTERNAL)
+	}
+	if len(resp.Traces) != 1 || resp.Traces[0].Success || resp.Traces[0].SystemID != engine.SystemID {
+		t.Errorf("traces %+v, want a failing trace of the service", resp.Traces)
+	}
+	if strings.Contains(w.Body.String(), "boom") {
+		t.Errorf("the panic leaked to the client: %s", w.Body)
+	}
+
+	if len(logged) != 1 || len(reporter.crashes) != 1 {
+		t.Fatalf("%d logged and %d reported, want the crash once each", len(logged), len(reporter.crashes))
+	}
+	crash := reporter.crashes[0]
+	if crash.Panic != "boom" || crash.Path != "/orders/:id" || crash.Method != "GET" || crash.TraceID != "trace-1" || len(crash.Stack) == 0 {
+		t.Errorf("crash %+v", crash)
+	}
+}
+
+func TestRecoveryFailingReporter(t *testing.T) {
+	var logged []Crash
+	engine := panicEngine(&testCrashReporter{panics: true}, &logged)
+	w := serve(engine, "GET", "/orders/1", "", nil)
+	if resp := decodeResponse(t, w.Body.Bytes(), nil); w.Code != http.StatusInternalServerError || resp.Error == nil || resp.Error.Code != ERR_CODE_INTERNAL {
+		t.Errorf("status %d %s, want the envelope despite the reporter", w.Code, w.Body)
+	}
+}
+
+func TestRecoveryWritten(t *testing.T) {
+	reporter := &testCrashReporter{}
+	engine := newTestEngine()
+	engine.CrashReporter = reporter
+	engine.CrashLogger = func(Crash) {}
+	engine.GinEngine.GET("/stream", func(c *gin.Context) {
+		c.String(200, "partial")
+		panic("boom")
+	})
+
+	w := serve(engine, "GET", "/stream", "", nil)
+	if w.Code != 200 || w.Body.String() != "partial" || len(reporter.crashes) != 1 {
+		t.Errorf("status %d %q, %d reported, want the partial response kept and the crash reported", w.Code, w.Body, len(reporter.crashes))
+	}
+}
+
+func TestRecoveryAbortHandler(t *testing.T) {
+	reporter := &testCrashReporter{}
+	engine := newTestEngine()
+	engine.CrashReporter = reporter
+	engine.GinEngine.GET("/abort", func(c *gin.Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler panicked again", r)
+		}
+		if len(reporter.crashes) != 0 {
+			t.Error("the aborted handler is reported")
+		}
+	}()
+	serve(engine, "GET", "/abort", "", nil)
+}
+
+func TestRecoveryRollback(t *testing.T) {
+	db := newTestDB(t)
+	db.AutoMigrate(&testTodo{})
+	engine := newTestEngine()
+	engine.CrashLogger = func(Crash) {}
+	engine.UseDB(db)
+	POST(engine, "/todos", func() HandlerResponse[testTodoRequest] {
+		return HandlerResponse[testTodoRequest]{
+			Transaction: true,
+			Service: func(ctx *Context[testTodoRequest]) (interface{}, Error) {
+				ctx.DB().Create(&testTodo{Title: ctx.Request.Title})
+				panic("boom")
+			},
+		}
+	})
+
+	if w := serve(engine, "POST", "/todos", `{"title":"a"}`, nil); w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", w.Code)
+	}
+	var count int64
+	db.Model(&testTodo{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d rows, want the transaction rolled back", count)
+	}
+}
+
+func TestRecoveryCache(t *testing.T) {
+	engine := newTestEngine()
+	engine.CrashLogger = func(Crash) {}
+	GETWithCache(engine, "/cached", time.Minute, func() HandlerResponse[testPanicRequest] {
+		return HandlerResponse[testPanicRequest]{
+			Service: func(ctx *Context[testPanicRequest]) (interface{}, Error) {
+				panic("boom")
+			},
+		}
+	})
+
+	// the recovery writes to the client, not to the buffer of the cache
+	for i := 0; i < 2; i++ {
+		w := serve(engine, "GET", "/cached", "", nil)
+		if resp := decodeResponse(t, w.Body.Bytes(), nil); w.Code != http.StatusInternalServerError || resp.Error == nil || resp.Error.Code != ERR_CODE_INTERNAL {
+			t.Errorf("request %d: status %d %s, want the envelope of the panic", i+1, w.Code, w.Body)
+		}
+	}
+}
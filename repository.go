@@ -1,14 +1,134 @@
 package micro
 
 import (
+	"context"
+	"reflect"
+
 	"github.com/ginger-go/sql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	field_version    = "Version"
+	field_created_by = "CreatedBy"
+	field_updated_by = "UpdatedBy"
+	field_deleted_at = "DeletedAt"
 )
 
-type BaseRepository[T any] struct{}
+// BaseRepository is the repository of the entity T
+//
+// If Versioned, the entity must have a Version field, an update only succeeds if the version is not changed by others
+// since it is read, otherwise Save returns the ERR_CODE_CONFLICT error.
+// The CreatedBy and UpdatedBy fields of the entity are stamped with the actor of the database, see WithActor.
+// If Topic is set, Save and Delete write the events {Topic}.created, {Topic}.updated and {Topic}.deleted to the outbox
+// in the same transaction, see WriteOutbox.
+type BaseRepository[T any] struct {
+	Versioned bool
+	Topic     string
+}
+
+// Save saves the entity, if the fields are given, only the fields are updated, zero values included
+// A new entity, whose primary key is zero, is created with all its fields even if the fields are given
+func (r *BaseRepository[T]) Save(tx *gorm.DB, entity *T, fields ...FieldMask) (*T, error) {
+	if r.Topic == "" {
+		return r.save(tx, entity, fields...)
+	}
+	var saved *T
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		creating, err := r.creating(tx, entity)
+		if err != nil {
+			return err
+		}
+		if saved, err = r.save(tx, entity, fields...); err != nil {
+			return err
+		}
+		if creating {
+			return r.writeEntityOutbox(tx, OUTBOX_EVENT_CREATED, saved)
+		}
+		return r.writeEntityOutbox(tx, OUTBOX_EVENT_UPDATED, saved)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func (r *BaseRepository[T]) save(tx *gorm.DB, entity *T, fields ...FieldMask) (*T, error) {
+	sch, err := r.schema(tx)
+	if err != nil {
+		return nil, err
+	}
+	val := reflect.ValueOf(entity).Elem()
+	creating, err := r.creating(tx, entity)
+	if err != nil {
+		return nil, err
+	}
 
-func (r *BaseRepository[T]) Save(tx *gorm.DB, entity *T) (*T, error) {
-	return sql.Save(tx, entity)
+	var names []string
+	partial := len(fields) > 0 && fields[0] != nil
+	if partial {
+		names = fields[0].Names()
+		if len(names) == 0 && !creating {
+			return entity, nil
+		}
+	}
+
+	if actor := GetActor(tx); actor != "" {
+		if f := sch.LookUpField(field_created_by); f != nil && creating {
+			if _, zero := f.ValueOf(tx.Statement.Context, val); zero {
+				f.Set(tx.Statement.Context, val, actor)
+			}
+		}
+		if f := sch.LookUpField(field_updated_by); f != nil {
+			f.Set(tx.Statement.Context, val, actor)
+			names = append(names, f.Name)
+		}
+	}
+
+	if !r.Versioned {
+		if creating {
+			if err := tx.Create(entity).Error; err != nil {
+				return nil, err
+			}
+			return entity, nil
+		}
+		if partial {
+			if err := tx.Model(entity).Select(names).Updates(entity).Error; err != nil {
+				return nil, err
+			}
+			return entity, nil
+		}
+		return sql.Save(tx, entity)
+	}
+
+	version := sch.LookUpField(field_version)
+	if version == nil {
+		return nil, gorm.ErrInvalidField
+	}
+	if creating {
+		version.Set(tx.Statement.Context, val, 1)
+		return sql.Save(tx, entity)
+	}
+
+	current, _ := version.ValueOf(tx.Statement.Context, val)
+	next, ok := nextVersion(current)
+	if !ok {
+		return nil, gorm.ErrInvalidField
+	}
+	version.Set(tx.Statement.Context, val, next)
+	if !partial {
+		names = []string{"*"}
+	}
+	result := tx.Model(entity).Where(version.DBName+" = ?", current).Select(append(names, version.Name)).Updates(entity)
+	if result.Error != nil || result.RowsAffected == 0 {
+		version.Set(tx.Statement.Context, val, current)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		return nil, NewError(ERR_CODE_CONFLICT)
+	}
+	return entity, nil
 }
 
 func (r *BaseRepository[T]) SaveAll(tx *gorm.DB, entities []T) ([]T, error) {
@@ -16,7 +136,15 @@ func (r *BaseRepository[T]) SaveAll(tx *gorm.DB, entities []T) ([]T, error) {
 }
 
 func (r *BaseRepository[T]) Delete(tx *gorm.DB, entity *T) error {
-	return sql.Delete(tx, entity)
+	if r.Topic == "" {
+		return sql.Delete(tx, entity)
+	}
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := sql.Delete(tx, entity); err != nil {
+			return err
+		}
+		return r.writeEntityOutbox(tx, OUTBOX_EVENT_DELETED, entity)
+	})
 }
 
 func (r *BaseRepository[T]) DeleteAll(tx *gorm.DB, entities []T) error {
@@ -27,6 +155,41 @@ func (r *BaseRepository[T]) DeleteBy(tx *gorm.DB, clause *sql.Clause) error {
 	return sql.DeleteAllByClause[T](tx, clause)
 }
 
+// Restore restores the soft deleted entity
+func (r *BaseRepository[T]) Restore(tx *gorm.DB, entity *T) error {
+	sch, err := r.schema(tx)
+	if err != nil {
+		return err
+	}
+	deletedAt := sch.LookUpField(field_deleted_at)
+	if deletedAt == nil {
+		return gorm.ErrInvalidField
+	}
+	err = tx.Unscoped().Model(entity).Update(deletedAt.DBName, nil).Error
+	if err != nil {
+		return err
+	}
+	return deletedAt.Set(tx.Statement.Context, reflect.ValueOf(entity).Elem(), gorm.DeletedAt{})
+}
+
+// WithDeleted returns the database which the soft deleted entities are included in the queries
+// e.g. r.FindAll(r.WithDeleted(tx), clause)
+func (r *BaseRepository[T]) WithDeleted(tx *gorm.DB) *gorm.DB {
+	return tx.Unscoped()
+}
+
+// OnlyDeleted returns the database which only the soft deleted entities are queried
+// e.g. r.FindAll(r.OnlyDeleted(tx), clause)
+func (r *BaseRepository[T]) OnlyDeleted(tx *gorm.DB) *gorm.DB {
+	column := "deleted_at"
+	if sch, err := r.schema(tx); err == nil {
+		if deletedAt := sch.LookUpField(field_deleted_at); deletedAt != nil {
+			column = deletedAt.DBName
+		}
+	}
+	return tx.Unscoped().Where(column + " IS NOT NULL")
+}
+
 func (r *BaseRepository[T]) FindOne(tx *gorm.DB, clause *sql.Clause) (*T, error) {
 	return sql.FindOne[T](tx, clause)
 }
@@ -46,3 +209,57 @@ func (r *BaseRepository[T]) Count(tx *gorm.DB, clause *sql.Clause) (int64, error
 func (r *BaseRepository[T]) FindByID(tx *gorm.DB, id uint) (*T, error) {
 	return sql.FindOne[T](tx, sql.Eq("id", id))
 }
+
+func (r *BaseRepository[T]) schema(tx *gorm.DB) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// creating returns true if the primary key of the entity is zero
+func (r *BaseRepository[T]) creating(tx *gorm.DB, entity *T) (bool, error) {
+	sch, err := r.schema(tx)
+	if err != nil {
+		return false, err
+	}
+	if sch.PrioritizedPrimaryField == nil {
+		return true, nil
+	}
+	_, zero := sch.PrioritizedPrimaryField.ValueOf(tx.Statement.Context, reflect.ValueOf(entity).Elem())
+	return zero, nil
+}
+
+// nextVersion returns the version increased by one, the version must be an integer
+func nextVersion(version interface{}) (interface{}, bool) {
+	v := reflect.ValueOf(version)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() + 1, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() + 1, true
+	}
+	return nil, false
+}
+
+type actorKey struct{}
+
+// WithActor returns the database which the entities saved by BaseRepository are stamped with the actor
+// in the CreatedBy and UpdatedBy fields
+func WithActor(tx *gorm.DB, actor string) *gorm.DB {
+	ctx := tx.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tx.WithContext(context.WithValue(ctx, actorKey{}, actor))
+}
+
+// GetActor returns the actor of the database set by WithActor
+func GetActor(tx *gorm.DB) string {
+	if tx == nil || tx.Statement == nil || tx.Statement.Context == nil {
+		return ""
+	}
+	actor, _ := tx.Statement.Context.Value(actorKey{}).(string)
+	return actor
+}
@@ -0,0 +1,86 @@
+package micro
+
+import (
+	"testing"
+)
+
+type testNote struct {
+	ID        uint `gorm:"primaryKey"`
+	Title     string
+	Body      string
+	Pinned    bool
+	CreatedBy string
+	UpdatedBy string
+}
+
+type testVersionedNote struct {
+	ID      uint `gorm:"primaryKey"`
+	Title   string
+	Version int
+}
+
+func TestRepositorySavePartial(t *testing.T) {
+	db := newTestDB(t)
+	db.AutoMigrate(&testNote{})
+	repo := &BaseRepository[testNote]{}
+	tx := WithActor(db, "alice")
+
+	// a new entity is created with all its fields, not only the masked ones
+	note, err := repo.Save(tx, &testNote{Title: "title", Body: "body"}, FieldMask{"Title": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.ID == 0 {
+		t.Fatal("the new note is not created")
+	}
+	stored := &testNote{}
+	db.First(stored, note.ID)
+	if stored.Title != "title" || stored.Body != "body" || stored.CreatedBy != "alice" || stored.UpdatedBy != "alice" {
+		t.Errorf("created note = %+v", stored)
+	}
+
+	// an existing entity only updates the masked fields, zero values included
+	_, err = repo.Save(WithActor(db, "bob"), &testNote{ID: note.ID, Title: "changed", Body: "ignored", Pinned: false}, FieldMask{"Pinned": true, "Title": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored = &testNote{}
+	db.First(stored, note.ID)
+	if stored.Title != "changed" || stored.Body != "body" || stored.CreatedBy != "alice" || stored.UpdatedBy != "bob" {
+		t.Errorf("updated note = %+v", stored)
+	}
+
+	// an empty mask of an existing entity changes nothing
+	if _, err := repo.Save(db, &testNote{ID: note.ID}, FieldMask{}); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&testNote{}).Count(&count)
+	if count != 1 {
+		t.Errorf("%d notes, want 1", count)
+	}
+}
+
+func TestRepositorySaveVersioned(t *testing.T) {
+	db := newTestDB(t)
+	db.AutoMigrate(&testVersionedNote{})
+	repo := &BaseRepository[testVersionedNote]{Versioned: true}
+
+	note, err := repo.Save(db, &testVersionedNote{Title: "v1"}, FieldMask{"Title": true})
+	if err != nil || note.ID == 0 || note.Version != 1 {
+		t.Fatalf("created note = %+v, %v", note, err)
+	}
+	stale := *note
+	note.Title = "v2"
+	if _, err := repo.Save(db, note, FieldMask{"Title": true}); err != nil || note.Version != 2 {
+		t.Fatalf("updated note = %+v, %v", note, err)
+	}
+	stale.Title = "lost"
+	_, err = repo.Save(db, &stale, FieldMask{"Title": true})
+	if e, ok := err.(Error); !ok || e.Code() != ERR_CODE_CONFLICT {
+		t.Errorf("stale save: %v, want ERR_CODE_CONFLICT", err)
+	}
+	if stale.Version != 1 {
+		t.Errorf("the version of the stale note is %d after the conflict, want 1", stale.Version)
+	}
+}
@@ -1,86 +1,376 @@
 package micro
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/ginger-go/env"
+	"google.golang.org/protobuf/proto"
 )
 
+// MULTIPART_MAX_SIZE is the max size of a multipart body in bytes, a larger upload fails with ERR_CODE_FILE_TOO_LARGE
+var MULTIPART_MAX_SIZE = int64(env.Int("MICRO_MULTIPART_MAX_SIZE", 32<<20))
+
 // GinRequest get the request from gin context
 func GinRequest[T any](ctx *gin.Context) *T {
+	request, _, _ := bindRequest[T](ctx, false)
+	return request
+}
+
+// GinRequestWithMask get the request from gin context, together with the fields present in the request
+// The present fields are copied even if their values are zero
+func GinRequestWithMask[T any](ctx *gin.Context) (*T, FieldMask) {
+	request, mask, _ := bindRequest[T](ctx, true)
+	return request, mask
+}
+
+func bindRequest[T any](ctx *gin.Context, withMask bool) (*T, FieldMask, Error) {
 	objects := make([]T, 0)
-	tags := parseTags(new(T))
+	var masks []FieldMask
+	plan := requestPlanFor(reflect.TypeOf(new(T)).Elem())
+	formContent := isFormContent(ctx)
+	if formContent && strings.HasPrefix(ctx.ContentType(), binding.MIMEMultipartPOSTForm) {
+		limitBody(ctx, MULTIPART_MAX_SIZE)
+	}
 
-	for _, tag := range tags {
+	for _, tag := range plan.tags {
+		request := new(T)
+		mask := FieldMask{}
 		switch tag {
 		case tag_json:
-			request := new(T)
-			ctx.ShouldBindJSON(request)
-			objects = append(objects, *request)
+			if formContent {
+				continue
+			}
+			mask = bindBody(ctx, request, plan, withMask)
 		case tag_form:
-			request := new(T)
-			ctx.ShouldBindQuery(request)
-			objects = append(objects, *request)
+			if formContent {
+				// the form body is bound together with the query
+				ctx.ShouldBindWith(request, binding.Form)
+				for key := range ctx.Request.Form {
+					plan.mark(mask, plan.formNames, key, false)
+				}
+			} else {
+				ctx.ShouldBindQuery(request)
+				for key := range ctx.Request.URL.Query() {
+					plan.mark(mask, plan.formNames, key, false)
+				}
+			}
 		case tag_uri:
-			request := new(T)
 			ctx.ShouldBindUri(request)
-			objects = append(objects, *request)
+			for _, param := range ctx.Params {
+				plan.mark(mask, plan.uriNames, param.Key, false)
+			}
+		case tag_header:
+			ctx.ShouldBindHeader(request)
+			for key := range ctx.Request.Header {
+				plan.mark(mask, plan.headerNames, key, false)
+			}
+		case tag_cookie:
+			cookies := make(map[string][]string)
+			for _, cookie := range ctx.Request.Cookies() {
+				cookies[cookie.Name] = append(cookies[cookie.Name], cookie.Value)
+				plan.mark(mask, plan.cookieNames, cookie.Name, false)
+			}
+			binding.MapFormWithTag(request, cookies, tag_cookie)
+		}
+		objects = append(objects, *request)
+		masks = append(masks, mask)
+	}
+
+	if len(plan.files) > 0 && strings.HasPrefix(ctx.ContentType(), binding.MIMEMultipartPOSTForm) {
+		request := new(T)
+		mask := FieldMask{}
+		if err := bindFiles(ctx, request, plan, mask); err != nil {
+			return nil, nil, err
 		}
+		objects = append(objects, *request)
+		masks = append(masks, mask)
 	}
 
-	return updateObjectFromObjects(objects)
+	if !withMask {
+		return updateObjectFromObjects(objects, nil), nil, nil
+	}
+	merged := FieldMask{}
+	for _, mask := range masks {
+		for name := range mask {
+			merged[name] = true
+		}
+	}
+	return updateObjectFromObjects(objects, masks), merged, nil
 }
 
-// parseTags get the tags related to the request method
-func parseTags[T any](request T) []string {
+func isFormContent(ctx *gin.Context) bool {
+	if ctx.Request == nil {
+		return false
+	}
+	contentType := ctx.ContentType()
+	return contentType == binding.MIMEPOSTForm || contentType == binding.MIMEMultipartPOSTForm
+}
+
+// bindBody bind the body with the decoder of the content type, json is the default
+// If withMask, returns the fields present in the body, the presence is not tracked for protobuf
+func bindBody(ctx *gin.Context, request interface{}, plan *requestPlan, withMask bool) FieldMask {
+	mask := FieldMask{}
+	if ctx.Request == nil || ctx.Request.Body == nil {
+		return mask
+	}
+	mime := normalizeMIME(ctx.ContentType())
+	if mime == MIME_PROTOBUF {
+		if _, ok := request.(proto.Message); !ok {
+			return mask
+		}
+	}
+	if mime != MIME_MSGPACK && mime != MIME_PROTOBUF && !withMask {
+		ctx.ShouldBindJSON(request)
+		return mask
+	}
+
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return mask
+	}
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	switch mime {
+	case MIME_MSGPACK, MIME_PROTOBUF:
+		if Unmarshal(mime, body, request) != nil || mime == MIME_PROTOBUF || !withMask {
+			return mask
+		}
+		var present map[string]interface{}
+		if Unmarshal(MIME_MSGPACK, body, &present) != nil {
+			return mask
+		}
+		for key := range present {
+			plan.mark(mask, plan.jsonNames, key, true)
+		}
+	default:
+		// the validation error is ignored as ShouldBindJSON does in GinRequest
+		binding.JSON.BindBody(body, request)
+		var present map[string]json.RawMessage
+		if json.Unmarshal(body, &present) != nil {
+			return mask
+		}
+		for key := range present {
+			plan.mark(mask, plan.jsonNames, key, true)
+		}
+	}
+	return mask
+}
+
+// bindFiles bind the uploaded files of the multipart form to the file fields
+func bindFiles(ctx *gin.Context, request interface{}, plan *requestPlan, mask FieldMask) Error {
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return NewError(ERR_CODE_FILE_TOO_LARGE)
+		}
+		return NewError(ERR_CODE_INVALID_REQUEST)
+	}
+	val := reflect.ValueOf(request).Elem()
+	for _, file := range plan.files {
+		headers := form.File[file.name]
+		if len(headers) == 0 {
+			continue
+		}
+		for _, header := range headers {
+			if file.maxSize > 0 && header.Size > file.maxSize {
+				return NewError(ERR_CODE_FILE_TOO_LARGE)
+			}
+		}
+		if file.multiple {
+			val.Field(file.index).Set(reflect.ValueOf(headers))
+		} else {
+			val.Field(file.index).Set(reflect.ValueOf(headers[0]))
+		}
+		mask[plan.names[file.index]] = true
+	}
+	return nil
+}
+
+const limitedBodyKey = "micro.body.limited"
+
+// limitBody limit the body of the request to max bytes, the body is wrapped once
+func limitBody(ctx *gin.Context, max int64) {
+	if _, limited := ctx.Get(limitedBodyKey); limited || ctx.Request.Body == nil {
+		return
+	}
+	ctx.Set(limitedBodyKey, true)
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, max)
+}
+
+// requestPlan is the binding information of a request type, built on first use
+type requestPlan struct {
+	tags      []string       // the tags related to the request method
+	fields    []int          // the fields merged from the bound objects
+	names     []string       // the field names by index
+	jsonNames map[string]int // the json keys to the field index
+	formNames map[string]int // the query keys to the field index
+	uriNames  map[string]int // the uri params to the field index
+
+	headerNames map[string]int // the canonical header keys to the field index
+	cookieNames map[string]int // the cookie names to the field index
+	files       []requestFile  // the multipart file fields
+}
+
+type requestFile struct {
+	index    int
+	name     string
+	multiple bool
+	maxSize  int64
+}
+
+var (
+	fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+var requestPlans sync.Map
+
+func requestPlanFor(t reflect.Type) *requestPlan {
+	if plan, ok := requestPlans.Load(t); ok {
+		return plan.(*requestPlan)
+	}
+	plan, _ := requestPlans.LoadOrStore(t, compileRequestPlan(t))
+	return plan.(*requestPlan)
+}
+
+func compileRequestPlan(t reflect.Type) *requestPlan {
 	m := make(map[string]bool)
+	plan := &requestPlan{
+		tags:      make([]string, 0),
+		fields:    make([]int, 0),
+		names:     make([]string, t.NumField()),
+		jsonNames: make(map[string]int),
+		formNames: make(map[string]int),
+		uriNames:  make(map[string]int),
 
-	for i := 0; i < reflect.TypeOf(request).Elem().NumField(); i++ {
-		tag := reflect.TypeOf(request).Elem().Field(i).Tag
-		for _, key := range []string{tag_json, tag_form, tag_uri} {
+		headerNames: make(map[string]int),
+		cookieNames: make(map[string]int),
+		files:       make([]requestFile, 0),
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		plan.names[i] = t.Field(i).Name
+		tag := t.Field(i).Tag
+		if t.Field(i).IsExported() {
+			if tag.Get(tag_json) != "-" {
+				plan.jsonNames[tagName(tag.Get(tag_json), t.Field(i).Name)] = i
+			}
+			plan.formNames[tagName(tag.Get(tag_form), t.Field(i).Name)] = i
+			plan.uriNames[tagName(tag.Get(tag_uri), t.Field(i).Name)] = i
+			plan.headerNames[textproto.CanonicalMIMEHeaderKey(tagName(tag.Get(tag_header), t.Field(i).Name))] = i
+			plan.cookieNames[tagName(tag.Get(tag_cookie), t.Field(i).Name)] = i
+			if ft := t.Field(i).Type; ft == fileHeaderType || ft == fileHeadersType {
+				plan.files = append(plan.files, requestFile{
+					index:    i,
+					name:     tagName(tag.Get(tag_form), t.Field(i).Name),
+					multiple: ft == fileHeadersType,
+					maxSize:  parseSize(tag.Get(tag_maxsize)),
+				})
+			}
+		}
+		for _, key := range []string{tag_json, tag_form, tag_uri, tag_header, tag_cookie} {
 			value := tag.Get(key)
-			if len(value) > 0 {
+			if len(value) > 0 && !m[key] {
 				m[key] = true
+				plan.tags = append(plan.tags, key)
+			}
+		}
+		switch t.Field(i).Type.Kind() {
+		case reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64, reflect.Bool,
+			reflect.Slice, reflect.Array, reflect.Map, reflect.Struct, reflect.Ptr:
+			if t.Field(i).IsExported() {
+				plan.fields = append(plan.fields, i)
 			}
 		}
 	}
+	return plan
+}
 
-	result := make([]string, 0)
-	for key := range m {
-		result = append(result, key)
+// parseSize parse the size in bytes, the suffixes KB, MB and GB are supported
+func parseSize(size string) int64 {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	unit := int64(1)
+	for suffix, u := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if strings.HasSuffix(size, suffix) {
+			unit = u
+			size = strings.TrimSpace(strings.TrimSuffix(size, suffix))
+			break
+		}
 	}
-	return result
+	n, err := strconv.ParseInt(strings.TrimSuffix(size, "B"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n * unit
 }
 
-func updateObjectFromObjects[T any](objects []T) *T {
+// tagName get the name in the tag, the field name is used if the tag has no name
+func tagName(tag string, fieldName string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		return fieldName
+	}
+	return name
+}
+
+// mark add the field of the key to the mask
+// The keys are matched case-insensitively if foldCase, as encoding/json does
+func (p *requestPlan) mark(mask FieldMask, names map[string]int, key string, foldCase bool) {
+	if i, ok := names[key]; ok {
+		mask[p.names[i]] = true
+		return
+	}
+	if !foldCase {
+		return
+	}
+	for name, i := range names {
+		if strings.EqualFold(name, key) {
+			mask[p.names[i]] = true
+			return
+		}
+	}
+}
+
+// parseTags get the tags related to the request method
+func parseTags[T any](request T) []string {
+	return requestPlanFor(reflect.TypeOf(request).Elem()).tags
+}
+
+// updateObjectFromObjects merge the non-zero fields of the objects
+// If the masks are given, the zero fields present in the mask of the object are merged too
+func updateObjectFromObjects[T any](objects []T, masks []FieldMask) *T {
 	if len(objects) == 0 {
 		return nil
 	}
 
-	objectVal := reflect.ValueOf(new(T)).Elem()
-	for _, o := range objects {
-		val := reflect.ValueOf(o)
-		for i := 0; i < val.NumField(); i++ {
-			field := val.Field(i)
-			if !field.IsZero() {
-				switch field.Kind() {
-				case reflect.String:
-					objectVal.Field(i).SetString(field.String())
-				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-					objectVal.Field(i).SetInt(field.Int())
-				case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-					objectVal.Field(i).SetUint(field.Uint())
-				case reflect.Float32, reflect.Float64:
-					objectVal.Field(i).SetFloat(field.Float())
-				case reflect.Bool:
-					objectVal.Field(i).SetBool(field.Bool())
-				case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct, reflect.Ptr:
-					objectVal.Field(i).Set(field)
-				}
+	output := new(T)
+	objectVal := reflect.ValueOf(output).Elem()
+	plan := requestPlanFor(objectVal.Type())
+	for i := range objects {
+		val := reflect.ValueOf(&objects[i]).Elem()
+		for _, f := range plan.fields {
+			field := val.Field(f)
+			if !field.IsZero() || (i < len(masks) && masks[i].Has(plan.names[f])) {
+				objectVal.Field(f).Set(field)
 			}
 		}
 	}
 
-	output := objectVal.Interface().(T)
-	return &output
+	return output
 }
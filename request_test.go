@@ -0,0 +1,214 @@
+package micro
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type benchRequest struct {
+	ID     uint   `uri:"id"`
+	Page   int    `form:"page"`
+	Sort   string `form:"sort"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Active bool   `json:"active"`
+	Locale string `header:"Accept-Language"`
+}
+
+func newRequestContext(method, target, body string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(method, target, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", MIME_JSON)
+	c.Request.Header.Set("Accept-Language", "en")
+	c.Params = gin.Params{{Key: "id", Value: "42"}}
+	return c
+}
+
+func TestGinRequestWithMask(t *testing.T) {
+	c := newRequestContext("PUT", "/users/42?page=2", `{"name":"bob","active":false}`)
+	request, mask := GinRequestWithMask[benchRequest](c)
+	want := benchRequest{ID: 42, Page: 2, Name: "bob", Locale: "en"}
+	if *request != want {
+		t.Errorf("request = %+v, want %+v", *request, want)
+	}
+	for _, name := range []string{"ID", "Page", "Name", "Active", "Locale"} {
+		if !mask.Has(name) {
+			t.Errorf("mask %v has no %s", mask, name)
+		}
+	}
+	if mask.Has("Email") || mask.Has("Sort") {
+		t.Errorf("mask %v has the absent fields", mask)
+	}
+}
+
+// benchBindRequest has the tags bound by the baseline, it does not bind the headers
+type benchBindRequest struct {
+	ID     uint   `uri:"id"`
+	Page   int    `form:"page"`
+	Sort   string `form:"sort"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Active bool   `json:"active"`
+}
+
+// baselineGinRequest, baselineParseTags and baselineUpdateObjectFromObjects are the binding before the compiled plans,
+// kept verbatim to benchmark against
+func baselineGinRequest[T any](ctx *gin.Context) *T {
+	objects := make([]T, 0)
+	tags := baselineParseTags(new(T))
+
+	for _, tag := range tags {
+		switch tag {
+		case tag_json:
+			request := new(T)
+			ctx.ShouldBindJSON(request)
+			objects = append(objects, *request)
+		case tag_form:
+			request := new(T)
+			ctx.ShouldBindQuery(request)
+			objects = append(objects, *request)
+		case tag_uri:
+			request := new(T)
+			ctx.ShouldBindUri(request)
+			objects = append(objects, *request)
+		}
+	}
+
+	return baselineUpdateObjectFromObjects(objects)
+}
+
+// baselineParseTags get the tags related to the request method
+func baselineParseTags[T any](request T) []string {
+	m := make(map[string]bool)
+
+	for i := 0; i < reflect.TypeOf(request).Elem().NumField(); i++ {
+		tag := reflect.TypeOf(request).Elem().Field(i).Tag
+		for _, key := range []string{tag_json, tag_form, tag_uri} {
+			value := tag.Get(key)
+			if len(value) > 0 {
+				m[key] = true
+			}
+		}
+	}
+
+	result := make([]string, 0)
+	for key := range m {
+		result = append(result, key)
+	}
+	return result
+}
+
+func baselineUpdateObjectFromObjects[T any](objects []T) *T {
+	if len(objects) == 0 {
+		return nil
+	}
+
+	objectVal := reflect.ValueOf(new(T)).Elem()
+	for _, o := range objects {
+		val := reflect.ValueOf(o)
+		for i := 0; i < val.NumField(); i++ {
+			field := val.Field(i)
+			if !field.IsZero() {
+				switch field.Kind() {
+				case reflect.String:
+					objectVal.Field(i).SetString(field.String())
+				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+					objectVal.Field(i).SetInt(field.Int())
+				case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+					objectVal.Field(i).SetUint(field.Uint())
+				case reflect.Float32, reflect.Float64:
+					objectVal.Field(i).SetFloat(field.Float())
+				case reflect.Bool:
+					objectVal.Field(i).SetBool(field.Bool())
+				case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct, reflect.Ptr:
+					objectVal.Field(i).Set(field)
+				}
+			}
+		}
+	}
+
+	output := objectVal.Interface().(T)
+	return &output
+}
+
+func TestGinRequestMatchesBaseline(t *testing.T) {
+	body := `{"name":"bob","email":"bob@example.com","active":true}`
+	got := GinRequest[benchBindRequest](newRequestContext("PUT", "/users/42?page=2&sort=name", body))
+	want := baselineGinRequest[benchBindRequest](newRequestContext("PUT", "/users/42?page=2&sort=name", body))
+	if *got != *want {
+		t.Errorf("GinRequest = %+v, want %+v", *got, *want)
+	}
+}
+
+func BenchmarkGinRequest(b *testing.B) {
+	body := `{"name":"bob","email":"bob@example.com","active":true}`
+	b.Run("plan", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			GinRequest[benchBindRequest](newRequestContext("PUT", "/users/42?page=2&sort=name", body))
+		}
+	})
+	b.Run("baseline", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			baselineGinRequest[benchBindRequest](newRequestContext("PUT", "/users/42?page=2&sort=name", body))
+		}
+	})
+}
+
+type uploadRequest struct {
+	Name string                `form:"name"`
+	File *multipart.FileHeader `form:"file" maxsize:"1KB"`
+}
+
+func newUploadContext(t *testing.T, size int) *gin.Context {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	w.WriteField("name", "report")
+	part, err := w.CreateFormFile("file", "report.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(bytes.Repeat([]byte("x"), size))
+	w.Close()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/upload", body)
+	c.Request.Header.Set("Content-Type", w.FormDataContentType())
+	return c
+}
+
+func TestBindFiles(t *testing.T) {
+	request, mask, err := bindRequest[uploadRequest](newUploadContext(t, 100), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Name != "report" || request.File == nil || request.File.Size != 100 || !mask.Has("File") {
+		t.Errorf("request = %+v, mask = %v", request, mask)
+	}
+
+	_, _, err = bindRequest[uploadRequest](newUploadContext(t, 2<<10), true)
+	if err == nil || err.Code() != ERR_CODE_FILE_TOO_LARGE {
+		t.Errorf("file over maxsize: %v, want ERR_CODE_FILE_TOO_LARGE", err)
+	}
+
+	defer func(max int64) { MULTIPART_MAX_SIZE = max }(MULTIPART_MAX_SIZE)
+	MULTIPART_MAX_SIZE = 512
+	_, _, err = bindRequest[uploadRequest](newUploadContext(t, 800), true)
+	if err == nil || err.Code() != ERR_CODE_FILE_TOO_LARGE {
+		t.Errorf("body over MULTIPART_MAX_SIZE: %v, want ERR_CODE_FILE_TOO_LARGE", err)
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/upload", strings.NewReader("--broken\r\nnot a part"))
+	c.Request.Header.Set("Content-Type", "multipart/form-data; boundary=other")
+	_, _, err = bindRequest[uploadRequest](c, true)
+	if err == nil || err.Code() != ERR_CODE_INVALID_REQUEST {
+		t.Errorf("malformed multipart: %v, want ERR_CODE_INVALID_REQUEST", err)
+	}
+}
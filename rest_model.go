@@ -6,6 +6,7 @@ type Response struct {
 	Success    bool            `json:"success"`
 	Error      *ResponseError  `json:"error,omitempty"`
 	Pagination *sql.Pagination `json:"pagination,omitempty"`
+	Cursor     *Cursor         `json:"cursor,omitempty"`
 	Data       interface{}     `json:"data,omitempty"`
 	TraceID    string          `json:"trace_id,omitempty"`
 	Traces     []Trace         `json:"traces,omitempty"`
@@ -0,0 +1,129 @@
+package micro
+
+import (
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Result is a response written without the Response envelope
+// Return it from a Service to send a file, a stream, a redirect, a raw body or no content
+// The trace id and the traces are still sent in the Micro-TraceID and Micro-Traces headers
+type Result interface {
+	render(c *gin.Context)
+}
+
+// FileResult sends the file at Path, as an attachment named Name unless Inline
+type FileResult struct {
+	Path    string
+	Name    string
+	Inline  bool
+	Headers map[string]string
+}
+
+// StreamResult sends the content of Reader, the reader is closed if it is an io.Closer
+// Length is the content length, -1 if unknown
+type StreamResult struct {
+	Status      int
+	ContentType string
+	Length      int64
+	Name        string // sent as an attachment if not empty
+	Reader      io.Reader
+	Headers     map[string]string
+}
+
+// RedirectResult redirects to Location, the status is 302 by default
+type RedirectResult struct {
+	Status   int
+	Location string
+	Headers  map[string]string
+}
+
+// RawResult sends Body as it is
+type RawResult struct {
+	Status      int
+	ContentType string
+	Body        []byte
+	Headers     map[string]string
+}
+
+// NoContentResult sends 204 without body
+type NoContentResult struct {
+	Headers map[string]string
+}
+
+func File(path string, name string) *FileResult {
+	return &FileResult{Path: path, Name: name}
+}
+
+func Stream(contentType string, reader io.Reader) *StreamResult {
+	return &StreamResult{ContentType: contentType, Length: -1, Reader: reader}
+}
+
+func Redirect(location string) *RedirectResult {
+	return &RedirectResult{Location: location}
+}
+
+func Raw(contentType string, body []byte) *RawResult {
+	return &RawResult{ContentType: contentType, Body: body}
+}
+
+func Text(text string) *RawResult {
+	return &RawResult{ContentType: "text/plain; charset=utf-8", Body: []byte(text)}
+}
+
+func NoContent() *NoContentResult {
+	return &NoContentResult{}
+}
+
+func (r *FileResult) render(c *gin.Context) {
+	setHeaders(c, r.Headers)
+	if r.Inline {
+		if r.Name != "" {
+			c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": r.Name}))
+		}
+		c.File(r.Path)
+		return
+	}
+	c.FileAttachment(r.Path, r.Name)
+}
+
+func (r *StreamResult) render(c *gin.Context) {
+	if closer, ok := r.Reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if r.Name != "" {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": r.Name}))
+	}
+	c.DataFromReader(statusOr(r.Status, http.StatusOK), r.Length, r.ContentType, r.Reader, r.Headers)
+}
+
+func (r *RedirectResult) render(c *gin.Context) {
+	setHeaders(c, r.Headers)
+	c.Redirect(statusOr(r.Status, http.StatusFound), r.Location)
+}
+
+func (r *RawResult) render(c *gin.Context) {
+	setHeaders(c, r.Headers)
+	c.Data(statusOr(r.Status, http.StatusOK), r.ContentType, r.Body)
+}
+
+func (r *NoContentResult) render(c *gin.Context) {
+	setHeaders(c, r.Headers)
+	c.Status(http.StatusNoContent)
+}
+
+func setHeaders(c *gin.Context, headers map[string]string) {
+	for k, v := range headers {
+		c.Header(k, v)
+	}
+}
+
+func statusOr(status int, defaultStatus int) int {
+	if status == 0 {
+		return defaultStatus
+	}
+	return status
+}
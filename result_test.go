@@ -0,0 +1,88 @@
+package micro
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testResultRequest struct {
+	Kind string `form:"kind"`
+}
+
+type testClosingReader struct {
+	io.Reader
+	closed bool
+}
+
+func (r *testClosingReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.csv")
+	if err := os.WriteFile(path, []byte("a,b\n1,2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reader := &testClosingReader{Reader: strings.NewReader("streamed")}
+	results := map[string]Result{
+		"file":     File(path, "report.csv"),
+		"inline":   &FileResult{Path: path, Name: "report.csv", Inline: true},
+		"stream":   &StreamResult{ContentType: "text/plain", Length: -1, Name: "out.txt", Reader: reader, Headers: map[string]string{"X-Export": "1"}},
+		"redirect": Redirect("https://example.com/next"),
+		"moved":    &RedirectResult{Status: http.StatusMovedPermanently, Location: "/new"},
+		"raw":      &RawResult{Status: http.StatusCreated, ContentType: "image/png", Body: []byte{0x89, 'P', 'N', 'G'}, Headers: map[string]string{"Cache-Control": "no-store"}},
+		"text":     Text("hello"),
+		"empty":    NoContent(),
+	}
+	engine := newTestEngine()
+	GET(engine, "/results", func() HandlerResponse[testResultRequest] {
+		return HandlerResponse[testResultRequest]{
+			Service: func(ctx *Context[testResultRequest]) (interface{}, Error) {
+				return results[ctx.Request.Kind], nil
+			},
+		}
+	})
+
+	for _, test := range []struct {
+		kind    string
+		status  int
+		headers map[string]string
+		body    string
+	}{
+		{"file", 200, map[string]string{"Content-Disposition": `attachment; filename="report.csv"`}, "a,b\n1,2\n"},
+		{"inline", 200, map[string]string{"Content-Disposition": `inline; filename=report.csv`}, "a,b\n1,2\n"},
+		{"stream", 200, map[string]string{"Content-Disposition": `attachment; filename=out.txt`, "Content-Type": "text/plain", "X-Export": "1"}, "streamed"},
+		{"redirect", http.StatusFound, map[string]string{"Location": "https://example.com/next"}, ""},
+		{"moved", http.StatusMovedPermanently, map[string]string{"Location": "/new"}, ""},
+		{"raw", http.StatusCreated, map[string]string{"Content-Type": "image/png", "Cache-Control": "no-store"}, "\x89PNG"},
+		{"text", 200, map[string]string{"Content-Type": "text/plain; charset=utf-8"}, "hello"},
+		{"empty", http.StatusNoContent, nil, ""},
+	} {
+		w := serve(engine, "GET", "/results?kind="+test.kind, "", map[string]string{MICRO_HEADER_TRACE_ID: "trace-" + test.kind})
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.kind, w.Code, test.status)
+		}
+		for k, v := range test.headers {
+			if got := w.Header().Get(k); got != v {
+				t.Errorf("%s: %s = %q, want %q", test.kind, k, got, v)
+			}
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s: body %q, want %q", test.kind, w.Body, test.body)
+		}
+		if strings.Contains(w.Body.String(), `"success"`) {
+			t.Errorf("%s: the envelope is written: %s", test.kind, w.Body)
+		}
+		if w.Header().Get(MICRO_HEADER_TRACE_ID) != "trace-"+test.kind || w.Header().Get(MICRO_HEADER_TRACES) == "" {
+			t.Errorf("%s: the trace headers %v", test.kind, w.Header())
+		}
+	}
+	if !reader.closed {
+		t.Error("the reader of the stream is not closed")
+	}
+}
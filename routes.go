@@ -0,0 +1,206 @@
+package micro
+
+import (
+	"encoding/json"
+	"mime/multipart"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	TYPE_KIND_STRUCT = "struct"
+	TYPE_KIND_SLICE  = "slice"
+	TYPE_KIND_MAP    = "map"
+	TYPE_KIND_PTR    = "ptr"
+	TYPE_KIND_TIME   = "time"
+	TYPE_KIND_BYTES  = "bytes"
+	TYPE_KIND_ANY    = "any"
+)
+
+// Routes is the metadata of the routes of the engine, served at /micro/routes by Engine.ServeRoutes
+// It is read by `micro gen client` to generate the typed client of the service
+type Routes struct {
+	SystemID   string               `json:"system_id"`
+	SystemName string               `json:"system_name"`
+	Routes     []RouteInfo          `json:"routes"`
+	Types      map[string]*TypeInfo `json:"types"` // the named structs referred by the routes
+}
+
+// RouteInfo is the metadata of a route
+type RouteInfo struct {
+	Name       string    `json:"name"` // the name of the handler function
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Request    *TypeInfo `json:"request,omitempty"`
+	Response   *TypeInfo `json:"response,omitempty"` // from HandlerResponse.Response, any if not set
+	Pagination bool      `json:"pagination,omitempty"`
+	Sort       bool      `json:"sort,omitempty"`
+	Cursor     bool      `json:"cursor,omitempty"`
+}
+
+// TypeInfo describe a type, the named structs are referred by Name and described in Routes.Types
+// The kind is the basic kind, e.g. string, int64, bool, or one of the TYPE_KIND constants
+type TypeInfo struct {
+	Kind   string      `json:"kind"`
+	Name   string      `json:"name,omitempty"`
+	Elem   *TypeInfo   `json:"elem,omitempty"`
+	Key    *TypeInfo   `json:"key,omitempty"`
+	Fields []FieldInfo `json:"fields,omitempty"`
+}
+
+type FieldInfo struct {
+	Name     string    `json:"name"`
+	Type     *TypeInfo `json:"type"`
+	Tag      string    `json:"tag,omitempty"`
+	Embedded bool      `json:"embedded,omitempty"`
+}
+
+// addRoute record the metadata of the route
+func addRoute[T any](engine *Engine, method string, route string, handler Handler[T]) {
+	handlerSetup := handler()
+	info := RouteInfo{
+		Name:       handlerName(handler),
+		Method:     method,
+		Path:       route,
+		Request:    engine.routeTypes.describe(reflect.TypeOf(new(T)).Elem()),
+		Pagination: handlerSetup.Pagination,
+		Sort:       handlerSetup.Sort,
+		Cursor:     handlerSetup.Cursor,
+	}
+	if handlerSetup.Response != nil {
+		info.Response = engine.routeTypes.describe(reflect.TypeOf(handlerSetup.Response))
+	}
+	engine.routes = append(engine.routes, info)
+}
+
+// handlerName returns the name of the handler function, empty for the closures and the methods
+func handlerName(handler interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(handler).Pointer())
+	if fn == nil {
+		return ""
+	}
+	name := fn.Name()
+	name = name[strings.LastIndex(name, ".")+1:]
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return ""
+		}
+	}
+	if strings.HasPrefix(name, "func") {
+		return ""
+	}
+	return name
+}
+
+// routeTypes collect the named structs described
+type routeTypes struct {
+	types map[string]*TypeInfo
+	names map[reflect.Type]string
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	marshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	fileHeaderElem = reflect.TypeOf(multipart.FileHeader{})
+)
+
+func (r *routeTypes) describe(t reflect.Type) *TypeInfo {
+	if r.types == nil {
+		r.types = make(map[string]*TypeInfo)
+		r.names = make(map[reflect.Type]string)
+	}
+	if t.Kind() == reflect.Ptr {
+		// the pointers are unwrapped first, e.g. *time.Time is a pointer to the time, not a json.Marshaler
+		elem := r.describe(t.Elem())
+		if elem == nil {
+			return nil
+		}
+		return &TypeInfo{Kind: TYPE_KIND_PTR, Elem: elem}
+	}
+	switch {
+	case t == timeType:
+		return &TypeInfo{Kind: TYPE_KIND_TIME}
+	case t == fileHeaderElem:
+		return nil
+	case t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType):
+		// the json form is unknown
+		return &TypeInfo{Kind: TYPE_KIND_ANY}
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &TypeInfo{Kind: TYPE_KIND_BYTES}
+		}
+		elem := r.describe(t.Elem())
+		if elem == nil {
+			return nil
+		}
+		return &TypeInfo{Kind: TYPE_KIND_SLICE, Elem: elem}
+	case reflect.Map:
+		return &TypeInfo{Kind: TYPE_KIND_MAP, Key: r.describe(t.Key()), Elem: r.describe(t.Elem())}
+	case reflect.Struct:
+		return r.describeStruct(t)
+	case reflect.Interface, reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return &TypeInfo{Kind: TYPE_KIND_ANY}
+	}
+	return &TypeInfo{Kind: t.Kind().String()}
+}
+
+func (r *routeTypes) describeStruct(t reflect.Type) *TypeInfo {
+	if name, ok := r.names[t]; ok {
+		return &TypeInfo{Kind: TYPE_KIND_STRUCT, Name: name}
+	}
+	name := t.Name()
+	if name == "" {
+		// anonymous struct, described in place
+		return &TypeInfo{Kind: TYPE_KIND_STRUCT, Fields: r.describeFields(t)}
+	}
+	// the same name in another package gets a suffix
+	for i := 2; r.types[name] != nil; i++ {
+		name = t.Name() + strconv.Itoa(i)
+	}
+	info := &TypeInfo{Kind: TYPE_KIND_STRUCT, Name: name}
+	r.names[t] = name
+	r.types[name] = info
+	info.Fields = r.describeFields(t)
+	return &TypeInfo{Kind: TYPE_KIND_STRUCT, Name: name}
+}
+
+func (r *routeTypes) describeFields(t reflect.Type) []FieldInfo {
+	fields := make([]FieldInfo, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		typ := r.describe(f.Type)
+		if typ == nil {
+			continue
+		}
+		fields = append(fields, FieldInfo{
+			Name:     f.Name,
+			Type:     typ,
+			Tag:      string(f.Tag),
+			Embedded: f.Anonymous,
+		})
+	}
+	return fields
+}
+
+// MicroRoutesHandler serve the metadata of the routes
+func MicroRoutesHandler(engine *Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, Routes{
+			SystemID:   engine.SystemID,
+			SystemName: engine.SystemName,
+			Routes:     engine.routes,
+			Types:      engine.routeTypes.types,
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package micro
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type testRouteFilter struct {
+	Since  *time.Time  `form:"since"`
+	Until  time.Time   `form:"until" time_format:"unix"`
+	Days   []time.Time `form:"day" time_format:"2006-01-02"`
+	Status string      `form:"status"`
+	Raw    json.RawMessage
+}
+
+type testRouteOrder struct {
+	ID       uint             `json:"id"`
+	Parent   *testRouteOrder  `json:"parent"`
+	Children []testRouteOrder `json:"children"`
+	PaidAt   *time.Time       `json:"paid_at"`
+}
+
+func testListOrders() HandlerResponse[testRouteFilter] {
+	return HandlerResponse[testRouteFilter]{
+		Response:   []testRouteOrder{},
+		Pagination: true,
+		Service: func(ctx *Context[testRouteFilter]) (interface{}, Error) {
+			return nil, nil
+		},
+	}
+}
+
+func TestRouteMetadata(t *testing.T) {
+	engine := newTestEngine()
+	GET(engine, "/orders", testListOrders)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	MicroRoutesHandler(engine)(c)
+	var routes Routes
+	if err := json.Unmarshal(w.Body.Bytes(), &routes); err != nil {
+		t.Fatal(err)
+	}
+	if len(routes.Routes) != 1 {
+		t.Fatalf("routes = %+v", routes.Routes)
+	}
+	route := routes.Routes[0]
+	if route.Name != "testListOrders" || route.Method != "GET" || !route.Pagination {
+		t.Errorf("route = %+v", route)
+	}
+	if route.Response.Kind != TYPE_KIND_SLICE || route.Response.Elem.Name != "testRouteOrder" {
+		t.Errorf("response = %+v", route.Response)
+	}
+
+	filter := routes.Types["testRouteFilter"]
+	kinds := map[string]*TypeInfo{}
+	for _, f := range filter.Fields {
+		kinds[f.Name] = f.Type
+	}
+	if since := kinds["Since"]; since.Kind != TYPE_KIND_PTR || since.Elem.Kind != TYPE_KIND_TIME {
+		t.Errorf("*time.Time is described as %+v, want a pointer to the time", since)
+	}
+	if kinds["Until"].Kind != TYPE_KIND_TIME || kinds["Days"].Elem.Kind != TYPE_KIND_TIME {
+		t.Errorf("the times are described as %+v and %+v", kinds["Until"], kinds["Days"])
+	}
+	if kinds["Raw"].Kind != TYPE_KIND_ANY {
+		t.Errorf("json.RawMessage is described as %+v, want any", kinds["Raw"])
+	}
+
+	order := routes.Types["testRouteOrder"]
+	if parent := order.Fields[1].Type; parent.Kind != TYPE_KIND_PTR || parent.Elem.Name != "testRouteOrder" {
+		t.Errorf("the recursive pointer is described as %+v", parent)
+	}
+}
+
+func TestServeRoutes(t *testing.T) {
+	engine := newTestEngine()
+	GET(engine, "/orders", testListOrders)
+	if w := serve(engine, "GET", "/micro/routes", "", nil); w.Code != 404 {
+		t.Errorf("the routes are served without ServeRoutes: %d", w.Code)
+	}
+
+	engine.ServeRoutes(func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "secret" {
+			c.AbortWithStatus(401)
+		}
+	})
+	if w := serve(engine, "GET", "/micro/routes", "", nil); w.Code != 401 {
+		t.Errorf("the routes are served without the middleware: %d", w.Code)
+	}
+	w := serve(engine, "GET", "/micro/routes", "", map[string]string{"Authorization": "secret"})
+	var routes Routes
+	if err := json.Unmarshal(w.Body.Bytes(), &routes); err != nil || len(routes.Routes) != 1 {
+		t.Errorf("routes = %s, %v", w.Body, err)
+	}
+}
+
+func TestCRUDRouteResponses(t *testing.T) {
+	engine := newTestEngine()
+	CRUD(engine, "/todos", CRUDConfig[testTodo, testTodoDTO, testTodoRequest, testTodoRequest]{})
+	if len(engine.routes) != 5 {
+		t.Fatalf("%d routes, want 5", len(engine.routes))
+	}
+	for _, route := range engine.routes {
+		response := route.Response
+		if route.Method == "DELETE" {
+			if response != nil {
+				t.Errorf("%s %s responds %+v, want nothing", route.Method, route.Path, response)
+			}
+			continue
+		}
+		if route.Method == "GET" && route.Path == "/todos" {
+			if response == nil || response.Kind != TYPE_KIND_SLICE {
+				t.Errorf("the list responds %+v, want a slice", response)
+				continue
+			}
+			response = response.Elem
+		}
+		if response == nil || response.Name != "testTodoDTO" {
+			t.Errorf("%s %s responds %+v, want testTodoDTO", route.Method, route.Path, response)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package micro
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deadline returns the deadline of the request, Context is a context.Context done when the client is gone or the deadline passes
+// Pass it to apicall so the callee stops by the deadline too, Context.DB is already bound to it
+// The deadline is the earliest of HandlerResponse.Timeout, default Engine.Timeout, and the Micro-Deadline of the caller
+//
+// The timeout is cooperative, the service is not interrupted when the deadline passes, it should return on Context.Done,
+// and the calls bound to the context, e.g. Context.DB and apicall, fail by then
+// Once the service returns after the deadline, the response is ERR_CODE_TIMEOUT whatever the service returned,
+// and its transaction is rolled back
+func (ctx *Context[T]) Deadline() (time.Time, bool) {
+	return ctx.base().Deadline()
+}
+
+func (ctx *Context[T]) Done() <-chan struct{} {
+	return ctx.base().Done()
+}
+
+func (ctx *Context[T]) Err() error {
+	return ctx.base().Err()
+}
+
+func (ctx *Context[T]) Value(key interface{}) interface{} {
+	return ctx.base().Value(key)
+}
+
+func (ctx *Context[T]) base() context.Context {
+	if ctx.stdContext != nil {
+		return ctx.stdContext
+	}
+	if ctx.GinContext != nil && ctx.GinContext.Request != nil {
+		return ctx.GinContext.Request.Context()
+	}
+	return context.Background()
+}
+
+// withDeadline derive the context of the request with the deadline of the timeout and the caller
+func (ctx *Context[T]) withDeadline(timeout time.Duration) context.CancelFunc {
+	parent := ctx.GinContext.Request.Context()
+	deadline, ok := GetDeadline(ctx.GinContext)
+	if timeout > 0 && (!ok || time.Now().Add(timeout).Before(deadline)) {
+		deadline, ok = time.Now().Add(timeout), true
+	}
+	if !ok {
+		ctx.stdContext = parent
+		return func() {}
+	}
+	stdContext, cancel := context.WithDeadline(parent, deadline)
+	ctx.stdContext = stdContext
+	ctx.GinContext.Request = ctx.GinContext.Request.WithContext(stdContext)
+	return cancel
+}
+
+// timeoutError returns ERR_CODE_TIMEOUT if the deadline of the request has passed
+func (ctx *Context[T]) timeoutError() Error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return NewError(ERR_CODE_TIMEOUT)
+	}
+	return nil
+}
+
+// GetDeadline returns the deadline of the caller in the Micro-Deadline header
+func GetDeadline(c *gin.Context) (time.Time, bool) {
+	header := c.GetHeader(MICRO_HEADER_DEADLINE)
+	if header == "" {
+		return time.Time{}, false
+	}
+	deadline, err := time.Parse(time.RFC3339Nano, header)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return deadline, true
+}
+
+// FormatDeadline returns the Micro-Deadline header of the deadline
+func FormatDeadline(deadline time.Time) string {
+	return deadline.UTC().Format(time.RFC3339Nano)
+}
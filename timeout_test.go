@@ -0,0 +1,124 @@
+package micro
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type testTimeoutRequest struct{}
+
+func timeoutEngine(timeout time.Duration, service Service[testTimeoutRequest], transaction bool) *Engine {
+	engine := newTestEngine()
+	engine.Timeout = timeout
+	GET(engine, "/slow", func() HandlerResponse[testTimeoutRequest] {
+		return HandlerResponse[testTimeoutRequest]{
+			Transaction: transaction,
+			Service:     service,
+		}
+	})
+	return engine
+}
+
+func TestTimeoutDone(t *testing.T) {
+	var serviceErr error
+	engine := timeoutEngine(20*time.Millisecond, func(ctx *Context[testTimeoutRequest]) (interface{}, Error) {
+		select {
+		case <-ctx.Done():
+			serviceErr = ctx.Err()
+		case <-time.After(time.Second):
+		}
+		return "late", nil
+	}, false)
+
+	w := serve(engine, "GET", "/slow", "", nil)
+	if serviceErr != context.DeadlineExceeded {
+		t.Errorf("the service saw %v, want the deadline exceeded", serviceErr)
+	}
+	if resp := decodeResponse(t, w.Body.Bytes(), nil); resp.Error == nil || resp.Error.Code != ERR_CODE_TIMEOUT {
+		t.Errorf("response %s, want %s", w.Body, ERR_CODE_TIMEOUT)
+	}
+}
+
+func TestTimeoutCooperative(t *testing.T) {
+	// the service ignoring the deadline is not interrupted, the timeout is answered once it returns
+	engine := timeoutEngine(10*time.Millisecond, func(ctx *Context[testTimeoutRequest]) (interface{}, Error) {
+		time.Sleep(30 * time.Millisecond)
+		return "late", nil
+	}, false)
+
+	start := time.Now()
+	w := serve(engine, "GET", "/slow", "", nil)
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("answered in %v, before the service returned", elapsed)
+	}
+	if resp := decodeResponse(t, w.Body.Bytes(), nil); resp.Error == nil || resp.Error.Code != ERR_CODE_TIMEOUT {
+		t.Errorf("response %s, want %s", w.Body, ERR_CODE_TIMEOUT)
+	}
+}
+
+func TestTimeoutRollback(t *testing.T) {
+	db := newTestDB(t)
+	db.AutoMigrate(&testTodo{})
+	engine := timeoutEngine(20*time.Millisecond, func(ctx *Context[testTimeoutRequest]) (interface{}, Error) {
+		if err := ctx.DB().Create(&testTodo{Title: "late"}).Error; err != nil {
+			return nil, NewError(ERR_CODE_DATABASE)
+		}
+		<-ctx.Done()
+		return nil, nil
+	}, true)
+	engine.UseDB(db)
+
+	w := serve(engine, "GET", "/slow", "", nil)
+	if resp := decodeResponse(t, w.Body.Bytes(), nil); resp.Error == nil || resp.Error.Code != ERR_CODE_TIMEOUT {
+		t.Errorf("response %s, want %s", w.Body, ERR_CODE_TIMEOUT)
+	}
+	var count int64
+	db.Model(&testTodo{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d rows, want the transaction rolled back", count)
+	}
+}
+
+func TestTimeoutDeadline(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+	engine := timeoutEngine(time.Hour, func(ctx *Context[testTimeoutRequest]) (interface{}, Error) {
+		deadline, ok = ctx.Deadline()
+		return nil, nil
+	}, false)
+
+	// the earlier deadline of the caller wins
+	caller := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	serve(engine, "GET", "/slow", "", map[string]string{MICRO_HEADER_DEADLINE: FormatDeadline(caller)})
+	if !ok || !deadline.Equal(caller) {
+		t.Errorf("deadline %v %v, want the caller's %v", deadline, ok, caller)
+	}
+
+	serve(engine, "GET", "/slow", "", nil)
+	if !ok || time.Until(deadline) < 59*time.Minute {
+		t.Errorf("deadline %v %v, want the timeout of an hour", deadline, ok)
+	}
+
+	engine.Timeout = 0
+	serve(engine, "GET", "/slow", "", nil)
+	if ok {
+		t.Errorf("deadline %v without a timeout", deadline)
+	}
+}
+
+func TestGetDeadline(t *testing.T) {
+	deadline := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	for header, want := range map[string]bool{FormatDeadline(deadline): true, "tomorrow": false, "": false} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header.Set(MICRO_HEADER_DEADLINE, header)
+		got, ok := GetDeadline(c)
+		if ok != want || (ok && !got.Equal(deadline)) {
+			t.Errorf("GetDeadline(%q) = %v %v", header, got, ok)
+		}
+	}
+}
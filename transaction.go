@@ -0,0 +1,108 @@
+package micro
+
+import (
+	"gorm.io/gorm"
+)
+
+// UseDB set the database of the engine, it is exposed to the services by Context.DB
+func (e *Engine) UseDB(db *gorm.DB) {
+	e.DB = db
+}
+
+// DB returns the request scoped database
+// It is the transaction of the request if HandlerResponse.Transaction is enabled, otherwise HandlerResponse.DB or the database of the engine
+func (ctx *Context[T]) DB() *gorm.DB {
+	return ctx.db
+}
+
+// Transaction run fn in a nested transaction, a savepoint is used if the request is already in a transaction
+// Context.DB returns the nested transaction while fn is running, gorm.ErrInvalidDB is returned if there is no database
+func (ctx *Context[T]) Transaction(fn func(tx *gorm.DB) error) error {
+	outer := ctx.db
+	if outer == nil {
+		return gorm.ErrInvalidDB
+	}
+	defer func() {
+		ctx.db = outer
+	}()
+	return outer.Transaction(func(tx *gorm.DB) error {
+		ctx.db = tx
+		return fn(tx)
+	})
+}
+
+// AfterCommit register fn to run after the transaction of the request is committed, e.g. sending events
+// The functions are dropped if the transaction is rolled back
+// If the request is not in a transaction, they run after the service succeeds
+func (ctx *Context[T]) AfterCommit(fn func()) {
+	ctx.afterCommit = append(ctx.afterCommit, fn)
+}
+
+// runService run the service, in a transaction if enabled
+// The transaction is committed if the service succeeds, and rolled back if it returns an error, panics or the deadline passes
+// The service is not interrupted by the deadline, it is checked once the service returns, see Context.Deadline
+func runService[T any](engine *Engine, ctx *Context[T], handlerSetup HandlerResponse[T]) (resp interface{}, err Error) {
+	if ctx.db == nil {
+		ctx.db = handlerSetup.DB
+	}
+	if ctx.db == nil {
+		ctx.db = engine.DB
+	}
+	if ctx.cacheStore == nil {
+		ctx.cacheStore = engine.CacheStore
+	}
+	if ctx.db != nil {
+		ctx.db = withTraceID(ctx.db, ctx.TraceID).WithContext(ctx.base())
+	}
+	if ctx.db != nil && engine.Actor != nil && ctx.GinContext != nil {
+		ctx.db = WithActor(ctx.db, engine.Actor(ctx.GinContext))
+	}
+	if !handlerSetup.Transaction || ctx.db == nil {
+		resp, err = handlerSetup.Service(ctx)
+		if timeoutErr := ctx.timeoutError(); timeoutErr != nil {
+			return nil, timeoutErr
+		}
+		if err == nil {
+			ctx.runAfterCommit()
+		}
+		return resp, err
+	}
+
+	tx := ctx.db.Begin()
+	if tx.Error != nil {
+		return nil, NewError(ERR_CODE_DATABASE)
+	}
+	ctx.db = tx
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+			ctx.afterCommit = nil
+		}
+	}()
+
+	resp, err = handlerSetup.Service(ctx)
+	if timeoutErr := ctx.timeoutError(); timeoutErr != nil {
+		return nil, timeoutErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tx.Commit().Error != nil {
+		if timeoutErr := ctx.timeoutError(); timeoutErr != nil {
+			return nil, timeoutErr
+		}
+		return nil, NewError(ERR_CODE_DATABASE)
+	}
+	committed = true
+	ctx.runAfterCommit()
+	return resp, nil
+}
+
+func (ctx *Context[T]) runAfterCommit() {
+	callbacks := ctx.afterCommit
+	ctx.afterCommit = nil
+	for _, fn := range callbacks {
+		fn()
+	}
+}